@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+// feedEndpoint serves an API endpoint of a configured feed
+type feedEndpoint func(w http.ResponseWriter, r *http.Request, feedConfig *config.Feed)
+
+// feedAPIHandler routes /api/feeds/{id}/{endpoint} requests, /api/feeds/{id} is served by the "" endpoint.
+// Unknown feeds and endpoints are not found.
+func feedAPIHandler(cfg *config.Config, endpoints map[string]feedEndpoint) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/feeds/"), "/"), "/")
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+
+		endpoint, ok := endpoints[parts[1]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		feedConfig, ok := cfg.Feed(parts[0])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		endpoint(w, r, feedConfig)
+	})
+}
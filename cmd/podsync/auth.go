@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+// authHandler requires either HTTP Basic Auth or a bearer token (if configured) to access the next handler
+func authHandler(cfg *config.Server, next http.Handler) http.Handler {
+	if cfg.Username == "" && cfg.AuthToken == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorized(cfg, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cfg.Username != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="podsync", charset="UTF-8"`)
+		}
+
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func authorized(cfg *config.Server, r *http.Request) bool {
+	if cfg.AuthToken != "" {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") && secureEqual(strings.TrimPrefix(header, "Bearer "), cfg.AuthToken) {
+			return true
+		}
+	}
+
+	if cfg.Username != "" {
+		username, password, ok := r.BasicAuth()
+		// Evaluate both to not leak which one is wrong via timing
+		usernameMatch := secureEqual(username, cfg.Username)
+		passwordMatch := secureEqual(password, cfg.Password)
+		if ok && usernameMatch && passwordMatch {
+			return true
+		}
+	}
+
+	return false
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+func TestAuthHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		server config.Server
+		setup  func(r *http.Request)
+		expect int
+	}{
+		{name: "No auth configured", expect: http.StatusOK},
+		{
+			name:   "Basic auth",
+			server: config.Server{Username: "user", Password: "pass"},
+			setup:  func(r *http.Request) { r.SetBasicAuth("user", "pass") },
+			expect: http.StatusOK,
+		},
+		{
+			name:   "Wrong password",
+			server: config.Server{Username: "user", Password: "pass"},
+			setup:  func(r *http.Request) { r.SetBasicAuth("user", "wrong") },
+			expect: http.StatusUnauthorized,
+		},
+		{
+			name:   "Missing credentials",
+			server: config.Server{Username: "user", Password: "pass"},
+			expect: http.StatusUnauthorized,
+		},
+		{
+			name:   "Bearer token",
+			server: config.Server{AuthToken: "secret"},
+			setup:  func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			expect: http.StatusOK,
+		},
+		{
+			name:   "Wrong bearer token",
+			server: config.Server{AuthToken: "secret"},
+			setup:  func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") },
+			expect: http.StatusUnauthorized,
+		},
+		{
+			name:   "Basic auth with token configured",
+			server: config.Server{Username: "user", Password: "pass", AuthToken: "secret"},
+			setup:  func(r *http.Request) { r.SetBasicAuth("user", "pass") },
+			expect: http.StatusOK,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/feed.xml", nil)
+			if tst.setup != nil {
+				tst.setup(req)
+			}
+
+			recorder := httptest.NewRecorder()
+			authHandler(&tst.server, next).ServeHTTP(recorder, req)
+			assert.Equal(t, tst.expect, recorder.Code)
+
+			if tst.expect == http.StatusUnauthorized && tst.server.Username != "" {
+				assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Basic")
+			}
+		})
+	}
+}
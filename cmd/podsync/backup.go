@@ -0,0 +1,152 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// ExportCommand writes all feeds and episodes to a backup file
+type ExportCommand struct {
+	Out string `long:"out" required:"true" description:"Backup file to write, gzip compressed if the name ends with .gz"`
+}
+
+// ImportCommand restores feeds and episodes from a backup file
+type ImportCommand struct {
+	In string `long:"in" required:"true" description:"Backup file to restore, gzip compressed if the name ends with .gz"`
+}
+
+// backupVersion is increased on incompatible changes of the backup format
+const backupVersion = 1
+
+// backup is a portable copy of the database, unlike database files it doesn't depend on BadgerDB version
+type backup struct {
+	Version int          `json:"version"`
+	Feeds   []backupFeed `json:"feeds"`
+}
+
+type backupFeed struct {
+	Feed     *model.Feed      `json:"feed"`
+	Episodes []*model.Episode `json:"episodes"`
+}
+
+func exportDatabase(ctx context.Context, database db.Storage, w io.Writer) error {
+	data := backup{Version: backupVersion}
+
+	if err := database.WalkFeeds(ctx, func(feed *model.Feed) error {
+		data.Feeds = append(data.Feeds, backupFeed{Feed: feed})
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to read feeds")
+	}
+
+	episodes := 0
+	for i, item := range data.Feeds {
+		if err := database.WalkEpisodes(ctx, item.Feed.ID, func(episode *model.Episode) error {
+			data.Feeds[i].Episodes = append(data.Feeds[i].Episodes, episode)
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "failed to read episodes of feed %q", item.Feed.ID)
+		}
+
+		episodes += len(data.Feeds[i].Episodes)
+	}
+
+	if err := json.NewEncoder(w).Encode(&data); err != nil {
+		return errors.Wrap(err, "failed to write backup")
+	}
+
+	log.Infof("exported %d feed(s) and %d episode(s)", len(data.Feeds), episodes)
+	return nil
+}
+
+// importDatabase restores feeds from backup. Episodes already in the database are kept as is.
+// Feeds missing from the configuration are imported too, but won't be updated until they are added back.
+func importDatabase(ctx context.Context, database db.Storage, r io.Reader, feeds map[string]*config.Feed) error {
+	var data backup
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return errors.Wrap(err, "failed to read backup")
+	}
+
+	if data.Version != backupVersion {
+		return errors.Errorf("unsupported backup version %d", data.Version)
+	}
+
+	episodes := 0
+	for _, item := range data.Feeds {
+		if item.Feed == nil || item.Feed.ID == "" {
+			return errors.New("backup contains a feed without ID")
+		}
+
+		feedID := item.Feed.ID
+		if _, ok := feeds[feedID]; !ok {
+			log.Warnf("feed %q is not found in configuration", feedID)
+		}
+
+		item.Feed.Episodes = item.Episodes
+		if err := database.AddFeed(ctx, feedID, item.Feed); err != nil {
+			return errors.Wrapf(err, "failed to import feed %q", feedID)
+		}
+
+		episodes += len(item.Episodes)
+	}
+
+	log.Infof("imported %d feed(s) and %d episode(s)", len(data.Feeds), episodes)
+	return nil
+}
+
+func exportBackup(ctx context.Context, database db.Storage, path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create backup file")
+	}
+
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if !strings.HasSuffix(path, ".gz") {
+		return exportDatabase(ctx, database, f)
+	}
+
+	gz := gzip.NewWriter(f)
+	if err := exportDatabase(ctx, database, gz); err != nil {
+		gz.Close()
+		return err
+	}
+
+	return gz.Close()
+}
+
+func importBackup(ctx context.Context, database db.Storage, path string, feeds map[string]*config.Feed) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open backup file")
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return errors.Wrap(err, "failed to decompress backup")
+		}
+		defer gz.Close()
+
+		r = gz
+	}
+
+	return importDatabase(ctx, database, r, feeds)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestBackup(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	pubDate := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	addEpisode(t, env, "1", &model.Episode{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: pubDate, Size: 100})
+	addEpisode(t, env, "1", &model.Episode{ID: "b", Title: "B", Status: model.EpisodeNew, PubDate: pubDate})
+	addEpisode(t, env, "orphan", &model.Episode{ID: "c", Status: model.EpisodeCleaned, PubDate: pubDate})
+
+	for _, name := range []string{"backup.json", "backup.json.gz"} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "podsync-backup-")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, name)
+			require.NoError(t, exportBackup(testCtx, env.db, path))
+
+			restored, err := db.NewBadger(&config.Database{Dir: filepath.Join(dir, "db")})
+			require.NoError(t, err)
+			defer restored.Close()
+
+			// Feeds missing from configuration are imported as well
+			feeds := map[string]*config.Feed{"1": testFeed("1")}
+			require.NoError(t, importBackup(testCtx, restored, path, feeds))
+
+			for _, feedID := range []string{"1", "orphan"} {
+				expected, err := env.db.GetFeed(testCtx, feedID)
+				require.NoError(t, err)
+
+				actual, err := restored.GetFeed(testCtx, feedID)
+				require.NoError(t, err)
+				assert.Equal(t, expected, actual)
+			}
+		})
+	}
+}
+
+func TestImportBackup_Invalid(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	err := importDatabase(testCtx, env.db, bytes.NewBufferString(`{"version": 2, "feeds": []}`), nil)
+	assert.EqualError(t, err, "unsupported backup version 2")
+
+	err = importDatabase(testCtx, env.db, bytes.NewBufferString(`{"version": 1, "feeds": [{"feed": {"title": "No ID"}}]}`), nil)
+	assert.EqualError(t, err, "backup contains a feed without ID")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// FsckCommand reconciles files in storage with the database
+type FsckCommand struct {
+	Prune bool `long:"prune" description:"Delete orphaned files instead of just reporting them"`
+}
+
+// fsckResult is a summary of a storage check
+type fsckResult struct {
+	Orphans []string // Files not belonging to any episode, as "ns/name"
+	Missing []string // Downloaded episodes without files, as "feed/episode"
+}
+
+// fsck looks for files which don't belong to any episode (e.g. left by renamed feeds, changed file name
+// templates or crashes) and for downloaded episodes with missing files. Such episodes are reset, so they are
+// downloaded again during the next update. Orphaned files are deleted only if prune is set.
+// Only feed XMLs in the root and directories of feeds known to the configuration or the database are checked,
+// so other files in the data directory are never touched.
+func fsck(ctx context.Context, database db.Storage, storage fs.Storage, feeds map[string]*config.Feed, prune bool) (*fsckResult, error) {
+	walker, ok := storage.(fs.Walker)
+	if !ok {
+		return nil, errors.New("storage doesn't support listing files")
+	}
+
+	known := map[string]bool{}
+	for id := range feeds {
+		known[id] = true
+	}
+
+	if err := database.WalkFeeds(ctx, func(feed *model.Feed) error {
+		known[feed.ID] = true
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to read feeds")
+	}
+
+	result := &fsckResult{}
+	orphans := map[string][]string{}
+
+	if err := walker.Walk(ctx, "", func(fileName string) error {
+		if id := strings.TrimSuffix(fileName, ".xml"); id != fileName && feeds[id] == nil {
+			orphans[""] = append(orphans[""], fileName)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to list feed XMLs")
+	}
+
+	ids := make([]string, 0, len(known))
+	for id := range known {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		files := map[string]bool{}
+		if err := walker.Walk(ctx, id, func(fileName string) error {
+			files[fileName] = true
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to list files of feed %q", id)
+		}
+
+		feedConfig, ok := feeds[id]
+		if !ok {
+			// File names can't be rendered without configuration, renamed or removed feeds are orphaned altogether
+			if len(files) > 0 {
+				log.Warnf("feed %q is not found in configuration", id)
+			}
+
+			for fileName := range files {
+				orphans[id] = append(orphans[id], fileName)
+			}
+			continue
+		}
+
+		// Resized cover art is published by the updater (see cover_art_resize)
+		delete(files, feed.CoverArtName)
+
+		var missing []string
+		if err := database.WalkEpisodes(ctx, id, func(episode *model.Episode) error {
+			if episode.Status == model.EpisodeCleaned {
+				return nil
+			}
+
+			episodeName := feed.EpisodeName(feedConfig, episode)
+			if episode.Status == model.EpisodeDownloaded && !files[episodeName] {
+				missing = append(missing, episode.ID)
+			}
+
+			for _, name := range []string{
+				episodeName,
+				feed.TranscriptName(feedConfig, episode),
+				feed.ChaptersName(feedConfig, episode),
+				feed.ArtworkName(feedConfig, episode),
+				feed.InfoName(feedConfig, episode),
+				feed.OriginalName(feedConfig, episode),
+			} {
+				delete(files, name)
+			}
+
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to read episodes of feed %q", id)
+		}
+
+		for fileName := range files {
+			orphans[id] = append(orphans[id], fileName)
+		}
+
+		// Database can't be updated while walking over episodes
+		for _, episodeID := range missing {
+			log.Warnf("file of episode %q of feed %q is missing, it will be downloaded during the next update", episodeID, id)
+			if err := database.UpdateEpisode(id, episodeID, func(episode *model.Episode) error {
+				episode.Status = model.EpisodeNew
+				episode.Size = 0
+				return nil
+			}); err != nil {
+				return nil, errors.Wrapf(err, "failed to reset episode %q of feed %q", episodeID, id)
+			}
+
+			result.Missing = append(result.Missing, path.Join(id, episodeID))
+		}
+	}
+
+	namespaces := make([]string, 0, len(orphans))
+	for ns := range orphans {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		sort.Strings(orphans[ns])
+		for _, fileName := range orphans[ns] {
+			name := path.Join(ns, fileName)
+			result.Orphans = append(result.Orphans, name)
+
+			if !prune {
+				log.Warnf("orphaned file %q", name)
+				continue
+			}
+
+			if err := storage.Delete(ctx, ns, fileName); err != nil {
+				return nil, errors.Wrapf(err, "failed to delete orphaned file %q", name)
+			}
+			log.Infof("deleted orphaned file %q", name)
+		}
+	}
+
+	switch {
+	case len(result.Orphans) == 0:
+		log.Info("no orphaned files found")
+	case prune:
+		log.Infof("deleted %d orphaned file(s)", len(result.Orphans))
+	default:
+		log.Infof("found %d orphaned file(s), run with --prune to delete them", len(result.Orphans))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestFsck(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	feeds := map[string]*config.Feed{"1": testFeed("1")}
+	addEpisode(t, env, "1", &model.Episode{ID: "ok", Status: model.EpisodeDownloaded, PubDate: time.Now()})
+	addEpisode(t, env, "1", &model.Episode{ID: "missing", Status: model.EpisodeDownloaded, Size: 10, PubDate: time.Now()})
+	addEpisode(t, env, "1", &model.Episode{ID: "cleaned", Status: model.EpisodeCleaned, PubDate: time.Now()})
+	// Renamed feed
+	addEpisode(t, env, "old", &model.Episode{ID: "ok", Status: model.EpisodeDownloaded, PubDate: time.Now()})
+
+	for _, file := range []struct{ ns, name string }{
+		{"", "1.xml"},
+		{"", "old.xml"},
+		{"", "podsync.opml"},
+		{"1", "ok.mp3"},
+		{"1", "ok.vtt"},
+		{"1", feed.CoverArtName},
+		{"1", "cleaned.mp3"},
+		{"1", "stray.mp3.part"},
+		{"old", "ok.mp3"},
+		// Neither configured nor in database
+		{"unknown", "file"},
+	} {
+		_, err := env.fs.Create(testCtx, file.ns, file.name, strings.NewReader("data"))
+		require.NoError(t, err)
+	}
+
+	// Feed XMLs in the root go first
+	expected := []string{"old.xml", "1/cleaned.mp3", "1/stray.mp3.part", "old/ok.mp3"}
+
+	result, err := fsck(testCtx, env.db, env.fs, feeds, false)
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.Orphans)
+	assert.Equal(t, []string{"1/missing"}, result.Missing)
+
+	episode, err := env.db.GetEpisode(testCtx, "1", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, episode.Status)
+	assert.EqualValues(t, 0, episode.Size)
+
+	// Nothing is deleted without prune
+	_, err = env.fs.Size(testCtx, "1", "cleaned.mp3")
+	assert.NoError(t, err)
+
+	result, err = fsck(testCtx, env.db, env.fs, feeds, true)
+	require.NoError(t, err)
+	assert.Equal(t, expected, result.Orphans)
+	assert.Empty(t, result.Missing)
+
+	for _, name := range expected {
+		idx := strings.LastIndex(name, "/")
+		_, err = env.fs.Size(testCtx, name[:idx+1], name[idx+1:])
+		assert.True(t, os.IsNotExist(err), name)
+	}
+
+	for _, name := range []string{"1.xml", "podsync.opml", "1/ok.mp3", "1/ok.vtt", "1/" + feed.CoverArtName, "unknown/file"} {
+		idx := strings.LastIndex(name, "/")
+		_, err = env.fs.Size(testCtx, name[:idx+1], name[idx+1:])
+		assert.NoError(t, err, name)
+	}
+
+	result, err = fsck(testCtx, env.db, env.fs, feeds, false)
+	require.NoError(t, err)
+	assert.Empty(t, result.Orphans)
+}
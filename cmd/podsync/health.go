@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// healthStatus reports the health of feeds at /healthz, based on the outcome of updates saved by the updater
+type healthStatus struct {
+	started time.Time
+}
+
+func newHealthStatus() *healthStatus {
+	return &healthStatus{started: time.Now()}
+}
+
+// lastStatus returns the saved outcome of the latest feed updates, it's empty if the feed wasn't updated yet
+func lastStatus(ctx context.Context, database db.Storage, feedID string) *model.FeedStatus {
+	status, err := database.GetFeedStatus(ctx, feedID)
+	if err != nil {
+		if err != model.ErrNotFound {
+			log.WithError(err).Warnf("failed to query status of %q", feedID)
+		}
+		return &model.FeedStatus{}
+	}
+
+	return status
+}
+
+type feedHealth struct {
+	ID          string                      `json:"id"`
+	LastSuccess *time.Time                  `json:"last_success,omitempty"`
+	LastError   string                      `json:"last_error,omitempty"`
+	Episodes    map[model.EpisodeStatus]int `json:"episodes"`
+	Paused      bool                        `json:"paused,omitempty"`
+	Healthy     bool                        `json:"healthy"`
+}
+
+type healthReport struct {
+	Healthy bool         `json:"healthy"`
+	Feeds   []feedHealth `json:"feeds"`
+}
+
+// isHealthy returns false if the feed missed two scheduled updates since the given time
+func isHealthy(feedConfig *config.Feed, since time.Time) bool {
+	schedule, err := feedConfig.Schedule()
+	if err != nil {
+		return time.Since(since) <= 2*feedConfig.UpdatePeriod.Duration
+	}
+
+	return !time.Now().After(schedule.Next(schedule.Next(since)))
+}
+
+// report builds the health report. A feed is unhealthy if it hasn't been updated successfully
+// within two scheduled updates, counted from the start of the process at the earliest, as feeds
+// aren't updated while it's down.
+func (h *healthStatus) report(ctx context.Context, cfg *config.Config, database db.Storage) healthReport {
+	report := healthReport{Healthy: true}
+
+	for _, feedConfig := range cfg.FeedList() {
+		var (
+			status = lastStatus(ctx, database, feedConfig.ID)
+			item   = feedHealth{ID: feedConfig.ID, Episodes: map[model.EpisodeStatus]int{}}
+			since  = h.started
+		)
+
+		if !status.LastSuccess.IsZero() {
+			item.LastSuccess = &status.LastSuccess
+			if status.LastSuccess.After(since) {
+				since = status.LastSuccess
+			}
+		}
+
+		// The last error is kept after a successful update, report it only while updates keep failing
+		if status.Failures > 0 {
+			item.LastError = status.LastError
+		}
+
+		// Paused feeds aren't expected to be updated
+		item.Paused = feedConfig.Paused
+		item.Healthy = feedConfig.Paused || isHealthy(feedConfig, since)
+		if !item.Healthy {
+			report.Healthy = false
+		}
+
+		if err := database.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+			item.Episodes[episode.Status]++
+			return nil
+		}); err != nil {
+			log.WithError(err).Warnf("failed to count episodes of %q", feedConfig.ID)
+		}
+
+		report.Feeds = append(report.Feeds, item)
+	}
+
+	return report
+}
+
+// healthHandler serves the health report as JSON, responds with 503 if any of the feeds is unhealthy.
+// When auth is configured, unauthorized clients (e.g. container health checks) get the status code only,
+// as the report lists feed IDs and error messages.
+func healthHandler(cfg *config.Config, database db.Storage, status *healthStatus) http.Handler {
+	protected := cfg.Server.Username != "" || cfg.Server.AuthToken != ""
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := status.report(r.Context(), cfg, database)
+
+		code := http.StatusOK
+		if !report.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+
+		if protected && !authorized(&cfg.Server, r) {
+			w.WriteHeader(code)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.WithError(err).Error("failed to write health report")
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// saveStatus records the outcome of a feed update like the updater does
+func saveStatus(t *testing.T, env *testEnv, feedID string, err error) {
+	t.Helper()
+
+	require.NoError(t, env.db.UpdateFeedStatus(feedID, func(status *model.FeedStatus) error {
+		if err != nil {
+			status.LastError = err.Error()
+			status.LastErrorAt = time.Now()
+			status.Failures++
+		} else {
+			status.LastSuccess = time.Now()
+			status.Failures = 0
+		}
+		return nil
+	}))
+}
+
+func TestHealthHandler(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	feedA := testFeed("a")
+	feedA.UpdatePeriod = config.Duration{Duration: time.Hour}
+	feedB := testFeed("b")
+	feedB.UpdatePeriod = config.Duration{Duration: time.Hour}
+
+	cfg := &config.Config{Feeds: map[string]*config.Feed{"a": feedA, "b": feedB}}
+
+	addEpisode(t, env, "a", &model.Episode{ID: "1", Status: model.EpisodeDownloaded, PubDate: time.Now()})
+	addEpisode(t, env, "a", &model.Episode{ID: "2", Status: model.EpisodeError, PubDate: time.Now()})
+
+	saveStatus(t, env, "a", nil)
+	saveStatus(t, env, "b", errors.New("quota exceeded"))
+
+	status := newHealthStatus()
+
+	handler := healthHandler(cfg, env.db, status)
+
+	get := func() (int, healthReport) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		var report healthReport
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+		return recorder.Code, report
+	}
+
+	// Feed "b" failed, but it's still within its update period
+	code, report := get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Healthy)
+	require.Len(t, report.Feeds, 2)
+
+	assert.Equal(t, "a", report.Feeds[0].ID)
+	assert.NotNil(t, report.Feeds[0].LastSuccess)
+	assert.Empty(t, report.Feeds[0].LastError)
+	assert.Equal(t, map[model.EpisodeStatus]int{model.EpisodeDownloaded: 1, model.EpisodeError: 1}, report.Feeds[0].Episodes)
+
+	assert.Equal(t, "b", report.Feeds[1].ID)
+	assert.Nil(t, report.Feeds[1].LastSuccess)
+	assert.Equal(t, "quota exceeded", report.Feeds[1].LastError)
+
+	// No successful updates of "b" for more than 2 update periods
+	status.started = time.Now().Add(-3 * time.Hour)
+
+	code, report = get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Healthy)
+	assert.True(t, report.Feeds[0].Healthy)
+	assert.False(t, report.Feeds[1].Healthy)
+
+	// Paused feeds aren't updated, so they are always healthy
+	feedB.Paused = true
+
+	code, report = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Feeds[1].Paused)
+	assert.True(t, report.Feeds[1].Healthy)
+}
+
+func TestHealthHandler_Auth(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	feed := testFeed("a")
+	feed.UpdatePeriod = config.Duration{Duration: time.Hour}
+
+	cfg := &config.Config{
+		Server: config.Server{AuthToken: "secret"},
+		Feeds:  map[string]*config.Feed{"a": feed},
+	}
+
+	saveStatus(t, env, "a", errors.New("quota exceeded"))
+
+	status := newHealthStatus()
+	status.started = time.Now().Add(-3 * time.Hour)
+
+	handler := healthHandler(cfg, env.db, status)
+
+	// Health checks still see the status, but not feed IDs or errors
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+
+	request := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	var report healthReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Len(t, report.Feeds, 1)
+	assert.Equal(t, "quota exceeded", report.Feeds[0].LastError)
+}
+
+func TestHealthHandler_Restart(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	feed := testFeed("a")
+	feed.UpdatePeriod = config.Duration{Duration: time.Hour}
+	cfg := &config.Config{Feeds: map[string]*config.Feed{"a": feed}}
+
+	// Saved before the restart: the feed recovered, but it's been down for a while
+	lastSuccess := time.Now().Add(-5 * time.Hour)
+	require.NoError(t, env.db.UpdateFeedStatus("a", func(status *model.FeedStatus) error {
+		status.LastSuccess = lastSuccess
+		status.LastError = "quota exceeded"
+		status.LastErrorAt = lastSuccess.Add(-time.Hour)
+		return nil
+	}))
+
+	recorder := httptest.NewRecorder()
+	healthHandler(cfg, env.db, newHealthStatus()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	// The feed gets two update periods after the start, like /api/feeds/a it reports the saved success
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var report healthReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	require.Len(t, report.Feeds, 1)
+	require.NotNil(t, report.Feeds[0].LastSuccess)
+	assert.True(t, lastSuccess.Equal(*report.Feeds[0].LastSuccess))
+	assert.Empty(t, report.Feeds[0].LastError)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Podsync feeds</title>
+	<style>
+		body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+		li { display: flex; align-items: center; margin-bottom: 1em; }
+		img { width: 64px; height: 64px; object-fit: cover; margin-right: 1em; }
+	</style>
+</head>
+<body>
+	<h1>Podsync feeds</h1>
+	<ul style="list-style: none; padding: 0">
+	{{- range .}}
+		<li>
+			{{if .CoverArt}}<img src="{{.CoverArt}}" alt="">{{end}}
+			<div>
+				<strong>{{.Title}}</strong> ({{.Episodes}} episodes)<br>
+				{{if .XMLURL}}<a href="{{.XMLURL}}">RSS</a> | <a href="{{.SubscribeURL}}">Add to podcast app</a>{{else}}Not generated yet{{end}}
+			</div>
+		</li>
+	{{- end}}
+	</ul>
+</body>
+</html>
+`))
+
+type indexFeed struct {
+	ID           string
+	Title        string
+	CoverArt     string
+	Episodes     int
+	XMLURL       string
+	SubscribeURL template.URL
+}
+
+// indexFeeds collects the information about configured feeds to be listed on the index page
+func indexFeeds(ctx context.Context, cfg *config.Config, database db.Storage, storage fs.Storage) []indexFeed {
+	var feeds []indexFeed
+
+	for _, feedConfig := range cfg.FeedList() {
+		item := indexFeed{ID: feedConfig.ID, Title: feedConfig.ID, CoverArt: feedConfig.Custom.CoverArt}
+
+		if result, err := database.GetFeed(ctx, feedConfig.ID); err == nil {
+			if result.Title != "" {
+				item.Title = result.Title
+			}
+
+			if item.CoverArt == "" {
+				item.CoverArt = result.CoverArt
+			}
+
+			for _, episode := range result.Episodes {
+				if episode.Status == model.EpisodeDownloaded {
+					item.Episodes++
+				}
+			}
+		} else {
+			log.WithError(err).Debugf("feed %q is not in database yet", feedConfig.ID)
+		}
+
+		// XML is missing until the first update completes
+		if xmlURL, err := storage.URL(ctx, "", fmt.Sprintf("%s.xml", feedConfig.ID)); err == nil {
+			item.XMLURL = xmlURL
+			item.SubscribeURL = subscribeURL(xmlURL)
+		}
+
+		feeds = append(feeds, item)
+	}
+
+	return feeds
+}
+
+// subscribeURL returns a podcast:// link, which opens the feed in a podcast app
+func subscribeURL(xmlURL string) template.URL {
+	link := xmlURL
+	for _, scheme := range []string{"https://", "http://"} {
+		if strings.HasPrefix(link, scheme) {
+			link = strings.TrimPrefix(link, scheme)
+			break
+		}
+	}
+
+	return template.URL("podcast://" + link)
+}
+
+// indexHandler serves the list of feeds at the root, everything else is passed to the next handler
+func indexHandler(cfg *config.Config, database db.Storage, storage fs.Storage, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := indexTemplate.Execute(w, indexFeeds(r.Context(), cfg, database, storage)); err != nil {
+			log.WithError(err).Error("failed to render index page")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestIndexHandler(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	feedA := testFeed("a")
+	feedA.Custom.CoverArt = "http://img/<a>.png"
+	feedB := testFeed("b")
+	cfg := &config.Config{Feeds: map[string]*config.Feed{"a": feedA, "b": feedB}}
+
+	require.NoError(t, env.db.AddFeed(testCtx, "a", &model.Feed{
+		ID:    "a",
+		Title: "Feed <A>",
+		Episodes: []*model.Episode{
+			{ID: "1", Status: model.EpisodeDownloaded, PubDate: time.Now()},
+			{ID: "2", Status: model.EpisodeNew, PubDate: time.Now()},
+		},
+	}))
+
+	_, err := env.fs.Create(testCtx, "", "a.xml", http.NoBody)
+	require.NoError(t, err)
+
+	var nextCalled bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+	})
+
+	handler := indexHandler(cfg, env.db, env.fs, next)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, nextCalled)
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, "<strong>Feed &lt;A&gt;</strong> (1 episodes)")
+	assert.Contains(t, body, `<img src="http://img/%3ca%3e.png"`)
+	assert.Contains(t, body, `<a href="http://localhost/a.xml">RSS</a>`)
+	assert.Contains(t, body, `<a href="podcast://localhost/a.xml">Add to podcast app</a>`)
+	assert.Contains(t, body, "<strong>b</strong> (0 episodes)")
+	assert.Contains(t, body, "Not generated yet")
+
+	// Files are still served
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a.xml", nil))
+	assert.True(t, nextCalled)
+}
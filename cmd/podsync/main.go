@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,6 +9,7 @@ import (
 	"time"
 
 	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
 	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
@@ -17,6 +17,8 @@ import (
 	"github.com/mxpv/podsync/pkg/config"
 	"github.com/mxpv/podsync/pkg/db"
 	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/updater"
 	"github.com/mxpv/podsync/pkg/ytdl"
 
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -26,6 +28,7 @@ type Opts struct {
 	ConfigPath string `long:"config" short:"c" default:"config.toml" env:"PODSYNC_CONFIG_PATH"`
 	Debug      bool   `long:"debug"`
 	NoBanner   bool   `long:"no-banner"`
+	DryRun     bool   `long:"dry-run" description:"Log what would be downloaded or deleted without changing anything"`
 }
 
 const banner = `
@@ -54,15 +57,57 @@ func main() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	group, ctx := errgroup.WithContext(ctx)
 
 	// Parse args
-	opts := Opts{}
-	_, err := flags.Parse(&opts)
+	var (
+		opts           = Opts{}
+		redownloadOpts = RedownloadCommand{}
+		exportOpts     = ExportCommand{}
+		importOpts     = ImportCommand{}
+		fsckOpts       = FsckCommand{}
+		parser         = flags.NewParser(&opts, flags.Default)
+	)
+
+	parser.SubcommandsOptional = true
+	if _, err := parser.AddCommand("redownload", "Download an episode again",
+		"Resets a cleaned or failed episode, so it's downloaded during the next update. Podsync must not be running.",
+		&redownloadOpts); err != nil {
+		log.WithError(err).Fatal("failed to add redownload command")
+	}
+
+	dbCommand, err := parser.AddCommand("db", "Database maintenance",
+		"Exports or imports feeds and episodes as JSON, which is portable unlike database files. Podsync must not be running.",
+		&struct{}{})
+	if err != nil {
+		log.WithError(err).Fatal("failed to add db command")
+	}
+	if _, err := dbCommand.AddCommand("export", "Export database", "Writes all feeds and episodes to a backup file.", &exportOpts); err != nil {
+		log.WithError(err).Fatal("failed to add db export command")
+	}
+	if _, err := dbCommand.AddCommand("import", "Import database",
+		"Restores feeds and episodes from a backup file, episodes already in the database are kept.", &importOpts); err != nil {
+		log.WithError(err).Fatal("failed to add db import command")
+	}
+
+	if _, err := parser.AddCommand("fsck", "Check storage",
+		"Reports files which don't belong to any episode (deleted with --prune) and resets downloaded episodes "+
+			"with missing files, so they are downloaded again. Podsync must not be running.",
+		&fsckOpts); err != nil {
+		log.WithError(err).Fatal("failed to add fsck command")
+	}
+
+	_, err = parser.Parse()
 	if err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
 		log.WithError(err).Fatal("failed to parse command line arguments")
 	}
 
@@ -81,6 +126,10 @@ func main() {
 		log.WithError(err).Fatal("failed to load configuration file")
 	}
 
+	if cfg.Log.Format == "json" {
+		log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339})
+	}
+
 	if cfg.Log.Filename != "" {
 		log.SetOutput(&lumberjack.Logger{
 			Filename:   cfg.Log.Filename,
@@ -97,45 +146,130 @@ func main() {
 		"date":    date,
 	}).Info("running podsync")
 
-	downloader, err := ytdl.New(ctx, cfg.Downloader.SelfUpdate)
+	if parser.Active != nil && parser.Active.Name == "db" {
+		database, err := db.NewBadger(&cfg.Database)
+		if err != nil {
+			log.WithError(err).Fatal("failed to open database")
+		}
+
+		if parser.Active.Active.Name == "export" {
+			err = exportBackup(ctx, database, exportOpts.Out)
+		} else {
+			err = importBackup(ctx, database, importOpts.In, cfg.Feeds)
+		}
+		if closeErr := database.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("failed to close database")
+		}
+		if err != nil {
+			log.WithError(err).Fatalf("database %s failed", parser.Active.Active.Name)
+		}
+
+		return
+	}
+
+	if parser.Active != nil && parser.Active.Name == "fsck" {
+		storage, err := openStorage(cfg)
+		if err != nil {
+			log.WithError(err).Fatal("failed to open storage")
+		}
+
+		database, err := db.NewBadger(&cfg.Database)
+		if err != nil {
+			log.WithError(err).Fatal("failed to open database")
+		}
+
+		_, err = fsck(ctx, database, storage, cfg.Feeds, fsckOpts.Prune)
+		if closeErr := database.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("failed to close database")
+		}
+		if err != nil {
+			log.WithError(err).Fatal("fsck failed")
+		}
+
+		return
+	}
+
+	if parser.Active != nil && parser.Active.Name == "redownload" {
+		if _, ok := cfg.Feeds[redownloadOpts.Feed]; !ok {
+			log.Fatalf("feed %q is not found in configuration", redownloadOpts.Feed)
+		}
+
+		database, err := db.NewBadger(&cfg.Database)
+		if err != nil {
+			log.WithError(err).Fatal("failed to open database")
+		}
+
+		// The downloader is only needed to query metadata of cleaned episodes
+		provider := &lazyMetadata{create: func() (metadataProvider, error) {
+			downloader, err := ytdl.New(ctx, cfg.Downloader, cfg.FFmpeg, cfg.Network)
+			if err != nil {
+				return nil, errors.Wrap(err, "downloader check failed, make sure yt-dlp or youtube-dl is installed")
+			}
+			return downloader, nil
+		}}
+
+		err = redownload(ctx, database, provider, redownloadOpts.Feed, redownloadOpts.Episode)
+		if closeErr := database.Close(); closeErr != nil {
+			log.WithError(closeErr).Error("failed to close database")
+		}
+		if err != nil {
+			log.WithError(err).Fatal("redownload failed")
+		}
+
+		return
+	}
+
+	downloader, err := ytdl.New(ctx, cfg.Downloader, cfg.FFmpeg, cfg.Network)
 	if err != nil {
-		log.WithError(err).Fatal("youtube-dl error")
+		log.WithError(err).Fatal("downloader check failed, make sure yt-dlp or youtube-dl is installed")
 	}
 
+	progress := ytdl.NewProgressRegistry()
+	downloader.SetProgressSink(progress)
+
 	database, err := db.NewBadger(&cfg.Database)
 	if err != nil {
 		log.WithError(err).Fatal("failed to open database")
 	}
 
-	storage, err := fs.NewLocal(cfg.Server.DataDir, cfg.Server.Hostname)
+	storage, err := openStorage(cfg)
 	if err != nil {
 		log.WithError(err).Fatal("failed to open storage")
 	}
 
+	health := newHealthStatus()
+
 	// Run updater thread
 	log.Debug("creating updater")
-	updater, err := NewUpdater(cfg, downloader, database, storage)
+	feedUpdater, err := updater.New(cfg, downloader, database, storage, opts.DryRun)
 	if err != nil {
 		log.WithError(err).Fatal("failed to create updater")
 	}
 
+	// Cover arts are only checked for warnings, so don't delay updates
+	group.Go(func() error {
+		feedUpdater.CheckCoverArts(ctx)
+		return nil
+	})
+
 	// Queue of feeds to update
 	updates := make(chan *config.Feed, 16)
 	defer close(updates)
 
 	// Create Cron
 	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(nil)))
-	m := make(map[string]cron.EntryID)
+	sched := newScheduler(c, cfg, updates)
 
 	// Run updates listener
 	group.Go(func() error {
 		for {
 			select {
 			case feed := <-updates:
-				if err := updater.Update(ctx, feed); err != nil {
+				err := feedUpdater.Update(ctx, feed)
+				if err != nil {
 					log.WithError(err).Errorf("failed to update feed: %s", feed.URL)
 				} else {
-					log.Infof("next update of %s: %s", feed.ID, c.Entry(m[feed.ID]).Next)
+					log.Infof("next update of %s: %s", feed.ID, sched.next(feed.ID))
 				}
 			case <-ctx.Done():
 				return ctx.Err()
@@ -145,42 +279,53 @@ func main() {
 
 	// Run cron scheduler
 	group.Go(func() error {
-		var cronID cron.EntryID
-
-		for _, feed := range cfg.Feeds {
-			if feed.CronSchedule == "" {
-				feed.CronSchedule = fmt.Sprintf("@every %s", feed.UpdatePeriod.String())
-			}
-			_feed := feed
-			if cronID, err = c.AddFunc(_feed.CronSchedule, func() {
-				log.Debugf("adding %q to update queue", _feed.ID)
-				updates <- _feed
-			}); err != nil {
-				log.WithError(err).Fatalf("can't create cron task for feed: %s", _feed.ID)
+		queue := func(feeds []*config.Feed) {
+			for _, feed := range feeds {
+				select {
+				case updates <- feed:
+				case <-ctx.Done():
+					return
+				}
 			}
-
-			m[_feed.ID] = cronID
-			log.Debugf("-> %s (update '%s')", _feed.ID, _feed.CronSchedule)
-			// Perform initial update after CLI restart
-			updates <- _feed
 		}
 
+		// Perform initial update after CLI restart
+		queue(sched.sync())
+
 		c.Start()
 
 		for {
-			<-ctx.Done()
+			select {
+			case <-reload:
+				// Only feeds are reloaded, other sections are used to set up long living objects (storage, server, etc)
+				log.Infof("reloading configuration %q", opts.ConfigPath)
+				updated, err := config.LoadConfig(opts.ConfigPath)
+				if err != nil {
+					log.WithError(err).Error("failed to reload configuration, keeping the current one")
+					continue
+				}
 
-			log.Info("shutting down cron")
-			c.Stop()
+				cfg.ReloadFeeds(updated)
+				queue(sched.sync())
+				log.Infof("reloaded %d feed(s), changes outside of feeds require a restart", len(updated.Feeds))
+			case <-ctx.Done():
+				log.Info("shutting down cron")
+				c.Stop()
 
-			return ctx.Err()
+				return ctx.Err()
+			}
 		}
 	})
 
 	// Run web server
-	srv := NewServer(cfg)
+	srv := NewServer(cfg, database, storage, health, progress)
 
 	group.Go(func() error {
+		if cfg.Server.TLSCert != "" {
+			log.Infof("running TLS listener at %s", srv.Addr)
+			return srv.ListenAndServeTLS(cfg.Server.TLSCert, cfg.Server.TLSKey)
+		}
+
 		log.Infof("running listener at %s", srv.Addr)
 		return srv.ListenAndServe()
 	})
@@ -189,7 +334,8 @@ func main() {
 		// Shutdown web server
 		defer func() {
 			log.Info("shutting down web server")
-			if err := srv.Shutdown(ctx); err != nil {
+			// ctx is already cancelled at this point, the overall shutdown is limited by the shutdown timeout
+			if err := srv.Shutdown(context.Background()); err != nil {
 				log.WithError(err).Error("server shutdown failed")
 			}
 		}()
@@ -199,7 +345,15 @@ func main() {
 			case <-ctx.Done():
 				return ctx.Err()
 			case <-stop:
+				// Running downloads are interrupted, but copies to storage are allowed to complete
+				timeout := cfg.Downloader.ShutdownTimeout.Duration
+				log.Infof("shutting down, waiting up to %s for running updates to stop", timeout)
 				cancel()
+
+				time.AfterFunc(timeout, func() {
+					log.Error("shutdown timed out, exiting")
+					os.Exit(1)
+				})
 				return nil
 			}
 		}
@@ -215,3 +369,13 @@ func main() {
 
 	log.Info("gracefully stopped")
 }
+
+// openStorage creates the configured storage of feeds and episodes
+func openStorage(cfg *config.Config) (fs.Storage, error) {
+	if cfg.Storage.Type == model.StorageS3 {
+		log.Infof("using s3 bucket %q", cfg.Storage.S3.Bucket)
+		return fs.NewS3(&cfg.Storage.S3)
+	}
+
+	return fs.NewLocal(cfg.Server.DataDir, cfg.Server.Hostname)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+var testCtx = context.Background()
+
+type testEnv struct {
+	db *db.Badger
+	fs *fs.Local
+}
+
+// setupStorage creates a database and local storage in a temporary directory
+func setupStorage(t *testing.T) (*testEnv, func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "podsync-cmd-")
+	require.NoError(t, err)
+
+	dataDir := filepath.Join(root, "data")
+	require.NoError(t, os.MkdirAll(dataDir, 0755))
+
+	database, err := db.NewBadger(&config.Database{Dir: filepath.Join(root, "db")})
+	require.NoError(t, err)
+
+	storage, err := fs.NewLocal(dataDir, "localhost")
+	require.NoError(t, err)
+
+	return &testEnv{db: database, fs: storage}, func() {
+		database.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func testFeed(id string) *config.Feed {
+	return &config.Feed{
+		ID:          id,
+		URL:         "https://youtube.com/channel/test",
+		Format:      model.FormatAudio,
+		PageSize:    10,
+		Concurrency: 1,
+	}
+}
+
+func addEpisode(t *testing.T, env *testEnv, feedID string, episode *model.Episode) {
+	t.Helper()
+
+	err := env.db.AddFeed(testCtx, feedID, &model.Feed{ID: feedID, Episodes: []*model.Episode{episode}})
+	require.NoError(t, err)
+}
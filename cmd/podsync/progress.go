@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+type progressReport struct {
+	FeedID   string             `json:"feed_id"`
+	Episodes map[string]float64 `json:"episodes"` // Download percentage keyed by episode ID
+}
+
+// progressEndpoint serves download progress of a feed at /api/feeds/{id}/progress
+func progressEndpoint(registry *ytdl.ProgressRegistry) feedEndpoint {
+	return func(w http.ResponseWriter, r *http.Request, feedConfig *config.Feed) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(progressReport{FeedID: feedConfig.ID, Episodes: registry.Get(feedConfig.ID)}); err != nil {
+			log.WithError(err).Error("failed to write progress report")
+		}
+	}
+}
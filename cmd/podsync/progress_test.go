@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+func TestProgressHandler(t *testing.T) {
+	cfg := &config.Config{Feeds: map[string]*config.Feed{"a": testFeed("a")}}
+
+	registry := ytdl.NewProgressRegistry()
+	registry.Progress("a", "episode", 42.5)
+
+	handler := feedAPIHandler(cfg, map[string]feedEndpoint{"progress": progressEndpoint(registry)})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/feeds/a/progress", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var report progressReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, progressReport{FeedID: "a", Episodes: map[string]float64{"episode": 42.5}}, report)
+
+	for _, path := range []string{"/api/feeds/unknown/progress", "/api/feeds/a", "/api/feeds/a/other"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code, path)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+// RedownloadCommand resets an episode, so it's downloaded again during the next update
+type RedownloadCommand struct {
+	Feed    string `long:"feed" required:"true" description:"Feed ID from the configuration file"`
+	Episode string `long:"episode" required:"true" description:"Episode ID (e.g. YouTube video ID)"`
+}
+
+type metadataProvider interface {
+	Metadata(ctx context.Context, videoURL string) (*ytdl.Metadata, error)
+}
+
+// lazyMetadata creates the provider on first use, as creating the downloader might update it
+type lazyMetadata struct {
+	create   func() (metadataProvider, error)
+	provider metadataProvider
+}
+
+func (l *lazyMetadata) Metadata(ctx context.Context, videoURL string) (*ytdl.Metadata, error) {
+	if l.provider == nil {
+		provider, err := l.create()
+		if err != nil {
+			return nil, err
+		}
+		l.provider = provider
+	}
+
+	return l.provider.Metadata(ctx, videoURL)
+}
+
+// redownload marks the episode as new. Title and description of cleaned episodes are wiped,
+// so they are queried again.
+func redownload(ctx context.Context, database db.Storage, provider metadataProvider, feedID, episodeID string) error {
+	episode, err := database.GetEpisode(ctx, feedID, episodeID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find episode %q of feed %q", episodeID, feedID)
+	}
+
+	title, description := episode.Title, episode.Description
+	if episode.Status == model.EpisodeCleaned || title == "" {
+		log.Infof("querying metadata of %s", episode.VideoURL)
+
+		metadata, err := provider.Metadata(ctx, episode.VideoURL)
+		if err == ytdl.ErrUnavailable {
+			return errors.Errorf("episode %q is no longer available at %s", episodeID, episode.VideoURL)
+		} else if err != nil {
+			return errors.Wrap(err, "failed to query episode metadata")
+		}
+
+		title, description = metadata.Title, metadata.Description
+	}
+
+	if err := database.UpdateEpisode(feedID, episodeID, func(episode *model.Episode) error {
+		episode.Status = model.EpisodeNew
+		episode.Redownload = true
+		episode.Title = title
+		episode.Description = description
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to reset episode")
+	}
+
+	log.Infof("episode %q of feed %q will be downloaded during the next update", episodeID, feedID)
+	return nil
+}
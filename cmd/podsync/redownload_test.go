@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+type fakeMetadata struct {
+	metadata *ytdl.Metadata
+	err      error
+	calls    int
+}
+
+func (f *fakeMetadata) Metadata(_ context.Context, _ string) (*ytdl.Metadata, error) {
+	f.calls++
+	return f.metadata, f.err
+}
+
+func TestRedownload(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	addEpisode(t, env, "1", &model.Episode{ID: "failed", Title: "Failed", Status: model.EpisodeError, PubDate: time.Now()})
+	addEpisode(t, env, "1", &model.Episode{ID: "cleaned", Status: model.EpisodeCleaned, PubDate: time.Now()})
+
+	provider := &fakeMetadata{metadata: &ytdl.Metadata{Title: "Restored", Description: "Description"}}
+	created := 0
+	lazy := &lazyMetadata{create: func() (metadataProvider, error) {
+		created++
+		return provider, nil
+	}}
+
+	// Metadata is kept as is, the downloader isn't even created
+	require.NoError(t, redownload(testCtx, env.db, lazy, "1", "failed"))
+	episode, err := env.db.GetEpisode(testCtx, "1", "failed")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, episode.Status)
+	assert.True(t, episode.Redownload)
+	assert.Equal(t, "Failed", episode.Title)
+	assert.Equal(t, 0, provider.calls)
+	assert.Equal(t, 0, created)
+
+	// Wiped metadata is queried again
+	require.NoError(t, redownload(testCtx, env.db, lazy, "1", "cleaned"))
+	episode, err = env.db.GetEpisode(testCtx, "1", "cleaned")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, episode.Status)
+	assert.True(t, episode.Redownload)
+	assert.Equal(t, "Restored", episode.Title)
+	assert.Equal(t, "Description", episode.Description)
+	assert.Equal(t, 1, provider.calls)
+	assert.Equal(t, 1, created)
+}
+
+func TestRedownload_Unavailable(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	addEpisode(t, env, "1", &model.Episode{ID: "cleaned", Status: model.EpisodeCleaned, PubDate: time.Now()})
+
+	err := redownload(testCtx, env.db, &fakeMetadata{err: ytdl.ErrUnavailable}, "1", "cleaned")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no longer available")
+
+	// Episode is left untouched
+	episode, err := env.db.GetEpisode(testCtx, "1", "cleaned")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeCleaned, episode.Status)
+
+	err = redownload(testCtx, env.db, &fakeMetadata{}, "1", "missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+// scheduler queues feed updates according to their schedules
+type scheduler struct {
+	cron    *cron.Cron
+	config  *config.Config
+	updates chan<- *config.Feed
+
+	lock      sync.Mutex
+	entries   map[string]cron.EntryID
+	scheduled map[string]*config.Feed // Feed configurations the entries were created with
+}
+
+func newScheduler(c *cron.Cron, cfg *config.Config, updates chan<- *config.Feed) *scheduler {
+	return &scheduler{
+		cron:      c,
+		config:    cfg,
+		updates:   updates,
+		entries:   map[string]cron.EntryID{},
+		scheduled: map[string]*config.Feed{},
+	}
+}
+
+// sync brings the schedule in line with the configured feeds (after start or reload): new feeds are
+// scheduled, feeds with changed schedule are rescheduled, removed and paused feeds are unscheduled.
+// Returns new feeds, which should be updated right away.
+func (s *scheduler) sync() []*config.Feed {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		added  []*config.Feed
+		active = map[string]struct{}{}
+	)
+
+	for _, feed := range s.config.FeedList() {
+		if feed.Paused {
+			log.Infof("feed %q is paused, skipping updates", feed.ID)
+			continue
+		}
+
+		active[feed.ID] = struct{}{}
+
+		if old, ok := s.scheduled[feed.ID]; ok {
+			if old.CronSchedule == feed.CronSchedule && old.UpdatePeriod == feed.UpdatePeriod {
+				continue
+			}
+
+			log.Infof("schedule of feed %q has changed", feed.ID)
+			s.cron.Remove(s.entries[feed.ID])
+		} else {
+			added = append(added, feed)
+		}
+
+		// Validated when loading configuration
+		schedule, err := feed.Schedule()
+		if err != nil {
+			log.WithError(err).Errorf("can't create cron task for feed: %s", feed.ID)
+			continue
+		}
+
+		if jitter := s.config.Downloader.UpdateJitter.Duration; jitter > 0 {
+			schedule = newJitterSchedule(schedule, jitter)
+		}
+
+		id := feed.ID
+		s.entries[id] = s.cron.Schedule(schedule, cron.FuncJob(func() {
+			// Configuration might have been reloaded since the feed was scheduled
+			if feed, ok := s.config.Feed(id); ok {
+				log.Debugf("adding %q to update queue", id)
+				s.updates <- feed
+			}
+		}))
+		s.scheduled[id] = feed
+
+		if feed.CronSchedule != "" {
+			log.Debugf("-> %s (update '%s')", id, feed.CronSchedule)
+		} else {
+			log.Debugf("-> %s (update every %s)", id, feed.UpdatePeriod.String())
+		}
+	}
+
+	for id, entry := range s.entries {
+		if _, ok := active[id]; !ok {
+			log.Infof("feed %q is not updated anymore", id)
+			s.cron.Remove(entry)
+			delete(s.entries, id)
+			delete(s.scheduled, id)
+		}
+	}
+
+	return added
+}
+
+// next returns the time of the next scheduled update of the feed
+func (s *scheduler) next(feedID string) time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[feedID]
+	if !ok {
+		return time.Time{}
+	}
+
+	return s.cron.Entry(entry).Next
+}
+
+// jitterSchedule delays activations of the underlying schedule by a random duration, picked anew each time
+type jitterSchedule struct {
+	schedule cron.Schedule
+	jitter   time.Duration
+	offset   time.Duration // Delay of the last activation
+}
+
+// newJitterSchedule limits jitter to half of the schedule's period, so updates don't skip a cycle
+func newJitterSchedule(schedule cron.Schedule, jitter time.Duration) *jitterSchedule {
+	var (
+		now    = time.Now()
+		first  = schedule.Next(now)
+		period = schedule.Next(first).Sub(first)
+	)
+
+	if max := period / 2; jitter > max {
+		jitter = max
+	}
+
+	return &jitterSchedule{schedule: schedule, jitter: jitter}
+}
+
+// Next is called by cron at activation time, so the last delay is removed first to not let it accumulate
+func (s *jitterSchedule) Next(t time.Time) time.Time {
+	next := s.schedule.Next(t.Add(-s.offset))
+
+	s.offset = 0
+	if s.jitter > 0 {
+		s.offset = time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+
+	return next.Add(s.offset)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+func scheduledFeed(id string, period time.Duration) *config.Feed {
+	return &config.Feed{ID: id, UpdatePeriod: config.Duration{Duration: period}}
+}
+
+func TestScheduler_Sync(t *testing.T) {
+	var (
+		updates = make(chan *config.Feed, 16)
+		c       = cron.New()
+		cfg     = &config.Config{Feeds: map[string]*config.Feed{
+			"a": scheduledFeed("a", time.Hour),
+			"b": scheduledFeed("b", time.Hour),
+		}}
+		sched = newScheduler(c, cfg, updates)
+	)
+
+	added := sched.sync()
+	require.Len(t, added, 2)
+	assert.Equal(t, "a", added[0].ID)
+	assert.Equal(t, "b", added[1].ID)
+	assert.Len(t, c.Entries(), 2)
+
+	entryB := sched.entries["b"]
+
+	// "a" is removed, "b" is unchanged, "c" is new and "d" is paused
+	paused := scheduledFeed("d", time.Hour)
+	paused.Paused = true
+	cfg.ReloadFeeds(&config.Config{Feeds: map[string]*config.Feed{
+		"b": scheduledFeed("b", time.Hour),
+		"c": scheduledFeed("c", time.Hour),
+		"d": paused,
+	}})
+
+	added = sched.sync()
+	require.Len(t, added, 1)
+	assert.Equal(t, "c", added[0].ID)
+	assert.Len(t, c.Entries(), 2)
+	assert.Equal(t, entryB, sched.entries["b"])
+	assert.NotContains(t, sched.entries, "a")
+	assert.NotContains(t, sched.entries, "d")
+
+	// Changed schedule is applied without updating the feed right away
+	cfg.ReloadFeeds(&config.Config{Feeds: map[string]*config.Feed{
+		"b": scheduledFeed("b", 2*time.Hour),
+		"c": scheduledFeed("c", time.Hour),
+	}})
+
+	assert.Empty(t, sched.sync())
+	assert.Len(t, c.Entries(), 2)
+	assert.NotEqual(t, entryB, sched.entries["b"])
+}
+
+func TestScheduler_JobUsesReloadedConfig(t *testing.T) {
+	var (
+		updates = make(chan *config.Feed, 1)
+		c       = cron.New()
+		cfg     = &config.Config{Feeds: map[string]*config.Feed{"a": scheduledFeed("a", time.Hour)}}
+		sched   = newScheduler(c, cfg, updates)
+	)
+
+	sched.sync()
+
+	// Filters, cleanup policy, etc. are changed without rescheduling
+	reloaded := scheduledFeed("a", time.Hour)
+	reloaded.PageSize = 10
+	cfg.ReloadFeeds(&config.Config{Feeds: map[string]*config.Feed{"a": reloaded}})
+	assert.Empty(t, sched.sync())
+
+	c.Entry(sched.entries["a"]).Job.Run()
+	assert.Same(t, reloaded, <-updates)
+}
+
+func TestJitterSchedule(t *testing.T) {
+	var (
+		schedule = newJitterSchedule(cron.Every(time.Hour), 10*time.Minute)
+		base     = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		now      = base
+		offsets  = map[time.Duration]bool{}
+	)
+
+	// Cron asks for the next activation at the time of the previous one
+	for i := 0; i < 100; i++ {
+		now = schedule.Next(now)
+		base = base.Add(time.Hour)
+
+		offset := now.Sub(base)
+		assert.True(t, offset >= 0 && offset < 10*time.Minute, "offset %s", offset)
+		offsets[offset] = true
+	}
+
+	// Randomized each time
+	assert.True(t, len(offsets) > 1)
+}
+
+func TestJitterSchedule_Limit(t *testing.T) {
+	assert.Equal(t, 30*time.Minute, newJitterSchedule(cron.Every(time.Hour), 2*time.Hour).jitter)
+	assert.Equal(t, 10*time.Minute, newJitterSchedule(cron.Every(time.Hour), 10*time.Minute).jitter)
+
+	daily, err := cron.ParseStandard("0 3 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, newJitterSchedule(daily, 24*time.Hour).jitter)
+}
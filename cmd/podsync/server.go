@@ -1,31 +1,76 @@
 package main
 
 import (
-	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/metrics"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/ytdl"
 )
 
 type Server struct {
 	http.Server
 }
 
-func NewServer(cfg *config.Config) *Server {
-	port := cfg.Server.Port
+// listenAddress returns the address to listen on, IPv6 addresses are enclosed in brackets
+func listenAddress(cfg *config.Server) string {
+	port := cfg.Port
 	if port == 0 {
 		port = 8080
 	}
 
+	return net.JoinHostPort(strings.Trim(cfg.BindAddress, "[]"), strconv.Itoa(port))
+}
+
+// mediaHandler serves files from the data directory. Range requests are handled by http.FileServer,
+// so players can seek within episodes and interrupted downloads can be resumed.
+func mediaHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Podcast apps rely on content type of episodes, which is not always known to the system mime database
+		if contentType := fs.ContentType(r.URL.Path); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+func NewServer(cfg *config.Config, database db.Storage, storage fs.Storage, health *healthStatus, progress *ytdl.ProgressRegistry) *Server {
 	srv := Server{}
 
-	srv.Addr = fmt.Sprintf(":%d", port)
+	srv.Addr = listenAddress(&cfg.Server)
 	log.Debugf("using address: %s", srv.Addr)
 
-	fs := http.FileServer(http.Dir(cfg.Server.DataDir))
-	http.Handle("/", fs)
+	// Files in object storage are served by the storage itself
+	var root http.Handler = http.NotFoundHandler()
+	if cfg.Storage.Type != model.StorageS3 {
+		root = mediaHandler(cfg.Server.DataDir)
+	}
+	if cfg.Server.Index {
+		log.Debug("serving feeds index at /")
+		root = indexHandler(cfg, database, storage, root)
+	}
+	http.Handle("/", authHandler(&cfg.Server, root))
+	http.Handle("/api/feeds/", authHandler(&cfg.Server, feedAPIHandler(cfg, map[string]feedEndpoint{
+		"":         statusEndpoint(database),
+		"progress": progressEndpoint(progress),
+		"stats":    statsEndpoint(database),
+	})))
+
+	http.Handle("/healthz", healthHandler(cfg, database, health))
+
+	if cfg.Metrics.Enabled {
+		log.Debug("exposing prometheus metrics at /metrics")
+		http.Handle("/metrics", authHandler(&cfg.Server, metrics.Handler()))
+	}
 
 	return &srv
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		cfg    config.Server
+		expect string
+	}{
+		{cfg: config.Server{}, expect: ":8080"},
+		{cfg: config.Server{Port: 80}, expect: ":80"},
+		{cfg: config.Server{BindAddress: "127.0.0.1", Port: 8080}, expect: "127.0.0.1:8080"},
+		{cfg: config.Server{BindAddress: "::1", Port: 8080}, expect: "[::1]:8080"},
+		{cfg: config.Server{BindAddress: "[::]"}, expect: "[::]:8080"},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.expect, func(t *testing.T) {
+			assert.Equal(t, tst.expect, listenAddress(&tst.cfg))
+		})
+	}
+}
+
+func TestMediaHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-media-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "feed"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "feed", "1.opus"), data, 0644))
+
+	handler := mediaHandler(dir)
+
+	req := httptest.NewRequest(http.MethodGet, "/feed/1.opus", nil)
+	req.Header.Set("Range", "bytes=100-")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "audio/ogg", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "bytes 100-999/1000", rec.Header().Get("Content-Range"))
+	assert.Equal(t, data[100:], rec.Body.Bytes())
+
+	// Full requests advertise range support
+	req = httptest.NewRequest(http.MethodGet, "/feed/1.opus", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	assert.Len(t, rec.Body.Bytes(), len(data))
+
+	req = httptest.NewRequest(http.MethodGet, "/feed/missing.mp3", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+type feedStats struct {
+	FeedID      string                      `json:"feed_id"`
+	Episodes    int                         `json:"episodes"`
+	Statuses    map[model.EpisodeStatus]int `json:"statuses"`
+	Size        int64                       `json:"size"` // Bytes taken by downloaded episodes
+	Newest      *time.Time                  `json:"newest,omitempty"`
+	Oldest      *time.Time                  `json:"oldest,omitempty"`
+	LastUpdate  *time.Time                  `json:"last_update,omitempty"`  // Last time the feed was queried
+	LastSuccess *time.Time                  `json:"last_success,omitempty"` // Last successful update
+	LastError   string                      `json:"last_error,omitempty"`
+}
+
+// collectStats aggregates episodes of the feed in database and outcomes of its updates
+func collectStats(feed *model.Feed, status *model.FeedStatus) feedStats {
+	stats := feedStats{
+		FeedID: feed.ID,
+		Statuses: map[model.EpisodeStatus]int{
+			model.EpisodeNew:        0,
+			model.EpisodeDownloaded: 0,
+			model.EpisodeError:      0,
+			model.EpisodeCleaned:    0,
+		},
+	}
+
+	for _, episode := range feed.Episodes {
+		stats.Episodes++
+		stats.Statuses[episode.Status]++
+
+		if episode.Status == model.EpisodeDownloaded {
+			stats.Size += episode.Size
+		}
+
+		pubDate := episode.PubDate
+		if stats.Newest == nil || pubDate.After(*stats.Newest) {
+			stats.Newest = &pubDate
+		}
+		if stats.Oldest == nil || pubDate.Before(*stats.Oldest) {
+			stats.Oldest = &pubDate
+		}
+	}
+
+	if !feed.UpdatedAt.IsZero() {
+		updatedAt := feed.UpdatedAt
+		stats.LastUpdate = &updatedAt
+	}
+
+	if !status.LastSuccess.IsZero() {
+		stats.LastSuccess = &status.LastSuccess
+	}
+
+	if status.Failures > 0 {
+		stats.LastError = status.LastError
+	}
+
+	return stats
+}
+
+// statsEndpoint serves episode statistics of a feed at /api/feeds/{id}/stats
+func statsEndpoint(database db.Storage) feedEndpoint {
+	return func(w http.ResponseWriter, r *http.Request, feedConfig *config.Feed) {
+		feed, err := database.GetFeed(r.Context(), feedConfig.ID)
+		if err == model.ErrNotFound {
+			// Not updated yet
+			feed = &model.Feed{ID: feedConfig.ID}
+		} else if err != nil {
+			log.WithError(err).Errorf("failed to query feed %q", feedConfig.ID)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(collectStats(feed, lastStatus(r.Context(), database, feedConfig.ID))); err != nil {
+			log.WithError(err).Error("failed to write feed stats")
+		}
+	}
+}
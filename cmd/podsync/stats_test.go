@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestStatsEndpoint(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	cfg := &config.Config{Feeds: map[string]*config.Feed{"a": testFeed("a"), "b": testFeed("b")}}
+
+	var (
+		updatedAt = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		newest    = time.Date(2021, 5, 3, 0, 0, 0, 0, time.UTC)
+		oldest    = time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	require.NoError(t, env.db.AddFeed(testCtx, "a", &model.Feed{
+		ID:        "a",
+		UpdatedAt: updatedAt,
+		Episodes: []*model.Episode{
+			{ID: "1", Status: model.EpisodeDownloaded, Size: 100, PubDate: newest},
+			{ID: "2", Status: model.EpisodeDownloaded, Size: 50, PubDate: oldest.Add(time.Hour)},
+			{ID: "3", Status: model.EpisodeError, PubDate: oldest},
+			{ID: "4", Status: model.EpisodeCleaned, Size: 10, PubDate: oldest.Add(2 * time.Hour)},
+		},
+	}))
+
+	saveStatus(t, env, "a", errors.New("quota exceeded"))
+
+	handler := feedAPIHandler(cfg, map[string]feedEndpoint{"stats": statsEndpoint(env.db)})
+
+	get := func(path string) (int, feedStats) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var stats feedStats
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &stats))
+		}
+		return recorder.Code, stats
+	}
+
+	code, stats := get("/api/feeds/a/stats")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 4, stats.Episodes)
+	assert.Equal(t, map[model.EpisodeStatus]int{
+		model.EpisodeNew:        0,
+		model.EpisodeDownloaded: 2,
+		model.EpisodeError:      1,
+		model.EpisodeCleaned:    1,
+	}, stats.Statuses)
+	assert.EqualValues(t, 150, stats.Size)
+	require.NotNil(t, stats.Newest)
+	assert.True(t, newest.Equal(*stats.Newest))
+	require.NotNil(t, stats.Oldest)
+	assert.True(t, oldest.Equal(*stats.Oldest))
+	require.NotNil(t, stats.LastUpdate)
+	assert.True(t, updatedAt.Equal(*stats.LastUpdate))
+	assert.Nil(t, stats.LastSuccess)
+	assert.Equal(t, "quota exceeded", stats.LastError)
+
+	// Configured, but not updated yet
+	code, stats = get("/api/feeds/b/stats")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "b", stats.FeedID)
+	assert.Equal(t, 0, stats.Episodes)
+	assert.Nil(t, stats.LastUpdate)
+
+	code, _ = get("/api/feeds/unknown/stats")
+	assert.Equal(t, http.StatusNotFound, code)
+}
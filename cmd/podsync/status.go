@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+type feedStatus struct {
+	FeedID      string     `json:"feed_id"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Failures    int        `json:"failures"` // Updates failed in a row
+}
+
+// statusEndpoint serves the outcome of the latest feed updates at /api/feeds/{id}, it's kept across restarts
+func statusEndpoint(database db.Storage) feedEndpoint {
+	return func(w http.ResponseWriter, r *http.Request, feedConfig *config.Feed) {
+		stored, err := database.GetFeedStatus(r.Context(), feedConfig.ID)
+		if err == model.ErrNotFound {
+			// Not updated yet
+			stored = &model.FeedStatus{}
+		} else if err != nil {
+			log.WithError(err).Errorf("failed to query status of feed %q", feedConfig.ID)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		status := feedStatus{
+			FeedID:    feedConfig.ID,
+			LastError: stored.LastError,
+			Failures:  stored.Failures,
+		}
+		if !stored.LastSuccess.IsZero() {
+			status.LastSuccess = &stored.LastSuccess
+		}
+		if !stored.LastErrorAt.IsZero() {
+			status.LastErrorAt = &stored.LastErrorAt
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.WithError(err).Error("failed to write feed status")
+		}
+	}
+}
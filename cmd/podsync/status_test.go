@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestStatusEndpoint(t *testing.T) {
+	env, teardown := setupStorage(t)
+	defer teardown()
+
+	cfg := &config.Config{Feeds: map[string]*config.Feed{"a": testFeed("a"), "b": testFeed("b")}}
+
+	failedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, env.db.UpdateFeedStatus("a", func(status *model.FeedStatus) error {
+		status.LastError = "update failed: invalid API key"
+		status.LastErrorAt = failedAt
+		status.Failures = 3
+		return nil
+	}))
+
+	handler := feedAPIHandler(cfg, map[string]feedEndpoint{"": statusEndpoint(env.db)})
+
+	get := func(path string) (int, feedStatus) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var status feedStatus
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+		}
+		return recorder.Code, status
+	}
+
+	for _, path := range []string{"/api/feeds/a", "/api/feeds/a/"} {
+		code, status := get(path)
+		require.Equal(t, http.StatusOK, code, path)
+		assert.Equal(t, "a", status.FeedID)
+		assert.Equal(t, "update failed: invalid API key", status.LastError)
+		require.NotNil(t, status.LastErrorAt)
+		assert.True(t, failedAt.Equal(*status.LastErrorAt))
+		assert.Nil(t, status.LastSuccess)
+		assert.Equal(t, 3, status.Failures)
+	}
+
+	// Configured, but not updated yet
+	code, status := get("/api/feeds/b")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "b", status.FeedID)
+	assert.Empty(t, status.LastError)
+	assert.Nil(t, status.LastErrorAt)
+
+	code, _ = get("/api/feeds/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get("/api/feeds/a/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+}
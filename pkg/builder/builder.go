@@ -2,6 +2,8 @@ package builder
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -13,12 +15,34 @@ type Builder interface {
 	Build(ctx context.Context, cfg *config.Feed) (*model.Feed, error)
 }
 
-func New(ctx context.Context, provider model.Provider, key string) (Builder, error) {
+// IncrementalBuilder is implemented by builders able to query only the episodes
+// published after the given date, which saves API quota on large channels
+type IncrementalBuilder interface {
+	BuildSince(ctx context.Context, cfg *config.Feed, since time.Time) (*model.Feed, error)
+}
+
+// RequiresKey returns true if the provider's API needs a key (see [tokens] config section)
+func RequiresKey(provider model.Provider) bool {
+	switch provider {
+	case model.ProviderYoutube, model.ProviderVimeo:
+		return true
+	default:
+		return false
+	}
+}
+
+// New creates a builder for the provider. API requests are sent via client,
+// downloader and network configuration is used by builders running youtube-dl.
+func New(ctx context.Context, provider model.Provider, key string, client *http.Client, downloader *config.Downloader, network *config.Network) (Builder, error) {
 	switch provider {
 	case model.ProviderYoutube:
-		return NewYouTubeBuilder(key)
+		return NewYouTubeBuilder(key, client)
 	case model.ProviderVimeo:
-		return NewVimeoBuilder(ctx, key)
+		return NewVimeoBuilder(ctx, key, client)
+	case model.ProviderSoundCloud:
+		return NewSoundCloudBuilder(downloader, network)
+	case model.ProviderBitchute, model.ProviderOdysee:
+		return NewYoutubeDLBuilder(downloader, network)
 	default:
 		return nil, errors.Errorf("unsupported provider %q", provider)
 	}
@@ -0,0 +1,135 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+const soundCloudDefaultPageSize = 50
+
+// soundCloudPlaylist is a subset of youtube-dl's JSON output for SoundCloud users and sets
+type soundCloudPlaylist struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Uploader    string            `json:"uploader"`
+	Thumbnail   string            `json:"thumbnail"`
+	WebpageURL  string            `json:"webpage_url"`
+	Entries     []soundCloudTrack `json:"entries"`
+}
+
+type soundCloudTrack struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Duration    float64 `json:"duration"`
+	Timestamp   int64   `json:"timestamp"`
+	Thumbnail   string  `json:"thumbnail"`
+	WebpageURL  string  `json:"webpage_url"`
+}
+
+// SoundCloudBuilder queries SoundCloud via youtube-dl, as SoundCloud doesn't issue public API keys
+type SoundCloudBuilder struct {
+	youtubeDL
+}
+
+func (s *SoundCloudBuilder) Build(ctx context.Context, cfg *config.Feed) (*model.Feed, error) {
+	info, err := ParseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Format != model.FormatAudio {
+		return nil, errors.New("SoundCloud feeds support audio format only")
+	}
+
+	feed := &model.Feed{
+		ItemID:    info.ItemID,
+		Provider:  info.Provider,
+		LinkType:  info.LinkType,
+		Format:    cfg.Format,
+		Quality:   cfg.Quality,
+		PageSize:  cfg.PageSize,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	if feed.PageSize == 0 {
+		feed.PageSize = soundCloudDefaultPageSize
+	}
+
+	output, err := s.queryPlaylist(ctx, cfg.URL, feed.PageSize, cfg.Cookies)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := parseSoundCloudPlaylist(output, feed); err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// parseSoundCloudPlaylist fills feed with data from youtube-dl JSON output
+func parseSoundCloudPlaylist(data []byte, feed *model.Feed) error {
+	var playlist soundCloudPlaylist
+	if err := json.Unmarshal(data, &playlist); err != nil {
+		return errors.Wrap(err, "failed to decode youtube-dl output")
+	}
+
+	feed.Title = playlist.Title
+	feed.Description = playlist.Description
+	feed.Author = playlist.Uploader
+	feed.CoverArt = playlist.Thumbnail
+	feed.ItemURL = playlist.WebpageURL
+
+	bytesPerSecond := int64(highAudioBytesPerSecond)
+	if feed.Quality == model.QualityLow {
+		bytesPerSecond = lowAudioBytesPerSecond
+	}
+
+	for i, track := range playlist.Entries {
+		var (
+			duration = int64(track.Duration)
+			pubDate  = time.Unix(track.Timestamp, 0).UTC()
+		)
+
+		if i == 0 || pubDate.After(feed.PubDate) {
+			feed.PubDate = pubDate
+		}
+
+		feed.Episodes = append(feed.Episodes, &model.Episode{
+			ID:          track.ID,
+			Title:       track.Title,
+			Description: track.Description,
+			Duration:    duration,
+			Size:        duration * bytesPerSecond,
+			PubDate:     pubDate,
+			Thumbnail:   track.Thumbnail,
+			VideoURL:    track.WebpageURL,
+			Order:       strconv.Itoa(i),
+			Status:      model.EpisodeNew,
+		})
+	}
+
+	if len(feed.Episodes) > feed.PageSize {
+		feed.Episodes = feed.Episodes[:feed.PageSize]
+	}
+
+	return nil
+}
+
+// NewSoundCloudBuilder creates a builder running the same downloader binary as used for downloads
+func NewSoundCloudBuilder(downloader *config.Downloader, network *config.Network) (*SoundCloudBuilder, error) {
+	y, err := newYoutubeDL(downloader, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SoundCloudBuilder{youtubeDL: y}, nil
+}
@@ -0,0 +1,69 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestParseSoundCloudPlaylist(t *testing.T) {
+	const output = `{
+		"title": "Boiler Room (All)",
+		"description": "Mixes",
+		"uploader": "Boiler Room",
+		"thumbnail": "https://i1.sndcdn.com/avatar.jpg",
+		"webpage_url": "https://soundcloud.com/boilerroom",
+		"entries": [
+			{"id": "2", "title": "Mix 2", "duration": 3600.5, "timestamp": 1600000000, "webpage_url": "https://soundcloud.com/boilerroom/mix-2"},
+			{"id": "1", "title": "Mix 1", "duration": 1800, "timestamp": 1500000000, "webpage_url": "https://soundcloud.com/boilerroom/mix-1"},
+			{"id": "0", "title": "Mix 0", "duration": 60, "timestamp": 1400000000, "webpage_url": "https://soundcloud.com/boilerroom/mix-0"}
+		]
+	}`
+
+	feed := &model.Feed{Format: model.FormatAudio, Quality: model.QualityHigh, PageSize: 2}
+	err := parseSoundCloudPlaylist([]byte(output), feed)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Boiler Room (All)", feed.Title)
+	assert.Equal(t, "Boiler Room", feed.Author)
+	assert.Equal(t, "https://soundcloud.com/boilerroom", feed.ItemURL)
+	assert.Equal(t, time.Unix(1600000000, 0).UTC(), feed.PubDate)
+
+	require.Len(t, feed.Episodes, 2)
+	assert.Equal(t, "2", feed.Episodes[0].ID)
+	assert.EqualValues(t, 3600, feed.Episodes[0].Duration)
+	assert.EqualValues(t, 3600*highAudioBytesPerSecond, feed.Episodes[0].Size)
+	assert.Equal(t, "https://soundcloud.com/boilerroom/mix-2", feed.Episodes[0].VideoURL)
+	assert.Equal(t, model.EpisodeNew, feed.Episodes[0].Status)
+	assert.Equal(t, "1", feed.Episodes[1].ID)
+}
+
+func TestParseSoundCloudPlaylist_Invalid(t *testing.T) {
+	err := parseSoundCloudPlaylist([]byte("not json"), &model.Feed{})
+	assert.Error(t, err)
+}
+
+func TestNewSoundCloudBuilder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-builder-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The configured downloader is used, whatever its name
+	path := filepath.Join(dir, "yt-dlp")
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"), 0755))
+
+	b, err := NewSoundCloudBuilder(&config.Downloader{Path: path}, &config.Network{})
+	require.NoError(t, err)
+	assert.Equal(t, path, b.path)
+
+	_, err = NewSoundCloudBuilder(&config.Downloader{Path: filepath.Join(dir, "missing")}, &config.Network{})
+	assert.Error(t, err)
+}
@@ -43,6 +43,45 @@ func ParseURL(link string) (model.Info, error) {
 		return info, nil
 	}
 
+	if strings.HasSuffix(parsed.Host, "soundcloud.com") {
+		kind, id, err := parseSoundCloudURL(parsed)
+		if err != nil {
+			return model.Info{}, err
+		}
+
+		info.Provider = model.ProviderSoundCloud
+		info.LinkType = kind
+		info.ItemID = id
+
+		return info, nil
+	}
+
+	if strings.HasSuffix(parsed.Host, "bitchute.com") {
+		kind, id, err := parseBitchuteURL(parsed)
+		if err != nil {
+			return model.Info{}, err
+		}
+
+		info.Provider = model.ProviderBitchute
+		info.LinkType = kind
+		info.ItemID = id
+
+		return info, nil
+	}
+
+	if strings.HasSuffix(parsed.Host, "odysee.com") || strings.HasSuffix(parsed.Host, "lbry.tv") {
+		kind, id, err := parseOdyseeURL(parsed)
+		if err != nil {
+			return model.Info{}, err
+		}
+
+		info.Provider = model.ProviderOdysee
+		info.LinkType = kind
+		info.ItemID = id
+
+		return info, nil
+	}
+
 	return model.Info{}, errors.New("unsupported URL host")
 }
 
@@ -152,3 +191,53 @@ func parseVimeoURL(parsed *url.URL) (model.Type, string, error) {
 
 	return "", "", errors.New("unsupported link format")
 }
+
+func parseSoundCloudURL(parsed *url.URL) (model.Type, string, error) {
+	parts := strings.Split(strings.Trim(parsed.EscapedPath(), "/"), "/")
+	if len(parts) == 0 || parts[0] == "" {
+		return "", "", errors.New("invalid soundcloud link path")
+	}
+
+	// - https://soundcloud.com/artist
+	// - https://soundcloud.com/artist/tracks
+	if len(parts) == 1 || (len(parts) == 2 && parts[1] == "tracks") {
+		return model.TypeUser, parts[0], nil
+	}
+
+	// - https://soundcloud.com/artist/sets/name
+	if len(parts) == 3 && parts[1] == "sets" && parts[2] != "" {
+		return model.TypePlaylist, strings.Join(parts, "/"), nil
+	}
+
+	return "", "", errors.New("unsupported link format")
+}
+
+func parseBitchuteURL(parsed *url.URL) (model.Type, string, error) {
+	parts := strings.Split(strings.Trim(parsed.EscapedPath(), "/"), "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", errors.New("invalid bitchute link path")
+	}
+
+	switch parts[0] {
+	case "channel":
+		// - https://www.bitchute.com/channel/name/
+		return model.TypeChannel, parts[1], nil
+	case "playlist":
+		// - https://www.bitchute.com/playlist/id/
+		return model.TypePlaylist, parts[1], nil
+	}
+
+	return "", "", errors.New("unsupported link format")
+}
+
+func parseOdyseeURL(parsed *url.URL) (model.Type, string, error) {
+	parts := strings.Split(strings.Trim(parsed.EscapedPath(), "/"), "/")
+
+	// - https://odysee.com/@channel:7
+	// - https://lbry.tv/@channel:7
+	if len(parts) == 1 && strings.HasPrefix(parts[0], "@") && len(parts[0]) > 1 {
+		return model.TypeChannel, parts[0], nil
+	}
+
+	return "", "", errors.New("unsupported link format")
+}
@@ -112,3 +112,84 @@ func TestParseVimeoURL_InvalidLink(t *testing.T) {
 	_, _, err = parseVimeoURL(link)
 	require.Error(t, err)
 }
+
+func TestParseSoundCloudURL_User(t *testing.T) {
+	link, _ := url.ParseRequestURI("https://soundcloud.com/boilerroom")
+	kind, id, err := parseSoundCloudURL(link)
+	require.NoError(t, err)
+	require.Equal(t, model.TypeUser, kind)
+	require.Equal(t, "boilerroom", id)
+
+	link, _ = url.ParseRequestURI("https://soundcloud.com/boilerroom/tracks")
+	kind, id, err = parseSoundCloudURL(link)
+	require.NoError(t, err)
+	require.Equal(t, model.TypeUser, kind)
+	require.Equal(t, "boilerroom", id)
+}
+
+func TestParseSoundCloudURL_Playlist(t *testing.T) {
+	link, _ := url.ParseRequestURI("https://soundcloud.com/boilerroom/sets/mixes")
+	kind, id, err := parseSoundCloudURL(link)
+	require.NoError(t, err)
+	require.Equal(t, model.TypePlaylist, kind)
+	require.Equal(t, "boilerroom/sets/mixes", id)
+}
+
+func TestParseSoundCloudURL_InvalidLink(t *testing.T) {
+	link, _ := url.ParseRequestURI("https://soundcloud.com/")
+	_, _, err := parseSoundCloudURL(link)
+	require.Error(t, err)
+
+	link, _ = url.ParseRequestURI("https://soundcloud.com/boilerroom/some-track/comments")
+	_, _, err = parseSoundCloudURL(link)
+	require.Error(t, err)
+}
+
+func TestParseURL_SoundCloud(t *testing.T) {
+	info, err := ParseURL("soundcloud.com/boilerroom")
+	require.NoError(t, err)
+	require.Equal(t, model.ProviderSoundCloud, info.Provider)
+	require.Equal(t, model.TypeUser, info.LinkType)
+	require.Equal(t, "boilerroom", info.ItemID)
+}
+
+func TestParseBitchuteURL(t *testing.T) {
+	link, _ := url.ParseRequestURI("https://www.bitchute.com/channel/someone/")
+	kind, id, err := parseBitchuteURL(link)
+	require.NoError(t, err)
+	require.Equal(t, model.TypeChannel, kind)
+	require.Equal(t, "someone", id)
+
+	link, _ = url.ParseRequestURI("https://www.bitchute.com/playlist/abc123/")
+	kind, id, err = parseBitchuteURL(link)
+	require.NoError(t, err)
+	require.Equal(t, model.TypePlaylist, kind)
+	require.Equal(t, "abc123", id)
+
+	link, _ = url.ParseRequestURI("https://www.bitchute.com/video/abc123/")
+	_, _, err = parseBitchuteURL(link)
+	require.Error(t, err)
+}
+
+func TestParseOdyseeURL(t *testing.T) {
+	link, _ := url.ParseRequestURI("https://odysee.com/@someone:7")
+	kind, id, err := parseOdyseeURL(link)
+	require.NoError(t, err)
+	require.Equal(t, model.TypeChannel, kind)
+	require.Equal(t, "@someone:7", id)
+
+	link, _ = url.ParseRequestURI("https://odysee.com/@someone:7/video:1")
+	_, _, err = parseOdyseeURL(link)
+	require.Error(t, err)
+}
+
+func TestParseURL_YoutubeDLProviders(t *testing.T) {
+	info, err := ParseURL("https://www.bitchute.com/channel/someone/")
+	require.NoError(t, err)
+	require.Equal(t, model.ProviderBitchute, info.Provider)
+
+	info, err = ParseURL("https://lbry.tv/@someone:7")
+	require.NoError(t, err)
+	require.Equal(t, model.ProviderOdysee, info.Provider)
+	require.Equal(t, "@someone:7", info.ItemID)
+}
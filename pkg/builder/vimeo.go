@@ -213,11 +213,13 @@ func (v *VimeoBuilder) Build(ctx context.Context, cfg *config.Feed) (*model.Feed
 	return nil, errors.New("unsupported feed type")
 }
 
-func NewVimeoBuilder(ctx context.Context, token string) (*VimeoBuilder, error) {
+func NewVimeoBuilder(ctx context.Context, token string, httpClient *http.Client) (*VimeoBuilder, error) {
 	if token == "" {
 		return nil, errors.New("empty Vimeo access token")
 	}
 
+	// OAuth2 client sends requests via the client from context
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
 	tc := oauth2.NewClient(ctx, ts)
 
@@ -2,6 +2,7 @@ package builder
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"testing"
 
@@ -19,7 +20,7 @@ func TestQueryVimeoChannel(t *testing.T) {
 		t.Skip("Vimeo API key is not provided")
 	}
 
-	builder, err := NewVimeoBuilder(context.Background(), vimeoKey)
+	builder, err := NewVimeoBuilder(context.Background(), vimeoKey, http.DefaultClient)
 	require.NoError(t, err)
 
 	podcast := &model.Feed{ItemID: "staffpicks", Quality: model.QualityHigh}
@@ -38,7 +39,7 @@ func TestQueryVimeoGroup(t *testing.T) {
 		t.Skip("Vimeo API key is not provided")
 	}
 
-	builder, err := NewVimeoBuilder(context.Background(), vimeoKey)
+	builder, err := NewVimeoBuilder(context.Background(), vimeoKey, http.DefaultClient)
 	require.NoError(t, err)
 
 	podcast := &model.Feed{ItemID: "motion", Quality: model.QualityHigh}
@@ -57,7 +58,7 @@ func TestQueryVimeoUser(t *testing.T) {
 		t.Skip("Vimeo API key is not provided")
 	}
 
-	builder, err := NewVimeoBuilder(context.Background(), vimeoKey)
+	builder, err := NewVimeoBuilder(context.Background(), vimeoKey, http.DefaultClient)
 	require.NoError(t, err)
 
 	podcast := &model.Feed{ItemID: "motionarray", Quality: model.QualityHigh}
@@ -75,7 +76,7 @@ func TestQueryVimeoVideos(t *testing.T) {
 		t.Skip("Vimeo API key is not provided")
 	}
 
-	builder, err := NewVimeoBuilder(context.Background(), vimeoKey)
+	builder, err := NewVimeoBuilder(context.Background(), vimeoKey, http.DefaultClient)
 	require.NoError(t, err)
 
 	feed := &model.Feed{ItemID: "staffpicks", Quality: model.QualityHigh}
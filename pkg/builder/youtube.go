@@ -11,6 +11,7 @@ import (
 
 	"github.com/BrianHicks/finch/duration"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"google.golang.org/api/youtube/v3"
 
 	"github.com/mxpv/podsync/pkg/config"
@@ -38,8 +39,11 @@ type YouTubeBuilder struct {
 
 // Cost: 5 units (call method: 1, snippet: 2, contentDetails: 2)
 // See https://developers.google.com/youtube/v3/docs/channels/list#part
-func (yt *YouTubeBuilder) listChannels(ctx context.Context, linkType model.Type, id string, parts string) (*youtube.Channel, error) {
+func (yt *YouTubeBuilder) listChannels(ctx context.Context, linkType model.Type, id string, parts string, lang string) (*youtube.Channel, error) {
 	req := yt.client.Channels.List(parts)
+	if lang != "" {
+		req = req.Hl(lang)
+	}
 
 	switch linkType {
 	case model.TypeChannel:
@@ -65,8 +69,11 @@ func (yt *YouTubeBuilder) listChannels(ctx context.Context, linkType model.Type,
 
 // Cost: 3 units (call method: 1, snippet: 2)
 // See https://developers.google.com/youtube/v3/docs/playlists/list#part
-func (yt *YouTubeBuilder) listPlaylists(ctx context.Context, id, channelID string, parts string) (*youtube.Playlist, error) {
+func (yt *YouTubeBuilder) listPlaylists(ctx context.Context, id, channelID string, parts string, lang string) (*youtube.Playlist, error) {
 	req := yt.client.Playlists.List(parts)
+	if lang != "" {
+		req = req.Hl(lang)
+	}
 
 	if id != "" {
 		req = req.Id(id)
@@ -151,7 +158,7 @@ func (yt *YouTubeBuilder) GetVideoCount(ctx context.Context, info *model.Info) (
 	switch info.LinkType {
 	case model.TypeChannel, model.TypeUser:
 		// Cost: 3 units
-		if channel, err := yt.listChannels(ctx, info.LinkType, info.ItemID, "id,statistics"); err != nil {
+		if channel, err := yt.listChannels(ctx, info.LinkType, info.ItemID, "id,statistics", ""); err != nil {
 			return 0, err
 		} else { // nolint:golint
 			return channel.Statistics.VideoCount, nil
@@ -159,7 +166,7 @@ func (yt *YouTubeBuilder) GetVideoCount(ctx context.Context, info *model.Info) (
 
 	case model.TypePlaylist:
 		// Cost: 3 units
-		if playlist, err := yt.listPlaylists(ctx, info.ItemID, "", "id,contentDetails"); err != nil {
+		if playlist, err := yt.listPlaylists(ctx, info.ItemID, "", "id,contentDetails", ""); err != nil {
 			return 0, err
 		} else { // nolint:golint
 			return uint64(playlist.ContentDetails.ItemCount), nil
@@ -170,7 +177,7 @@ func (yt *YouTubeBuilder) GetVideoCount(ctx context.Context, info *model.Info) (
 	}
 }
 
-func (yt *YouTubeBuilder) queryFeed(ctx context.Context, feed *model.Feed, info *model.Info) error {
+func (yt *YouTubeBuilder) queryFeed(ctx context.Context, feed *model.Feed, info *model.Info, lang string) error {
 	var (
 		thumbnails *youtube.ThumbnailDetails
 	)
@@ -178,13 +185,16 @@ func (yt *YouTubeBuilder) queryFeed(ctx context.Context, feed *model.Feed, info
 	switch info.LinkType {
 	case model.TypeChannel, model.TypeUser:
 		// Cost: 5 units for channel or user
-		channel, err := yt.listChannels(ctx, info.LinkType, info.ItemID, "id,snippet,contentDetails")
+		channel, err := yt.listChannels(ctx, info.LinkType, info.ItemID, "id,snippet,contentDetails", lang)
 		if err != nil {
 			return err
 		}
 
 		feed.Title = channel.Snippet.Title
 		feed.Description = channel.Snippet.Description
+		if localized := channel.Snippet.Localized; lang != "" && localized != nil {
+			feed.Title, feed.Description = localize(feed.Title, feed.Description, localized.Title, localized.Description)
+		}
 
 		if channel.Kind == "youtube#channel" {
 			feed.ItemURL = fmt.Sprintf("https://youtube.com/channel/%s", channel.Id)
@@ -206,13 +216,18 @@ func (yt *YouTubeBuilder) queryFeed(ctx context.Context, feed *model.Feed, info
 
 	case model.TypePlaylist:
 		// Cost: 3 units for playlist
-		playlist, err := yt.listPlaylists(ctx, info.ItemID, "", "id,snippet")
+		playlist, err := yt.listPlaylists(ctx, info.ItemID, "", "id,snippet", lang)
 		if err != nil {
 			return err
 		}
 
-		feed.Title = fmt.Sprintf("%s: %s", playlist.Snippet.ChannelTitle, playlist.Snippet.Title)
-		feed.Description = playlist.Snippet.Description
+		title, description := playlist.Snippet.Title, playlist.Snippet.Description
+		if localized := playlist.Snippet.Localized; lang != "" && localized != nil {
+			title, description = localize(title, description, localized.Title, localized.Description)
+		}
+
+		feed.Title = fmt.Sprintf("%s: %s", playlist.Snippet.ChannelTitle, title)
+		feed.Description = description
 
 		feed.ItemURL = fmt.Sprintf("https://youtube.com/playlist?list=%s", playlist.Id)
 		feed.ItemID = playlist.Id
@@ -262,19 +277,30 @@ func (yt *YouTubeBuilder) getSize(duration int64, feed *model.Feed) int64 {
 
 // Cost: 5 units (call: 1, snippet: 2, contentDetails: 2)
 // See https://developers.google.com/youtube/v3/docs/videos/list#part
-func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist map[string]*youtube.PlaylistItemSnippet, feed *model.Feed) error {
+// Videos are localized to lang and the ones blocked in region are skipped, if set.
+func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist map[string]*youtube.PlaylistItemSnippet, feed *model.Feed, lang, region string) error {
 	// Make the list of video ids
 	ids := make([]string, 0, len(playlist))
 	for _, s := range playlist {
 		ids = append(ids, s.ResourceId.VideoId)
 	}
 
-	req, err := yt.client.Videos.List("id,snippet,contentDetails").Id(strings.Join(ids, ",")).Context(ctx).Do(yt.key)
+	call := yt.client.Videos.List("id,snippet,contentDetails").Id(strings.Join(ids, ","))
+	if lang != "" {
+		call = call.Hl(lang)
+	}
+
+	req, err := call.Context(ctx).Do(yt.key)
 	if err != nil {
 		return errors.Wrap(err, "failed to query video descriptions")
 	}
 
 	for _, video := range req.Items {
+		if video.ContentDetails != nil && !availableIn(video.ContentDetails.RegionRestriction, region) {
+			log.WithField("episode_id", video.Id).Infof("skipping video not available in region %s", region)
+			continue
+		}
+
 		var (
 			snippet  = video.Snippet
 			videoID  = video.Id
@@ -313,10 +339,15 @@ func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist m
 			size  = yt.getSize(seconds, feed)
 		)
 
+		title, description := snippet.Title, snippet.Description
+		if lang != "" && snippet.Localized != nil {
+			title, description = localize(title, description, snippet.Localized.Title, snippet.Localized.Description)
+		}
+
 		feed.Episodes = append(feed.Episodes, &model.Episode{
 			ID:          video.Id,
-			Title:       snippet.Title,
-			Description: snippet.Description,
+			Title:       title,
+			Description: description,
 			Thumbnail:   image,
 			Duration:    seconds,
 			Size:        size,
@@ -324,6 +355,7 @@ func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist m
 			PubDate:     pubDate,
 			Order:       order,
 			Status:      model.EpisodeNew,
+			Live:        snippet.LiveBroadcastContent == "live" || snippet.LiveBroadcastContent == "upcoming",
 		})
 	}
 
@@ -331,7 +363,7 @@ func (yt *YouTubeBuilder) queryVideoDescriptions(ctx context.Context, playlist m
 }
 
 // Cost: (3 units + 5 units) * X pages = 8 units per page
-func (yt *YouTubeBuilder) queryItems(ctx context.Context, feed *model.Feed) error {
+func (yt *YouTubeBuilder) queryItems(ctx context.Context, feed *model.Feed, since time.Time, lang, region string) error {
 	var (
 		token string
 		count int
@@ -349,6 +381,11 @@ func (yt *YouTubeBuilder) queryItems(ctx context.Context, feed *model.Feed) erro
 			return nil
 		}
 
+		items, done, err := yt.newPlaylistItems(items, feed.LinkType, since)
+		if err != nil {
+			return err
+		}
+
 		// Extract playlist snippets
 		snippets := map[string]*youtube.PlaylistItemSnippet{}
 		for _, item := range items {
@@ -357,17 +394,92 @@ func (yt *YouTubeBuilder) queryItems(ctx context.Context, feed *model.Feed) erro
 		}
 
 		// Query video descriptions from the list of ids
-		if err := yt.queryVideoDescriptions(ctx, snippets, feed); err != nil {
-			return err
+		if len(snippets) > 0 {
+			if err := yt.queryVideoDescriptions(ctx, snippets, feed, lang, region); err != nil {
+				return err
+			}
 		}
 
-		if count >= feed.PageSize || token == "" {
+		if done || count >= feed.PageSize || token == "" {
 			return nil
 		}
 	}
 }
 
+// newPlaylistItems drops the items published before since (if set).
+// Channel uploads are sorted by publication date, so done is true once a known item is reached,
+// while other playlists have arbitrary order and need to be queried completely.
+func (yt *YouTubeBuilder) newPlaylistItems(items []*youtube.PlaylistItem, linkType model.Type, since time.Time) ([]*youtube.PlaylistItem, bool, error) {
+	if since.IsZero() {
+		return items, false, nil
+	}
+
+	var (
+		result []*youtube.PlaylistItem
+		done   bool
+	)
+
+	for _, item := range items {
+		date, err := yt.parseDate(item.Snippet.PublishedAt)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if date.After(since) {
+			result = append(result, item)
+		} else if linkType == model.TypeChannel || linkType == model.TypeUser {
+			done = true
+		}
+	}
+
+	return result, done, nil
+}
+
+// localize returns localized title and description, falling back to the original ones if not translated
+func localize(title, description, localizedTitle, localizedDescription string) (string, string) {
+	if localizedTitle != "" {
+		title = localizedTitle
+	}
+
+	if localizedDescription != "" {
+		description = localizedDescription
+	}
+
+	return title, description
+}
+
+// availableIn checks video region restriction, videos are available everywhere if region is not set
+func availableIn(restriction *youtube.VideoContentDetailsRegionRestriction, region string) bool {
+	if restriction == nil || region == "" {
+		return true
+	}
+
+	for _, code := range restriction.Blocked {
+		if strings.EqualFold(code, region) {
+			return false
+		}
+	}
+
+	// Only listed regions are allowed, if any
+	if len(restriction.Allowed) == 0 {
+		return true
+	}
+
+	for _, code := range restriction.Allowed {
+		if strings.EqualFold(code, region) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (yt *YouTubeBuilder) Build(ctx context.Context, cfg *config.Feed) (*model.Feed, error) {
+	return yt.BuildSince(ctx, cfg, time.Time{})
+}
+
+// BuildSince queries only the episodes published after since, or all of them if since is zero
+func (yt *YouTubeBuilder) BuildSince(ctx context.Context, cfg *config.Feed, since time.Time) (*model.Feed, error) {
 	info, err := ParseURL(cfg.URL)
 	if err != nil {
 		return nil, err
@@ -388,11 +500,11 @@ func (yt *YouTubeBuilder) Build(ctx context.Context, cfg *config.Feed) (*model.F
 	}
 
 	// Query general information about feed (title, description, lang, etc)
-	if err := yt.queryFeed(ctx, feed, &info); err != nil {
+	if err := yt.queryFeed(ctx, feed, &info, cfg.APILanguage); err != nil {
 		return nil, err
 	}
 
-	if err := yt.queryItems(ctx, feed); err != nil {
+	if err := yt.queryItems(ctx, feed, since, cfg.APILanguage, cfg.APIRegion); err != nil {
 		return nil, err
 	}
 
@@ -411,12 +523,12 @@ func (yt *YouTubeBuilder) Build(ctx context.Context, cfg *config.Feed) (*model.F
 	return feed, nil
 }
 
-func NewYouTubeBuilder(key string) (*YouTubeBuilder, error) {
+func NewYouTubeBuilder(key string, client *http.Client) (*YouTubeBuilder, error) {
 	if key == "" {
 		return nil, errors.New("empty YouTube API key")
 	}
 
-	yt, err := youtube.New(&http.Client{})
+	yt, err := youtube.New(client)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create youtube client")
 	}
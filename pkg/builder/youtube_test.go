@@ -2,11 +2,14 @@ package builder
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/api/youtube/v3"
 
 	"github.com/mxpv/podsync/pkg/config"
 	"github.com/mxpv/podsync/pkg/model"
@@ -22,14 +25,14 @@ func TestYT_QueryChannel(t *testing.T) {
 		t.Skip("YouTube API key is not provided")
 	}
 
-	builder, err := NewYouTubeBuilder(ytKey)
+	builder, err := NewYouTubeBuilder(ytKey, http.DefaultClient)
 	require.NoError(t, err)
 
-	channel, err := builder.listChannels(testCtx, model.TypeChannel, "UC2yTVSttx7lxAOAzx1opjoA", "id")
+	channel, err := builder.listChannels(testCtx, model.TypeChannel, "UC2yTVSttx7lxAOAzx1opjoA", "id", "")
 	require.NoError(t, err)
 	require.Equal(t, "UC2yTVSttx7lxAOAzx1opjoA", channel.Id)
 
-	channel, err = builder.listChannels(testCtx, model.TypeUser, "fxigr1", "id")
+	channel, err = builder.listChannels(testCtx, model.TypeUser, "fxigr1", "id", "")
 	require.NoError(t, err)
 	require.Equal(t, "UCr_fwF-n-2_olTYd-m3n32g", channel.Id)
 }
@@ -39,7 +42,7 @@ func TestYT_BuildFeed(t *testing.T) {
 		t.Skip("YouTube API key is not provided")
 	}
 
-	builder, err := NewYouTubeBuilder(ytKey)
+	builder, err := NewYouTubeBuilder(ytKey, http.DefaultClient)
 	require.NoError(t, err)
 
 	urls := []string{
@@ -80,7 +83,7 @@ func TestYT_GetVideoCount(t *testing.T) {
 		t.Skip("YouTube API key is not provided")
 	}
 
-	builder, err := NewYouTubeBuilder(ytKey)
+	builder, err := NewYouTubeBuilder(ytKey, http.DefaultClient)
 	require.NoError(t, err)
 
 	feeds := []*model.Info{
@@ -101,3 +104,68 @@ func TestYT_GetVideoCount(t *testing.T) {
 		})
 	}
 }
+
+func TestYT_NewPlaylistItems(t *testing.T) {
+	items := []*youtube.PlaylistItem{
+		{Snippet: &youtube.PlaylistItemSnippet{PublishedAt: "2020-03-01T00:00:00Z"}},
+		{Snippet: &youtube.PlaylistItemSnippet{PublishedAt: "2020-01-01T00:00:00Z"}},
+		{Snippet: &youtube.PlaylistItemSnippet{PublishedAt: "2020-02-01T00:00:00Z"}},
+	}
+
+	since := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		linkType model.Type
+		since    time.Time
+		expected int
+		done     bool
+	}{
+		{name: "Full", linkType: model.TypeChannel, expected: 3},
+		{name: "Channel", linkType: model.TypeChannel, since: since, expected: 2, done: true},
+		{name: "Playlist", linkType: model.TypePlaylist, since: since, expected: 2},
+	}
+
+	yt := &YouTubeBuilder{}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			result, done, err := yt.newPlaylistItems(items, tst.linkType, tst.since)
+			require.NoError(t, err)
+			assert.Len(t, result, tst.expected)
+			assert.Equal(t, tst.done, done)
+		})
+	}
+}
+
+func TestYT_AvailableIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		restriction *youtube.VideoContentDetailsRegionRestriction
+		region      string
+		expected    bool
+	}{
+		{name: "No restriction", region: "DE", expected: true},
+		{name: "No region", restriction: &youtube.VideoContentDetailsRegionRestriction{Allowed: []string{"US"}}, expected: true},
+		{name: "Allowed", restriction: &youtube.VideoContentDetailsRegionRestriction{Allowed: []string{"US", "DE"}}, region: "de", expected: true},
+		{name: "Not allowed", restriction: &youtube.VideoContentDetailsRegionRestriction{Allowed: []string{"US"}}, region: "DE"},
+		{name: "Blocked", restriction: &youtube.VideoContentDetailsRegionRestriction{Blocked: []string{"DE"}}, region: "DE"},
+		{name: "Not blocked", restriction: &youtube.VideoContentDetailsRegionRestriction{Blocked: []string{"US"}}, region: "DE", expected: true},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert.Equal(t, tst.expected, availableIn(tst.restriction, tst.region))
+		})
+	}
+}
+
+func TestYT_Localize(t *testing.T) {
+	title, description := localize("Title", "Description", "Titel", "Beschreibung")
+	assert.Equal(t, "Titel", title)
+	assert.Equal(t, "Beschreibung", description)
+
+	// Missing translations fall back to the original text
+	title, description = localize("Title", "Description", "Titel", "")
+	assert.Equal(t, "Titel", title)
+	assert.Equal(t, "Description", description)
+}
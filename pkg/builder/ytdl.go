@@ -0,0 +1,208 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+const (
+	youtubeDLDefaultPageSize = 50
+	youtubeDLQueryTimeout    = 5 * time.Minute
+)
+
+// flatPlaylist is a subset of youtube-dl's JSON output for channels listed with --flat-playlist
+type flatPlaylist struct {
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Uploader    string      `json:"uploader"`
+	Thumbnail   string      `json:"thumbnail"`
+	WebpageURL  string      `json:"webpage_url"`
+	Entries     []flatEntry `json:"entries"`
+}
+
+// flatEntry is a video listed without extracting its page, so most fields are optional
+type flatEntry struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Duration    float64 `json:"duration"`
+	Timestamp   int64   `json:"timestamp"`
+	UploadDate  string  `json:"upload_date"`
+	Thumbnail   string  `json:"thumbnail"`
+	URL         string  `json:"url"`
+	WebpageURL  string  `json:"webpage_url"`
+	IsLive      bool    `json:"is_live"`
+	LiveStatus  string  `json:"live_status"`
+}
+
+// youtubeDL runs the downloader binary (yt-dlp or youtube-dl) to list playlists of providers without public API
+type youtubeDL struct {
+	path    string
+	network *config.Network
+}
+
+// newYoutubeDL finds the same downloader binary as used for downloads
+func newYoutubeDL(downloader *config.Downloader, network *config.Network) (youtubeDL, error) {
+	path, err := ytdl.FindBinary(downloader.Path)
+	if err != nil {
+		return youtubeDL{}, err
+	}
+
+	return youtubeDL{path: path, network: network}, nil
+}
+
+// queryPlaylist dumps up to pageSize playlist entries as a single JSON, args precede the common arguments.
+// Cookies are needed to list private entries.
+func (y youtubeDL) queryPlaylist(ctx context.Context, link string, pageSize int, cookies string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, youtubeDLQueryTimeout)
+	defer cancel()
+
+	args = append(args, "--dump-single-json", "--playlist-end", strconv.Itoa(pageSize))
+	if cookies != "" {
+		args = append(args, "--cookies", cookies)
+	}
+	args = append(args, ytdl.NetworkArgs(*y.network)...)
+	args = append(args, link)
+
+	cmd := exec.CommandContext(ctx, y.path, args...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, errors.Wrapf(err, "failed to query playlist: %s", exitErr.Stderr)
+		}
+		return nil, errors.Wrap(err, "failed to query playlist")
+	}
+
+	return output, nil
+}
+
+// YoutubeDLBuilder lists channels of providers without public API (Bitchute, Odysee) via youtube-dl
+type YoutubeDLBuilder struct {
+	youtubeDL
+}
+
+func (b *YoutubeDLBuilder) Build(ctx context.Context, cfg *config.Feed) (*model.Feed, error) {
+	info, err := ParseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &model.Feed{
+		ItemID:    info.ItemID,
+		Provider:  info.Provider,
+		LinkType:  info.LinkType,
+		Format:    cfg.Format,
+		Quality:   cfg.Quality,
+		PageSize:  cfg.PageSize,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	if feed.PageSize == 0 {
+		feed.PageSize = youtubeDLDefaultPageSize
+	}
+
+	// Flat listing doesn't open every video page, which is way faster for large channels
+	output, err := b.queryPlaylist(ctx, cfg.URL, feed.PageSize, cfg.Cookies, "--flat-playlist")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := parseFlatPlaylist(output, feed, feed.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// parseFlatPlaylist fills feed with data from youtube-dl JSON output.
+// Entries are expected to be listed newest first, which is used to order the ones without publication date.
+func parseFlatPlaylist(data []byte, feed *model.Feed, now time.Time) error {
+	var playlist flatPlaylist
+	if err := json.Unmarshal(data, &playlist); err != nil {
+		return errors.Wrap(err, "failed to decode youtube-dl output")
+	}
+
+	feed.Title = playlist.Title
+	feed.Description = playlist.Description
+	feed.Author = playlist.Uploader
+	feed.CoverArt = playlist.Thumbnail
+	feed.ItemURL = playlist.WebpageURL
+
+	for i, entry := range playlist.Entries {
+		var (
+			duration = int64(entry.Duration)
+			pubDate  = now.Add(-time.Duration(i) * time.Second)
+			videoURL = entry.WebpageURL
+		)
+
+		if entry.Timestamp > 0 {
+			pubDate = time.Unix(entry.Timestamp, 0).UTC()
+		} else if date, err := time.Parse("20060102", entry.UploadDate); err == nil {
+			pubDate = date
+		}
+
+		if videoURL == "" {
+			videoURL = entry.URL
+		}
+
+		if i == 0 || pubDate.After(feed.PubDate) {
+			feed.PubDate = pubDate
+		}
+
+		feed.Episodes = append(feed.Episodes, &model.Episode{
+			ID:          entry.ID,
+			Title:       entry.Title,
+			Description: entry.Description,
+			Duration:    duration,
+			Size:        estimateSize(duration, feed),
+			PubDate:     pubDate,
+			Thumbnail:   entry.Thumbnail,
+			VideoURL:    videoURL,
+			Order:       strconv.Itoa(i),
+			Status:      model.EpisodeNew,
+			Live:        ytdl.IsLive(entry.IsLive, entry.LiveStatus),
+		})
+	}
+
+	if len(feed.Episodes) > feed.PageSize {
+		feed.Episodes = feed.Episodes[:feed.PageSize]
+	}
+
+	return nil
+}
+
+// estimateSize approximates episode size from its duration, as it's unknown until downloaded
+func estimateSize(duration int64, feed *model.Feed) int64 {
+	if feed.Format == model.FormatAudio {
+		if feed.Quality == model.QualityLow {
+			return duration * lowAudioBytesPerSecond
+		}
+
+		return duration * highAudioBytesPerSecond
+	}
+
+	if feed.Quality == model.QualityLow {
+		return duration * ldBytesPerSecond
+	}
+
+	return duration * hdBytesPerSecond
+}
+
+// NewYoutubeDLBuilder creates a builder running the same downloader binary as used for downloads
+func NewYoutubeDLBuilder(downloader *config.Downloader, network *config.Network) (*YoutubeDLBuilder, error) {
+	y, err := newYoutubeDL(downloader, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return &YoutubeDLBuilder{youtubeDL: y}, nil
+}
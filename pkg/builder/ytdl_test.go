@@ -0,0 +1,87 @@
+package builder
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestParseFlatPlaylist(t *testing.T) {
+	const output = `{
+		"title": "Some Channel",
+		"uploader": "Some Author",
+		"webpage_url": "https://www.bitchute.com/channel/some/",
+		"entries": [
+			{"id": "c", "title": "Video C", "duration": 125.7, "upload_date": "20210301", "url": "https://www.bitchute.com/video/c/"},
+			{"id": "b", "title": "Video B", "url": "https://www.bitchute.com/video/b/"},
+			{"id": "a", "title": "Video A", "timestamp": 1500000000, "webpage_url": "https://www.bitchute.com/video/a/"},
+			{"id": "live", "title": "Stream", "live_status": "is_live", "url": "https://www.bitchute.com/video/live/"}
+		]
+	}`
+
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	feed := &model.Feed{Format: model.FormatVideo, Quality: model.QualityHigh, PageSize: 50}
+	err := parseFlatPlaylist([]byte(output), feed, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Some Channel", feed.Title)
+	assert.Equal(t, "Some Author", feed.Author)
+	assert.Equal(t, "https://www.bitchute.com/channel/some/", feed.ItemURL)
+
+	require.Len(t, feed.Episodes, 4)
+
+	assert.Equal(t, "c", feed.Episodes[0].ID)
+	assert.EqualValues(t, 125, feed.Episodes[0].Duration)
+	assert.EqualValues(t, 125*hdBytesPerSecond, feed.Episodes[0].Size)
+	assert.Equal(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), feed.Episodes[0].PubDate)
+	assert.Equal(t, "https://www.bitchute.com/video/c/", feed.Episodes[0].VideoURL)
+
+	// No date available, keeps listing order
+	assert.Equal(t, now.Add(-time.Second), feed.Episodes[1].PubDate)
+	assert.Equal(t, now.Add(-time.Second), feed.PubDate)
+
+	assert.Equal(t, time.Unix(1500000000, 0).UTC(), feed.Episodes[2].PubDate)
+	assert.Equal(t, "https://www.bitchute.com/video/a/", feed.Episodes[2].VideoURL)
+	assert.False(t, feed.Episodes[2].Live)
+
+	assert.True(t, feed.Episodes[3].Live)
+}
+
+func TestParseFlatPlaylist_Invalid(t *testing.T) {
+	err := parseFlatPlaylist([]byte("not json"), &model.Feed{}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestYoutubeDL_QueryPlaylist(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-builder-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "yt-dlp")
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\necho \"$@\"\n"), 0755))
+
+	network := &config.Network{Proxy: "http://proxy:3128"}
+	b, err := NewYoutubeDLBuilder(&config.Downloader{Path: path}, network)
+	require.NoError(t, err)
+
+	output, err := b.queryPlaylist(context.Background(), "https://odysee.com/@name", 10, "cookies.txt", "--flat-playlist")
+	require.NoError(t, err)
+	assert.Equal(t, "--flat-playlist --dump-single-json --playlist-end 10 --cookies cookies.txt --proxy http://proxy:3128 https://odysee.com/@name\n", string(output))
+
+	_, err = NewYoutubeDLBuilder(&config.Downloader{Path: filepath.Join(dir, "missing")}, network)
+	assert.Error(t, err)
+}
@@ -1,24 +1,39 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/naoina/toml"
 	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpguts"
 
 	"github.com/mxpv/podsync/pkg/model"
 )
 
-// Options for each of sponsorblock's categories. Each should be one of "cut", "keep", or "default" if in a feed.
+// Options for each of sponsorblock's categories. Each should be one of "cut", "keep", "mute", or "default" if in a feed.
+// "mute" silences the segment instead of removing it.
 // Has no effect if `sponsorblock_mode` is `off`
 type SponsorBlockCategories struct {
 	// Sponsor category: Paid promotion, paid referrals and direct advertisements. Not for self-promotion or free shoutouts to causes/creators/websites/products they like.
 	Sponsors string `toml:"sponsors"`
 	// Intermission/Intro Animation category: An interval without actual content. Could be a pause, static frame, repeating animation. This should not be used for transitions containing information or be used on music videos.
-	Intermissions string `toml:"intermissions`
+	Intermissions string `toml:"intermissions"`
 	// Endcards/Credits category: Credits or when the YouTube endcards appear. Not for spoken conclusions. This should not include useful content. This should not be used on music videos.
 	Endcards string `toml:"endcards"`
 	// Interaction Reminder (Subscribe) category: When there is a short reminder to like, subscribe or follow them in the middle of content. If it is long or about something specific, it should be under self promotion instead.
@@ -27,6 +42,29 @@ type SponsorBlockCategories struct {
 	SelfPromotions string `toml:"self_promotions"`
 	// Non-Music Section category: Only for use in music videos. This includes introductions or outros in music videos.
 	NonmusicSections string `toml:"nonmusic_sections"`
+	// Filler Tangent category: Tangential scenes added only for filler or humor that are not required to understand the main content of the video.
+	Filler string `toml:"filler"`
+	// Preview/Recap category: Collection of clips that show what is coming up in in this video or other videos in a series where all information is repeated later in the video.
+	Preview string `toml:"preview"`
+}
+
+type categoryMode struct {
+	name string
+	mode string
+}
+
+// modes returns the mode of each category along with its config field name
+func (c *SponsorBlockCategories) modes() []categoryMode {
+	return []categoryMode{
+		{"sponsors", c.Sponsors},
+		{"intermissions", c.Intermissions},
+		{"endcards", c.Endcards},
+		{"interaction_reminders", c.InteractionReminders},
+		{"self_promotions", c.SelfPromotions},
+		{"nonmusic_sections", c.NonmusicSections},
+		{"filler", c.Filler},
+		{"preview", c.Preview},
+	}
 }
 
 // Feed is a configuration for a feed
@@ -37,30 +75,118 @@ type Feed struct {
 	// PageSize is the number of pages to query from YouTube API.
 	// NOTE: larger page sizes/often requests might drain your API token.
 	PageSize int `toml:"page_size"`
+	// PageSizeMode selects episodes counted toward PageSize when queueing downloads, either "queued" or "scanned"
+	PageSizeMode model.PageSizeMode `toml:"page_size_mode"`
+	// APILanguage is a language code (e.g. "de") to query localized titles and descriptions with (YouTube only)
+	APILanguage string `toml:"api_language"`
+	// APIRegion is an ISO 3166-1 alpha-2 country code (e.g. "DE"), videos blocked in the region are skipped (YouTube only)
+	APIRegion string `toml:"api_region"`
+	// LatestOnly downloads only the newest episode matching filters, other pending episodes are ignored for good
+	LatestOnly bool `toml:"latest_only"`
+	// Backfill fetches and downloads the whole feed once, ignoring PageSize, before switching to regular updates
+	Backfill bool `toml:"backfill"`
 	// UpdatePeriod is how often to check for updates.
 	// Format is "300ms", "1.5h" or "2h45m".
 	// Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
 	// NOTE: too often update check might drain your API token.
 	UpdatePeriod Duration `toml:"update_period"`
-	// Cron expression format is how often to check update
+	// Cron expression format is how often to check update, takes precedence over UpdatePeriod if set
 	// NOTE: too often update check might drain your API token.
 	CronSchedule string `toml:"cron_schedule"`
 	// Quality to use for this feed
 	Quality model.Quality `toml:"quality"`
 	// Maximum height of video
 	MaxHeight int `toml:"max_height"`
+	// FormatSelector is passed to youtube-dl as is (--format), overriding the one derived from quality and max_height
+	FormatSelector string `toml:"format_selector"`
 	// Format to use for this feed
 	Format model.Format `toml:"format"`
+	// Concurrency is the number of episodes to download in parallel for this feed
+	Concurrency int `toml:"concurrency"`
+	// DownloadOrder is the order in which episodes are queued, either "newest_first" or "oldest_first"
+	DownloadOrder model.DownloadOrder `toml:"download_order"`
 	// Only download episodes that match this regexp (defaults to matching anything)
 	Filters Filters `toml:"filters"`
+	// IncludeIDs only lets episodes with the given IDs (e.g. YouTube video IDs) through filters, if not empty
+	IncludeIDs StringSlice `toml:"include_ids"`
+	// ExcludeIDs skips episodes with the given IDs, even if they are in IncludeIDs
+	ExcludeIDs StringSlice `toml:"exclude_ids"`
 	// Clean is a cleanup policy to use for this feed
 	Clean Cleanup `toml:"clean"`
+	// OrderBy is the order of episodes in XML, either "pubdate" or "title_regex" (see OrderPattern)
+	OrderBy model.OrderBy `toml:"order_by"`
+	// OrderPattern extracts the episode number from titles with its first capture group when ordering
+	// by "title_regex". Episodes with titles not matching the pattern go last, in pubdate order
+	OrderPattern string `toml:"order_pattern"`
+	// Compiled OrderPattern, nil if not set
+	OrderRegexp *regexp.Regexp `toml:"-"`
+	// EpisodeNumberRegex and SeasonNumberRegex extract numbers published as <itunes:episode> and <itunes:season>
+	// from titles with their first capture group. Tags are omitted for titles not matching the pattern
+	EpisodeNumberRegex string `toml:"episode_number_regex"`
+	SeasonNumberRegex  string `toml:"season_number_regex"`
+	// Compiled EpisodeNumberRegex and SeasonNumberRegex, nil if not set
+	EpisodeNumberRegexp *regexp.Regexp `toml:"-"`
+	SeasonNumberRegexp  *regexp.Regexp `toml:"-"`
+	// FeedLimit is the maximum number of the newest episodes listed in XML (0 - no limit).
+	// Older episodes are not deleted, see Clean for that.
+	FeedLimit int `toml:"feed_limit"`
 	// Custom is a list of feed customizations
 	Custom Custom `toml:"custom"`
 	// List of additional youtube-dl arguments passed at download time
 	YouTubeDLArgs []string `toml:"youtube_dl_args"`
+	// RateLimit is the maximum download rate in bytes per second (e.g. "500K" or "2M")
+	RateLimit Size `toml:"rate_limit"`
+	// MaxFilesize makes the downloader refuse files larger than the given size (e.g. "2G"),
+	// the size is estimated by youtube-dl before downloading
+	MaxFilesize Size `toml:"max_filesize"`
+	// Cookies is a path to Netscape-format cookies file passed to the downloader (e.g. for members-only or age-restricted videos)
+	Cookies string `toml:"cookies"`
+	// HTTPHeaders are sent with download requests (e.g. Referer or Authorization), merged with downloader.http_headers
+	HTTPHeaders map[string]string `toml:"http_headers"`
+	// MediaHostname overrides server.media_hostname for this feed
+	MediaHostname string `toml:"media_hostname"`
 	// Included in OPML file
 	OPML bool `toml:"opml"`
+	// Paused disables updates of the feed, already published episodes and XML are still served
+	Paused bool `toml:"paused"`
+	// OutputTemplate is youtube-dl's output template (--output) of the downloaded file name in the temporary
+	// download directory, "<episode ID>.%(ext)s" by default. Doesn't affect names of published files (see FilenameTemplate).
+	OutputTemplate string `toml:"output_template"`
+	// FilenameTemplate is a Go template of episode file names (without extension),
+	// with {{.ID}}, {{.Title}}, {{.PubDate}} and {{.FeedID}} available. Defaults to episode ID.
+	FilenameTemplate string `toml:"filename_template"`
+	// Transcripts downloads episode subtitles (in the language from custom.lang, English by default)
+	// and links them in the feed as <podcast:transcript>
+	Transcripts bool `toml:"transcripts"`
+	// EmbedChapters embeds chapters into episode files, adjusting them when SponsorBlock segments are cut out
+	EmbedChapters bool `toml:"embed_chapters"`
+	// VerifyDownloads checks downloaded files with ffprobe and retries broken or truncated ones
+	VerifyDownloads bool `toml:"verify_downloads"`
+	// KeepOriginal stores the uncut file next to the episode when SponsorBlock segments are cut out
+	KeepOriginal bool `toml:"keep_original"`
+	// SplitByChapters publishes each chapter of a video as a separate episode
+	SplitByChapters bool `toml:"split_by_chapters"`
+	// PublishChapters publishes episode chapters as Podcasting 2.0 JSON and links them in the feed as <podcast:chapters>
+	PublishChapters bool `toml:"publish_chapters"`
+	// EnrichMetadata replaces episode descriptions with the full text from youtube-dl's info JSON,
+	// which is also published next to the episode file
+	EnrichMetadata bool `toml:"enrich_metadata"`
+	// AppendTags appends video tags to enriched descriptions
+	AppendTags bool `toml:"append_tags"`
+	// EpisodeArtwork publishes video thumbnails as episode <itunes:image> (and embeds them into mp3 files)
+	EpisodeArtwork bool `toml:"episode_artwork"`
+	// NormalizeAudio runs ffmpeg's loudnorm filter on episodes (after cutting SponsorBlock segments, if any)
+	NormalizeAudio bool `toml:"normalize_audio"`
+	// LoudnessTarget is the integrated loudness to normalize to, in LUFS (-16 by default)
+	LoudnessTarget int `toml:"loudness_target"`
+	// AudioCodec of audio feeds, one of "mp3" (default), "aac" or "opus"
+	AudioCodec model.AudioCodec `toml:"audio_codec"`
+	// AudioBitrate of audio feeds in kbit/s (0 - youtube-dl and ffmpeg defaults)
+	AudioBitrate int `toml:"audio_bitrate"`
+	// SourceFeed is an ID of another feed to transcode episodes from instead of downloading them.
+	// Episodes are taken from the source feed's database records, so the API is not queried either.
+	// SponsorBlock segments are cut by the source feed, the rendition feed's own SponsorBlock settings are ignored.
+	SourceFeed string `toml:"source_feed"`
 	// Whether to cut out sponsor segments using sponsorblock.
 	// One of:
 	// "default"      - Use the mode from global config
@@ -72,7 +198,25 @@ type Feed struct {
 	// How long to wait, if `sponsorblock_mode` is "delay" or "requiredelay"
 	SponsorblockDelay Duration `toml:"sponsorblock_delay"`
 	// What to do with each category of segments from sponsorblock
-	SponsorBlockCategories SponsorBlockCategories `toml:"sponsorblock_categories`
+	SponsorBlockCategories SponsorBlockCategories `toml:"sponsorblock_categories"`
+}
+
+// Extension returns the file extension of the feed's episodes
+func (f *Feed) Extension() string {
+	if f.Format == model.FormatAudio {
+		return f.AudioCodec.Extension()
+	}
+
+	return "mp4"
+}
+
+// Schedule returns when to update the feed. CronSchedule takes precedence over UpdatePeriod.
+func (f *Feed) Schedule() (cron.Schedule, error) {
+	if f.CronSchedule == "" {
+		return cron.Every(f.UpdatePeriod.Duration), nil
+	}
+
+	return cron.ParseStandard(f.CronSchedule)
 }
 
 func IsValidSponsorblockMode(mode string, inFeed bool) bool {
@@ -90,11 +234,22 @@ func IsValidSponsorblockMode(mode string, inFeed bool) bool {
 	return false
 }
 
+// isValidHostname checks that hostname is an absolute http(s) URL, like https://cdn.example.com
+func isValidHostname(hostname string) bool {
+	u, err := url.Parse(hostname)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 func IsValidCategoryMode(mode string, inFeed bool) bool {
 	switch mode {
 	case
 		"cut",
-		"keep":
+		"keep",
+		"mute":
 		return true
 	case
 		"default":
@@ -108,7 +263,59 @@ type Filters struct {
 	NotTitle       string `toml:"not_title"`
 	Description    string `toml:"description"`
 	NotDescription string `toml:"not_description"`
+	// CaseInsensitive makes title and description patterns ignore case
+	CaseInsensitive bool `toml:"case_insensitive"`
+	// MinDuration skips episodes shorter than the given duration
+	MinDuration Duration `toml:"min_duration"`
+	// MaxDuration skips episodes longer than the given duration
+	MaxDuration Duration `toml:"max_duration"`
+	// MinDate skips episodes published before the given date
+	MinDate Date `toml:"min_date"`
+	// MaxDate skips episodes published after the given date
+	MaxDate Date `toml:"max_date"`
 	// More filters to be added here
+
+	// Compiled title and description patterns, nil if not set (see compile)
+	TitleRegexp          *regexp.Regexp `toml:"-"`
+	NotTitleRegexp       *regexp.Regexp `toml:"-"`
+	DescriptionRegexp    *regexp.Regexp `toml:"-"`
+	NotDescriptionRegexp *regexp.Regexp `toml:"-"`
+}
+
+// compile compiles filter patterns once when the config is loaded, so they're not recompiled for every episode
+func (f *Filters) compile() error {
+	var result *multierror.Error
+
+	for _, filter := range []struct {
+		name    string
+		pattern string
+		out     **regexp.Regexp
+	}{
+		{"title", f.Title, &f.TitleRegexp},
+		{"not_title", f.NotTitle, &f.NotTitleRegexp},
+		{"description", f.Description, &f.DescriptionRegexp},
+		{"not_description", f.NotDescription, &f.NotDescriptionRegexp},
+	} {
+		*filter.out = nil
+		if filter.pattern == "" {
+			continue
+		}
+
+		pattern := filter.pattern
+		if f.CaseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid filters.%s pattern %q", filter.name, filter.pattern))
+			continue
+		}
+
+		*filter.out = compiled
+	}
+
+	return result.ErrorOrNil()
 }
 
 type Custom struct {
@@ -116,16 +323,42 @@ type Custom struct {
 	Category string `toml:"category"`
 	Explicit bool   `toml:"explicit"`
 	Language string `toml:"lang"`
+	// PodcastGUID overrides <podcast:guid>, which is derived from the feed URL by default
+	PodcastGUID string `toml:"podcast_guid"`
+	// Locked asks podcast platforms not to import the feed, unless confirmed by OwnerEmail
+	Locked     bool   `toml:"locked"`
+	OwnerEmail string `toml:"owner_email"`
+	// CoverArtResize publishes a copy of the cover art resized to a square accepted by podcast directories
+	CoverArtResize bool `toml:"cover_art_resize"`
+	// Block asks podcast directories (e.g. Apple Podcasts) not to list the feed
+	Block bool `toml:"block"`
+	// Complete marks the feed as a finished series, no more episodes will be added
+	Complete bool `toml:"complete"`
 }
 
 type Server struct {
 	// Hostname to use for download links
 	Hostname string `toml:"hostname"`
+	// MediaHostname replaces the scheme and host of episode file links (e.g. to serve media from a CDN),
+	// feed XMLs are still linked via Hostname
+	MediaHostname string `toml:"media_hostname"`
 	// Port is a server port to listen to
 	Port int `toml:"port"`
+	// BindAddress is an IPv4 or IPv6 address to listen on, all interfaces by default
+	BindAddress string `toml:"bind_address"`
 	// DataDir is a path to a directory to keep XML feeds and downloaded episodes,
 	// that will be available to user via web server for download.
 	DataDir string `toml:"data_dir"`
+	// Index enables HTML page listing all feeds at the server root
+	Index bool `toml:"index"`
+	// Username and Password enable HTTP Basic Auth for feeds and episodes
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// AuthToken enables access with "Authorization: Bearer <token>" header
+	AuthToken string `toml:"auth_token"`
+	// TLSCert and TLSKey are paths to PEM encoded certificate (chain) and private key to serve HTTPS
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
 }
 
 type Database struct {
@@ -144,6 +377,11 @@ type Badger struct {
 type Cleanup struct {
 	// KeepLast defines how many episodes to keep
 	KeepLast int `toml:"keep_last"`
+	// MaxSize is the disk budget of the feed (e.g. "10G"), the oldest episodes are deleted when exceeded
+	MaxSize Size `toml:"max_size"`
+	// MaxAge deletes episodes published earlier than that (e.g. "720h").
+	// Episodes are kept only if they satisfy all of the limits set.
+	MaxAge Duration `toml:"max_age"`
 }
 
 type Log struct {
@@ -157,23 +395,146 @@ type Log struct {
 	MaxAge int `toml:"max_age"`
 	// Compress old backups
 	Compress bool `toml:"compress"`
+	// Format of log entries, either "text" (default) or "json"
+	Format string `toml:"format"`
 }
 
 // Downloader is a youtube-dl related configuration
 type Downloader struct {
+	// Path to youtube-dl or yt-dlp binary (by default yt-dlp is looked up in PATH first, then youtube-dl)
+	Path string `toml:"path"`
 	// SelfUpdate toggles self update every 24 hour
 	SelfUpdate bool `toml:"self_update"`
+	// MaxConcurrentDownloads limits the total number of parallel downloads across all feeds (0 - unlimited)
+	MaxConcurrentDownloads int `toml:"max_concurrent_downloads"`
+	// DownloadRetries is the number of times to retry a failed download before giving up
+	DownloadRetries int `toml:"download_retries"`
+	// RetryBackoff is the initial delay between download retries, doubled after each attempt
+	RetryBackoff Duration `toml:"retry_backoff"`
+	// RateLimit is the default maximum download rate for feeds that don't set their own
+	RateLimit Size `toml:"rate_limit"`
+	// Cookies is the default cookies file for feeds that don't set their own
+	Cookies string `toml:"cookies"`
+	// HTTPHeaders are default headers for download requests, feeds override them by name
+	HTTPHeaders map[string]string `toml:"http_headers"`
+	// SkipLive postpones downloads of live streams and premieres until they end (enabled by default)
+	SkipLive bool `toml:"skip_live"`
+	// UpdateJitter delays each scheduled feed update by a random duration up to the given one, so feeds with
+	// the same schedule don't query APIs at once. Limited to half of the feed's update period
+	UpdateJitter Duration `toml:"update_jitter"`
+	// ShutdownTimeout is how long to wait for running updates to stop on shutdown before exiting forcibly
+	ShutdownTimeout Duration `toml:"shutdown_timeout"`
+	// MinFreeSpace skips downloads while the data directory has less free space (e.g. "2G", 0 - no limit)
+	MinFreeSpace Size `toml:"min_free_space"`
+	// External downloader youtube-dl hands off media downloads to (e.g. "aria2c")
+	External string `toml:"external"`
+	// ExternalArgs are passed to the external downloader
+	ExternalArgs []string `toml:"external_args"`
+	// TempDir is where episodes are downloaded and processed before they are copied to storage (system temp dir by default)
+	TempDir string `toml:"temp_dir"`
+	// ResumeDownloads keeps partially downloaded files of failed downloads, so the next attempt continues them
+	ResumeDownloads bool `toml:"resume_downloads"`
+	// PartialDir is where partial downloads are kept with resume_downloads ("partial" in the database directory by default)
+	PartialDir string `toml:"partial_dir"`
 }
 
 type SponsorBlock struct {
 	// Base URL for sponsorblock api; Should be "https://sponsor.ajay.app" unless a custom server is being used
 	ApiUrl string `toml:"url"`
+	// Mirrors of sponsorblock api, tried in order (after ApiUrl, if set) until one of them responds
+	ApiUrls StringSlice `toml:"urls"`
 	// Default mode for sponsorblock
 	DefaultMode string `toml:"default_mode"`
 	// Default amount of time to wait if effective mode is "delay" or "requiredelay"
 	DefaultDelay Duration `toml:"default_delay"`
+	// Timeout of requests to SponsorBlock API
+	Timeout Duration `toml:"timeout"`
+	// MaxConcurrentQueries limits the total number of parallel SponsorBlock queries across all feeds (0 - unlimited)
+	MaxConcurrentQueries int `toml:"max_concurrent_queries"`
 	// What to do by default with each category of segments from sponsorblock
-	SponsorBlockCategories SponsorBlockCategories `toml:"sponsorblock_categories`
+	SponsorBlockCategories SponsorBlockCategories `toml:"sponsorblock_categories"`
+	// Other SponsorBlock API categories (e.g. "filler") to query, their segments are cut
+	ExtraCategories StringSlice `toml:"extra_categories"`
+}
+
+// FFmpeg is a configuration of ffmpeg used to post-process episodes
+type FFmpeg struct {
+	// Path to ffmpeg binary (either absolute or looked up in PATH)
+	Path string `toml:"path"`
+	// Path to ffprobe binary used to verify downloads (see verify_downloads)
+	ProbePath string `toml:"probe_path"`
+	// Args is a list of global arguments passed to every ffmpeg invocation (e.g. "-hide_banner")
+	Args []string `toml:"args"`
+}
+
+// Notifications is a configuration of webhooks to call when new episodes are downloaded
+type Notifications struct {
+	// Webhooks is a list of URLs to POST notifications to (e.g. Discord or Slack webhooks)
+	Webhooks []string `toml:"webhooks"`
+	// Template is a Go text/template of the message, with {{.Title}}, {{.FeedID}} and {{.VideoURL}} available
+	Template string `toml:"template"`
+	// Batch sends all new episodes from one update cycle in a single notification
+	Batch bool `toml:"batch"`
+}
+
+// Hooks are commands executed around episode downloads. Episode details are passed via environment
+// variables: PODSYNC_FEED_ID, PODSYNC_EPISODE_ID, PODSYNC_EPISODE_TITLE, PODSYNC_VIDEO_URL, PODSYNC_FILE_NAME
+// and PODSYNC_FILE_PATH (post_download with local storage only)
+type Hooks struct {
+	// PreDownload is a command (executable and its arguments) executed before downloading an episode,
+	// non-zero exit code skips the episode until the next update
+	PreDownload StringSlice `toml:"pre_download"`
+	// PostDownload is a command executed after an episode has been stored, failures are only logged
+	PostDownload StringSlice `toml:"post_download"`
+	// Timeout kills hooks running longer
+	Timeout Duration `toml:"timeout"`
+}
+
+// OPML is a configuration of the generated podsync.opml file
+type OPML struct {
+	// Grouped nests feeds into outlines by their custom category (the OPML is flat by default)
+	Grouped bool `toml:"grouped"`
+}
+
+// Storage is a configuration of episode files storage
+type Storage struct {
+	// Type is either "local" (files are kept in server.data_dir) or "s3"
+	Type model.StorageType `toml:"type"`
+	// Dedupe links episodes already downloaded by other feeds (with the same format settings) instead of downloading them again
+	Dedupe bool `toml:"dedupe"`
+	// S3 is a configuration of S3 compatible object storage (if type is "s3")
+	S3 S3 `toml:"s3"`
+}
+
+// S3 is a configuration of S3 compatible object storage (AWS, MinIO, etc)
+type S3 struct {
+	// Bucket to keep feeds and episodes in
+	Bucket string `toml:"bucket"`
+	// Region of the bucket
+	Region string `toml:"region"`
+	// EndpointURL of S3 compatible service (e.g. MinIO), AWS is used if empty
+	EndpointURL string `toml:"endpoint_url"`
+	// Prefix of object keys
+	Prefix string `toml:"prefix"`
+	// AccessKey and SecretKey are credentials, AWS environment variables or shared credentials file are used if empty
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	// PublicURL is a base URL of objects used in feeds (e.g. CDN), defaults to the bucket URL
+	PublicURL string `toml:"public_url"`
+}
+
+// Network is a configuration of outbound connections (APIs, SponsorBlock and youtube-dl)
+type Network struct {
+	// Proxy is a URL of HTTP(S) or SOCKS proxy, HTTP_PROXY/HTTPS_PROXY environment variables are used if not set
+	Proxy string `toml:"proxy"`
+	// UserAgent overrides User-Agent header of outbound requests
+	UserAgent string `toml:"user_agent"`
+}
+
+// Metrics is a Prometheus metrics configuration
+type Metrics struct {
+	// Enabled exposes metrics at /metrics endpoint
+	Enabled bool `toml:"enabled"`
 }
 
 type Config struct {
@@ -192,6 +553,58 @@ type Config struct {
 	Downloader Downloader `toml:"downloader"`
 	// Global SponsorBlock config
 	SponsorBlock SponsorBlock `toml:"sponsorblock"`
+	// Metrics configuration
+	Metrics Metrics `toml:"metrics"`
+	// FFmpeg configuration
+	FFmpeg FFmpeg `toml:"ffmpeg"`
+	// Notifications configuration
+	Notifications Notifications `toml:"notifications"`
+	// Hooks configuration
+	Hooks Hooks `toml:"hooks"`
+	// OPML configuration
+	OPML OPML `toml:"opml"`
+	// Network configuration
+	Network Network `toml:"network"`
+	// Storage configuration
+	Storage Storage `toml:"storage"`
+
+	// feedsLock guards Feeds, which are replaced when configuration is reloaded
+	feedsLock sync.RWMutex
+}
+
+// Feed returns configuration of the feed, it's safe to call while feeds are being reloaded
+func (c *Config) Feed(id string) (*Feed, bool) {
+	c.feedsLock.RLock()
+	defer c.feedsLock.RUnlock()
+
+	feed, ok := c.Feeds[id]
+	return feed, ok
+}
+
+// FeedList returns configurations of all feeds sorted by ID, it's safe to call while feeds are being reloaded
+func (c *Config) FeedList() []*Feed {
+	c.feedsLock.RLock()
+	defer c.feedsLock.RUnlock()
+
+	feeds := make([]*Feed, 0, len(c.Feeds))
+	for _, feed := range c.Feeds {
+		feeds = append(feeds, feed)
+	}
+
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].ID < feeds[j].ID
+	})
+
+	return feeds
+}
+
+// ReloadFeeds replaces feed configurations with the ones loaded from the updated file.
+// Feed configurations are not modified in place, so running updates keep using the old ones.
+func (c *Config) ReloadFeeds(other *Config) {
+	c.feedsLock.Lock()
+	defer c.feedsLock.Unlock()
+
+	c.Feeds = other.Feeds
 }
 
 // LoadConfig loads TOML configuration from a file path
@@ -201,7 +614,11 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, errors.Wrapf(err, "failed to read config file: %s", path)
 	}
 
-	config := Config{}
+	// Defaults for booleans must be set before unmarshaling, as false can't be told apart from unset
+	config := Config{
+		Server:     Server{Index: true},
+		Downloader: Downloader{SkipLive: true},
+	}
 	if err := toml.Unmarshal(data, &config); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal toml")
 	}
@@ -210,6 +627,10 @@ func LoadConfig(path string) (*Config, error) {
 		feed.ID = id
 	}
 
+	if err := config.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
 	config.applyDefaults(path)
 
 	if err := config.validate(); err != nil {
@@ -222,39 +643,476 @@ func LoadConfig(path string) (*Config, error) {
 func (c *Config) validate() error {
 	var result *multierror.Error
 
-	if c.Server.DataDir == "" {
-		result = multierror.Append(result, errors.New("data directory is required"))
+	switch c.Storage.Type {
+	case model.StorageLocal:
+		if c.Server.DataDir == "" {
+			result = multierror.Append(result, errors.New("data directory is required"))
+		}
+	case model.StorageS3:
+		if c.Storage.S3.Bucket == "" {
+			result = multierror.Append(result, errors.New("storage.s3.bucket is required"))
+		}
+
+		if (c.Storage.S3.AccessKey == "") != (c.Storage.S3.SecretKey == "") {
+			result = multierror.Append(result, errors.New("both storage.s3.access_key and storage.s3.secret_key are required"))
+		}
+	default:
+		result = multierror.Append(result, errors.Errorf("invalid storage.type %q", c.Storage.Type))
+	}
+
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		result = multierror.Append(result, errors.Errorf("invalid log.format %q", c.Log.Format))
+	}
+
+	if c.Server.BindAddress != "" && net.ParseIP(strings.Trim(c.Server.BindAddress, "[]")) == nil {
+		result = multierror.Append(result, errors.Errorf("invalid server.bind_address %q", c.Server.BindAddress))
+	}
+
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		result = multierror.Append(result, errors.New("both server.tls_cert and server.tls_key are required for HTTPS"))
+	} else if c.Server.TLSCert != "" {
+		if _, err := tls.LoadX509KeyPair(c.Server.TLSCert, c.Server.TLSKey); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "failed to load TLS certificate"))
+		}
+	}
+
+	if (c.Server.Username == "") != (c.Server.Password == "") {
+		result = multierror.Append(result, errors.New("both server.username and server.password are required for basic auth"))
 	}
 
 	if len(c.Feeds) == 0 {
 		result = multierror.Append(result, errors.New("at least one feed must be speficied"))
 	}
 
+	if c.Server.MediaHostname != "" && !isValidHostname(c.Server.MediaHostname) {
+		result = multierror.Append(result, errors.Errorf("invalid server.media_hostname %q, expected scheme and host (e.g. https://cdn.example.com)", c.Server.MediaHostname))
+	}
+
+	if c.Downloader.MaxConcurrentDownloads < 0 {
+		result = multierror.Append(result, errors.Errorf("downloader.max_concurrent_downloads %d can't be negative", c.Downloader.MaxConcurrentDownloads))
+	}
+
+	if c.Downloader.DownloadRetries < 0 {
+		result = multierror.Append(result, errors.Errorf("downloader.download_retries %d can't be negative", c.Downloader.DownloadRetries))
+	}
+
+	if c.Downloader.RetryBackoff.Duration < 0 {
+		result = multierror.Append(result, errors.Errorf("downloader.retry_backoff %s can't be negative", c.Downloader.RetryBackoff.Duration))
+	}
+
+	if c.Downloader.UpdateJitter.Duration < 0 {
+		result = multierror.Append(result, errors.Errorf("downloader.update_jitter %s can't be negative", c.Downloader.UpdateJitter.Duration))
+	}
+
 	if !IsValidSponsorblockMode(c.SponsorBlock.DefaultMode, false) {
 		result = multierror.Append(result, errors.Errorf("invalid sponsorblock.default_mode %q", c.SponsorBlock.DefaultMode))
 	}
 
-	//TODO: Check SponsorblockCategories for validity
+	for _, category := range c.SponsorBlock.SponsorBlockCategories.modes() {
+		if !IsValidCategoryMode(category.mode, false) {
+			result = multierror.Append(result, errors.Errorf("invalid sponsorblock.sponsorblock_categories.%s %q", category.name, category.mode))
+		}
+	}
+
+	for _, category := range c.SponsorBlock.ExtraCategories {
+		if strings.TrimSpace(category) == "" {
+			result = multierror.Append(result, errors.New("sponsorblock.extra_categories can't contain empty names"))
+			break
+		}
+	}
+
+	// Default ffmpeg binary is verified by the downloader at startup
+	if c.FFmpeg.Path != model.DefaultFFmpegPath {
+		if _, err := exec.LookPath(c.FFmpeg.Path); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "ffmpeg binary %q is not found or not executable", c.FFmpeg.Path))
+		}
+	}
+
+	for _, hook := range []struct {
+		name    string
+		command StringSlice
+	}{
+		{"pre_download", c.Hooks.PreDownload},
+		{"post_download", c.Hooks.PostDownload},
+	} {
+		if len(hook.command) == 0 {
+			continue
+		}
+		if _, err := exec.LookPath(hook.command[0]); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "hooks.%s command %q is not found or not executable", hook.name, hook.command[0]))
+		}
+	}
+
+	if c.Hooks.Timeout.Duration < 0 {
+		result = multierror.Append(result, errors.Errorf("hooks.timeout %s can't be negative", c.Hooks.Timeout.Duration))
+	}
+
+	if c.FFmpeg.ProbePath != model.DefaultFFprobePath {
+		if _, err := exec.LookPath(c.FFmpeg.ProbePath); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "ffprobe binary %q is not found or not executable", c.FFmpeg.ProbePath))
+		}
+	}
+
+	if c.Downloader.TempDir != "" {
+		if err := checkWritableDir(c.Downloader.TempDir); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "downloader.temp_dir %q is not usable", c.Downloader.TempDir))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Downloader.HTTPHeaders) {
+		if err := validateHeader(name, c.Downloader.HTTPHeaders[name]); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "invalid downloader.http_headers"))
+		}
+	}
+
+	if c.Downloader.External != "" {
+		if _, err := exec.LookPath(c.Downloader.External); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "external downloader %q is not found or not executable", c.Downloader.External))
+		}
+	} else if len(c.Downloader.ExternalArgs) > 0 {
+		result = multierror.Append(result, errors.New("downloader.external_args require downloader.external"))
+	}
+
+	if c.Network.Proxy != "" {
+		if proxy, err := url.Parse(c.Network.Proxy); err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			result = multierror.Append(result, errors.Errorf("invalid network.proxy %q", c.Network.Proxy))
+		}
+	}
 
 	for id, feed := range c.Feeds {
 		if feed.URL == "" {
 			result = multierror.Append(result, errors.Errorf("URL is required for %q", id))
 		}
 
+		if feed.SourceFeed != "" {
+			source, ok := c.Feeds[feed.SourceFeed]
+			if !ok || feed.SourceFeed == id {
+				result = multierror.Append(result, errors.Errorf("source_feed %q of feed %q is not found", feed.SourceFeed, id))
+			} else if source.SourceFeed != "" {
+				result = multierror.Append(result, errors.Errorf("source_feed %q of feed %q can't have a source feed itself", feed.SourceFeed, id))
+			} else if feed.Format == model.FormatVideo && source.Format == model.FormatAudio {
+				result = multierror.Append(result, errors.Errorf("video feed %q can't be transcoded from audio feed %q", id, feed.SourceFeed))
+			}
+
+			// Parts split by the source feed are transcoded instead
+			if feed.SplitByChapters {
+				result = multierror.Append(result, errors.Errorf("split_by_chapters of feed %q can't be combined with source_feed", id))
+			}
+		}
+
+		// Split episodes are never cleaned, so their originals would be kept forever
+		if feed.KeepOriginal && feed.SplitByChapters {
+			result = multierror.Append(result, errors.Errorf("keep_original of feed %q can't be combined with split_by_chapters", id))
+		}
+
+		switch feed.PageSizeMode {
+		case model.PageSizeQueued, model.PageSizeScanned:
+		default:
+			result = multierror.Append(result, errors.Errorf("invalid page_size_mode %q for feed %q", feed.PageSizeMode, id))
+		}
+
+		switch feed.DownloadOrder {
+		case model.DownloadOrderNewestFirst, model.DownloadOrderOldestFirst:
+		default:
+			result = multierror.Append(result, errors.Errorf("invalid download_order %q for feed %q", feed.DownloadOrder, id))
+		}
+
+		switch feed.OrderBy {
+		case model.OrderByPubDate:
+			if feed.OrderPattern != "" {
+				result = multierror.Append(result, errors.Errorf("order_pattern of feed %q requires order_by = %q", id, model.OrderByTitleRegex))
+			}
+		case model.OrderByTitleRegex:
+			feed.OrderRegexp = nil
+			if compiled, err := regexp.Compile(feed.OrderPattern); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid order_pattern %q for feed %q", feed.OrderPattern, id))
+			} else if compiled.NumSubexp() == 0 {
+				result = multierror.Append(result, errors.Errorf("order_pattern %q for feed %q must have a capture group", feed.OrderPattern, id))
+			} else {
+				feed.OrderRegexp = compiled
+			}
+		default:
+			result = multierror.Append(result, errors.Errorf("invalid order_by %q for feed %q", feed.OrderBy, id))
+		}
+
+		feed.EpisodeNumberRegexp, feed.SeasonNumberRegexp = nil, nil
+		for _, number := range []struct {
+			name     string
+			pattern  string
+			compiled **regexp.Regexp
+		}{
+			{"episode_number_regex", feed.EpisodeNumberRegex, &feed.EpisodeNumberRegexp},
+			{"season_number_regex", feed.SeasonNumberRegex, &feed.SeasonNumberRegexp},
+		} {
+			if number.pattern == "" {
+				continue
+			}
+
+			if compiled, err := regexp.Compile(number.pattern); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid %s %q for feed %q", number.name, number.pattern, id))
+			} else if compiled.NumSubexp() == 0 {
+				result = multierror.Append(result, errors.Errorf("%s %q for feed %q must have a capture group", number.name, number.pattern, id))
+			} else {
+				*number.compiled = compiled
+			}
+		}
+
+		switch feed.AudioCodec {
+		case model.AudioCodecMP3, model.AudioCodecAAC, model.AudioCodecOpus:
+		default:
+			result = multierror.Append(result, errors.Errorf("invalid audio_codec %q for feed %q", feed.AudioCodec, id))
+		}
+
+		if feed.FeedLimit < 0 {
+			result = multierror.Append(result, errors.Errorf("feed_limit %d for feed %q can't be negative", feed.FeedLimit, id))
+		}
+
+		if feed.Concurrency < 0 {
+			result = multierror.Append(result, errors.Errorf("concurrency %d for feed %q can't be negative", feed.Concurrency, id))
+		}
+
+		if feed.AudioBitrate < 0 {
+			result = multierror.Append(result, errors.Errorf("audio_bitrate %d for feed %q can't be negative", feed.AudioBitrate, id))
+		}
+
+		if _, err := feed.Schedule(); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid cron_schedule %q for feed %q", feed.CronSchedule, id))
+		}
+
+		if feed.FormatSelector != "" && feed.MaxHeight > 0 {
+			result = multierror.Append(result, errors.Errorf("format_selector and max_height can't be used together for feed %q", id))
+		}
+
+		// Range supported by ffmpeg's loudnorm filter
+		if feed.NormalizeAudio && (feed.LoudnessTarget < -70 || feed.LoudnessTarget > -5) {
+			result = multierror.Append(result, errors.Errorf("loudness_target %d for feed %q must be between -70 and -5 LUFS", feed.LoudnessTarget, id))
+		}
+
+		// Inherited server.media_hostname is reported once
+		if feed.MediaHostname != c.Server.MediaHostname && !isValidHostname(feed.MediaHostname) {
+			result = multierror.Append(result, errors.Errorf("invalid media_hostname %q for feed %q", feed.MediaHostname, id))
+		}
+
+		if feed.Cookies != "" {
+			if _, err := os.Stat(feed.Cookies); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "cookies file %q for feed %q is not accessible", feed.Cookies, id))
+			}
+		}
+
+		for _, name := range sortedKeys(feed.HTTPHeaders) {
+			// Inherited downloader.http_headers are reported once
+			if inherited, ok := c.Downloader.HTTPHeaders[name]; ok && inherited == feed.HTTPHeaders[name] {
+				continue
+			}
+			if err := validateHeader(name, feed.HTTPHeaders[name]); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid http_headers of feed %q", id))
+			}
+		}
+
+		if feed.APILanguage != "" && !apiLanguagePattern.MatchString(feed.APILanguage) {
+			result = multierror.Append(result, errors.Errorf("invalid api_language %q for feed %q", feed.APILanguage, id))
+		}
+
+		if feed.APIRegion != "" && !apiRegionPattern.MatchString(feed.APIRegion) {
+			result = multierror.Append(result, errors.Errorf("invalid api_region %q for feed %q, two letter country code is expected", feed.APIRegion, id))
+		}
+
+		if err := feed.Filters.compile(); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "invalid filters for feed %q", id))
+		}
+
+		if feed.OutputTemplate != "" {
+			if !strings.Contains(feed.OutputTemplate, "%(ext)s") {
+				result = multierror.Append(result, errors.Errorf("output_template of feed %q must contain %%(ext)s", id))
+			}
+			if strings.ContainsAny(feed.OutputTemplate, `/\`) {
+				result = multierror.Append(result, errors.Errorf("output_template of feed %q must be a file name without directories", id))
+			}
+		}
+
+		if feed.FilenameTemplate != "" {
+			if _, err := template.New("filename").Parse(feed.FilenameTemplate); err != nil {
+				result = multierror.Append(result, errors.Wrapf(err, "invalid filename_template for feed %q", id))
+			}
+		}
+
 		if !IsValidSponsorblockMode(feed.SponsorblockMode, true) {
 			result = multierror.Append(result, errors.Errorf("Invalid sponsorblock_mode %q for feed %q", feed.SponsorblockMode, id))
 		}
+
+		for _, category := range feed.SponsorBlockCategories.modes() {
+			if !IsValidCategoryMode(category.mode, true) {
+				result = multierror.Append(result, errors.Errorf("invalid sponsorblock_categories.%s %q for feed %q", category.name, category.mode, id))
+			}
+		}
 	}
 
+	// Feed IDs name directories in storage, IDs differing only by case share a directory on case insensitive
+	// file systems (default on macOS and Windows), so episodes of one feed would overwrite the other's
+	dirs := map[string][]string{}
+	for id := range c.Feeds {
+		if id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+			result = multierror.Append(result, errors.Errorf("feed id %q can't be used as a directory name", id))
+			continue
+		}
+
+		dir := strings.ToLower(id)
+		dirs[dir] = append(dirs[dir], id)
+	}
+
+	for _, ids := range sortedGroups(dirs) {
+		result = multierror.Append(result, errors.Errorf("feed ids %s differ only by case, their files would collide", quoteList(ids)))
+	}
+
+	c.warnDuplicateURLs()
+
 	return result.ErrorOrNil()
 }
 
+// warnDuplicateURLs warns about feeds downloading the same files twice. Feeds of the same URL are fine
+// otherwise (e.g. audio and video feeds of a channel, or a channel split by filters)
+func (c *Config) warnDuplicateURLs() {
+	if c.Storage.Dedupe {
+		return
+	}
+
+	dups := map[string][]string{}
+	for id, feed := range c.Feeds {
+		if feed.SourceFeed != "" {
+			continue
+		}
+
+		key := fmt.Sprintf("%s %s %s", strings.TrimSuffix(feed.URL, "/"), feed.Format, feed.Quality)
+		dups[key] = append(dups[key], id)
+	}
+
+	for _, ids := range sortedGroups(dups) {
+		// Feeds split by duration (e.g. clips and full episodes) have no episodes in common
+		var overlapping []string
+		for _, id := range ids {
+			for _, other := range ids {
+				if id != other && durationsOverlap(c.Feeds[id].Filters, c.Feeds[other].Filters) {
+					overlapping = append(overlapping, id)
+					break
+				}
+			}
+		}
+
+		if len(overlapping) > 1 {
+			log.Warnf("feeds %s have the same URL, format and quality, their episodes are downloaded separately (enable storage.dedupe to link them instead)", quoteList(overlapping))
+		}
+	}
+}
+
+// durationsOverlap checks whether an episode can pass duration filters of both feeds, bounds are inclusive
+func durationsOverlap(a, b Filters) bool {
+	if a.MaxDuration.Duration > 0 && a.MaxDuration.Duration < b.MinDuration.Duration {
+		return false
+	}
+
+	if b.MaxDuration.Duration > 0 && b.MaxDuration.Duration < a.MinDuration.Duration {
+		return false
+	}
+
+	return true
+}
+
+var (
+	// Language tags accepted by YouTube API (e.g. "de" or "zh-Hant")
+	apiLanguagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+	apiRegionPattern   = regexp.MustCompile(`^[a-zA-Z]{2}$`)
+)
+
+// checkWritableDir makes sure the directory exists and files can be created in it
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+
+	f, err := ioutil.TempFile(dir, ".podsync-check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// validateHeader checks the HTTP header passed to the downloader
+func validateHeader(name, value string) error {
+	if !httpguts.ValidHeaderFieldName(name) {
+		return errors.Errorf("%q is not a valid header name", name)
+	}
+
+	if !httpguts.ValidHeaderFieldValue(value) {
+		return errors.Errorf("value of header %q contains invalid characters", name)
+	}
+
+	return nil
+}
+
+// hasHeader checks whether the header is set, names are case insensitive
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedGroups returns sorted groups with more than one ID, ordered by their first ID
+func sortedGroups(groups map[string][]string) [][]string {
+	var result [][]string
+
+	for _, ids := range groups {
+		if len(ids) > 1 {
+			sort.Strings(ids)
+			result = append(result, ids)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+func quoteList(ids []string) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = strconv.Quote(id)
+	}
+	return strings.Join(quoted, ", ")
+}
+
 func (c *Config) applyDefaults(configPath string) {
 	if c.Server.Hostname == "" {
-		if c.Server.Port != 0 && c.Server.Port != 80 {
-			c.Server.Hostname = fmt.Sprintf("http://localhost:%d", c.Server.Port)
+		scheme, defaultPort := "http", 80
+		if c.Server.TLSCert != "" {
+			scheme, defaultPort = "https", 443
+		}
+
+		if c.Server.Port != 0 && c.Server.Port != defaultPort {
+			c.Server.Hostname = fmt.Sprintf("%s://localhost:%d", scheme, c.Server.Port)
 		} else {
-			c.Server.Hostname = "http://localhost"
+			c.Server.Hostname = fmt.Sprintf("%s://localhost", scheme)
 		}
 	}
 
@@ -270,12 +1128,54 @@ func (c *Config) applyDefaults(configPath string) {
 		}
 	}
 
+	if c.Log.Format == "" {
+		c.Log.Format = model.DefaultLogFormat
+	}
+
+	if c.Downloader.RetryBackoff.Duration == 0 {
+		c.Downloader.RetryBackoff.Duration = model.DefaultRetryBackoff
+	}
+
+	if c.Downloader.ShutdownTimeout.Duration == 0 {
+		c.Downloader.ShutdownTimeout.Duration = model.DefaultShutdownTimeout
+	}
+
+	if c.Hooks.Timeout.Duration == 0 {
+		c.Hooks.Timeout.Duration = model.DefaultHookTimeout
+	}
+
+	if c.FFmpeg.Path == "" {
+		c.FFmpeg.Path = model.DefaultFFmpegPath
+	}
+
+	if c.FFmpeg.ProbePath == "" {
+		c.FFmpeg.ProbePath = model.DefaultFFprobePath
+	}
+
+	if c.Storage.Type == "" {
+		c.Storage.Type = model.DefaultStorageType
+	}
+
 	if c.Database.Dir == "" {
 		c.Database.Dir = filepath.Join(filepath.Dir(configPath), "db")
 	}
 
-	if c.SponsorBlock.ApiUrl == "" {
-		c.SponsorBlock.ApiUrl = "https://sponsor.ajay.app"
+	// Temp directories are often wiped on reboot, partial downloads have to survive restarts
+	if c.Downloader.PartialDir == "" {
+		c.Downloader.PartialDir = filepath.Join(c.Database.Dir, "partial")
+	}
+
+	if c.SponsorBlock.ApiUrl == "" && len(c.SponsorBlock.ApiUrls) == 0 {
+		c.SponsorBlock.ApiUrl = model.DefaultSponsorBlockURL
+	}
+
+	// Single url is kept for backward compatibility, it's tried first
+	if c.SponsorBlock.ApiUrl != "" {
+		c.SponsorBlock.ApiUrls = append(StringSlice{c.SponsorBlock.ApiUrl}, c.SponsorBlock.ApiUrls...)
+	}
+
+	if c.SponsorBlock.Timeout.Duration == 0 {
+		c.SponsorBlock.Timeout.Duration = model.DefaultSponsorBlockTimeout
 	}
 
 	if c.SponsorBlock.DefaultMode == "" {
@@ -307,6 +1207,26 @@ func (c *Config) applyDefaults(configPath string) {
 		c.SponsorBlock.SponsorBlockCategories.NonmusicSections = "cut"
 	}
 
+	// Filler and preview used to be cut via extra_categories only
+	for _, category := range []struct {
+		name string
+		mode *string
+	}{
+		{"filler", &c.SponsorBlock.SponsorBlockCategories.Filler},
+		{"preview", &c.SponsorBlock.SponsorBlockCategories.Preview},
+	} {
+		if *category.mode != "" {
+			continue
+		}
+
+		*category.mode = "keep"
+		for _, extra := range c.SponsorBlock.ExtraCategories {
+			if extra == category.name {
+				*category.mode = "cut"
+			}
+		}
+	}
+
 	for _, feed := range c.Feeds {
 		if feed.UpdatePeriod.Duration == 0 {
 			feed.UpdatePeriod.Duration = model.DefaultUpdatePeriod
@@ -324,6 +1244,59 @@ func (c *Config) applyDefaults(configPath string) {
 			feed.PageSize = model.DefaultPageSize
 		}
 
+		if feed.Concurrency == 0 {
+			feed.Concurrency = model.DefaultConcurrency
+		}
+
+		if feed.PageSizeMode == "" {
+			feed.PageSizeMode = model.DefaultPageSizeMode
+		}
+
+		if feed.DownloadOrder == "" {
+			feed.DownloadOrder = model.DefaultDownloadOrder
+		}
+
+		if feed.OrderBy == "" {
+			feed.OrderBy = model.DefaultOrderBy
+		}
+
+		if feed.RateLimit == 0 {
+			feed.RateLimit = c.Downloader.RateLimit
+		}
+
+		if feed.Cookies == "" {
+			feed.Cookies = c.Downloader.Cookies
+		}
+
+		for name, value := range c.Downloader.HTTPHeaders {
+			if hasHeader(feed.HTTPHeaders, name) {
+				continue
+			}
+			if feed.HTTPHeaders == nil {
+				feed.HTTPHeaders = map[string]string{}
+			}
+			feed.HTTPHeaders[name] = value
+		}
+
+		if feed.MediaHostname == "" {
+			feed.MediaHostname = c.Server.MediaHostname
+		}
+
+		if feed.LoudnessTarget == 0 {
+			feed.LoudnessTarget = model.DefaultLoudnessTarget
+		}
+
+		if feed.AudioCodec == "" {
+			feed.AudioCodec = model.DefaultAudioCodec
+		}
+
+		// Renditions serve the same episodes as the source feed
+		if feed.URL == "" && feed.SourceFeed != "" {
+			if source, ok := c.Feeds[feed.SourceFeed]; ok {
+				feed.URL = source.URL
+			}
+		}
+
 		zeroDuration := Duration{}
 		if feed.SponsorblockDelay == zeroDuration {
 			feed.SponsorblockDelay = c.SponsorBlock.DefaultDelay
@@ -356,5 +1329,13 @@ func (c *Config) applyDefaults(configPath string) {
 		if feed.SponsorBlockCategories.NonmusicSections == "" || feed.SponsorBlockCategories.NonmusicSections == "default" {
 			feed.SponsorBlockCategories.NonmusicSections = c.SponsorBlock.SponsorBlockCategories.NonmusicSections
 		}
+
+		if feed.SponsorBlockCategories.Filler == "" || feed.SponsorBlockCategories.Filler == "default" {
+			feed.SponsorBlockCategories.Filler = c.SponsorBlock.SponsorBlockCategories.Filler
+		}
+
+		if feed.SponsorBlockCategories.Preview == "" || feed.SponsorBlockCategories.Preview == "default" {
+			feed.SponsorBlockCategories.Preview = c.SponsorBlock.SponsorBlockCategories.Preview
+		}
 	}
 }
@@ -1,11 +1,16 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -24,22 +29,42 @@ vimeo = [
 [server]
 port = 80
 data_dir = "test/data/"
+index = false
 
 [database]
 dir = "/home/user/db/"
 
 [downloader]
 self_update = true
+max_concurrent_downloads = 3
+download_retries = 2
+retry_backoff = "30s"
+rate_limit = "2M"
+
+[metrics]
+enabled = true
+
+[opml]
+grouped = true
+
+[sponsorblock]
+max_concurrent_queries = 2
 
 [feeds]
   [feeds.XYZ]
   url = "https://youtube.com/watch?v=ygIUF678y40"
   page_size = 48
+  backfill = true
+  latest_only = true
   update_period = "5h"
   format = "audio"
   quality = "low"
-  filters = { title = "regex for title here" }
-  clean = { keep_last = 10 }
+  concurrency = 2
+  download_order = "oldest_first"
+  page_size_mode = "scanned"
+  exclude_ids = "dQw4w9WgXcQ"
+  filters = { title = "regex for title here", min_duration = "10m", max_duration = "2h", min_date = "2023-01-01", max_date = "2023-06-30T12:00:00Z" }
+  clean = { keep_last = 10, max_size = "10G" }
   custom = { cover_art = "http://img", category = "TV", explicit = true, lang = "en" }
 `
 	path := setup(t, file)
@@ -53,6 +78,8 @@ self_update = true
 	assert.EqualValues(t, 80, config.Server.Port)
 
 	assert.Equal(t, "/home/user/db/", config.Database.Dir)
+	assert.True(t, config.OPML.Grouped)
+	assert.False(t, config.Server.Index)
 
 	require.Len(t, config.Tokens["youtube"], 1)
 	assert.Equal(t, "123", config.Tokens["youtube"][0])
@@ -65,11 +92,23 @@ self_update = true
 	assert.True(t, ok)
 	assert.Equal(t, "https://youtube.com/watch?v=ygIUF678y40", feed.URL)
 	assert.EqualValues(t, 48, feed.PageSize)
+	assert.True(t, feed.Backfill)
+	assert.True(t, feed.LatestOnly)
 	assert.EqualValues(t, Duration{5 * time.Hour}, feed.UpdatePeriod)
 	assert.EqualValues(t, "audio", feed.Format)
 	assert.EqualValues(t, "low", feed.Quality)
+	assert.EqualValues(t, 2, feed.Concurrency)
+	assert.EqualValues(t, "oldest_first", feed.DownloadOrder)
+	assert.EqualValues(t, "scanned", feed.PageSizeMode)
+	assert.Equal(t, StringSlice{"dQw4w9WgXcQ"}, feed.ExcludeIDs)
+	assert.Empty(t, feed.IncludeIDs)
 	assert.EqualValues(t, "regex for title here", feed.Filters.Title)
+	assert.EqualValues(t, Duration{10 * time.Minute}, feed.Filters.MinDuration)
+	assert.EqualValues(t, Duration{2 * time.Hour}, feed.Filters.MaxDuration)
+	assert.True(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Equal(feed.Filters.MinDate.Time))
+	assert.True(t, time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC).Equal(feed.Filters.MaxDate.Time))
 	assert.EqualValues(t, 10, feed.Clean.KeepLast)
+	assert.EqualValues(t, 10*1024*1024*1024, feed.Clean.MaxSize)
 
 	assert.EqualValues(t, "http://img", feed.Custom.CoverArt)
 	assert.EqualValues(t, "TV", feed.Custom.Category)
@@ -79,6 +118,13 @@ self_update = true
 	assert.Nil(t, config.Database.Badger)
 
 	assert.True(t, config.Downloader.SelfUpdate)
+	assert.EqualValues(t, 3, config.Downloader.MaxConcurrentDownloads)
+	assert.EqualValues(t, 2, config.SponsorBlock.MaxConcurrentQueries)
+	assert.True(t, config.Metrics.Enabled)
+	assert.EqualValues(t, 2, config.Downloader.DownloadRetries)
+	assert.EqualValues(t, 2*1024*1024, config.Downloader.RateLimit)
+	assert.EqualValues(t, 2*1024*1024, feed.RateLimit)
+	assert.EqualValues(t, Duration{30 * time.Second}, config.Downloader.RetryBackoff)
 }
 
 func TestLoadEmptyKeyList(t *testing.T) {
@@ -127,6 +173,14 @@ data_dir = "/data"
 	assert.EqualValues(t, feed.PageSize, 50)
 	assert.EqualValues(t, feed.Quality, "high")
 	assert.EqualValues(t, feed.Format, "video")
+	assert.EqualValues(t, feed.Concurrency, 1)
+	assert.EqualValues(t, feed.DownloadOrder, "newest_first")
+	assert.EqualValues(t, feed.PageSizeMode, "queued")
+	assert.False(t, config.OPML.Grouped)
+	assert.True(t, config.Server.Index)
+	assert.True(t, config.Downloader.SkipLive)
+	assert.EqualValues(t, model.DefaultShutdownTimeout, config.Downloader.ShutdownTimeout.Duration)
+	assert.EqualValues(t, model.DefaultLogFormat, config.Log.Format)
 }
 
 func TestDefaultHostname(t *testing.T) {
@@ -152,25 +206,269 @@ func TestDefaultHostname(t *testing.T) {
 		cfg.applyDefaults("")
 		assert.Equal(t, "https://my.host:4443", cfg.Server.Hostname)
 	})
+
+	t.Run("empty hostname with TLS", func(t *testing.T) {
+		cfg.Server.Hostname = ""
+		cfg.Server.Port = 443
+		cfg.Server.TLSCert = "cert.pem"
+		cfg.applyDefaults("")
+		assert.Equal(t, "https://localhost", cfg.Server.Hostname)
+	})
+
+	t.Run("empty hostname with TLS and port", func(t *testing.T) {
+		cfg.Server.Hostname = ""
+		cfg.Server.Port = 8443
+		cfg.applyDefaults("")
+		assert.Equal(t, "https://localhost:8443", cfg.Server.Hostname)
+	})
 }
 
-func TestDefaultDatabasePath(t *testing.T) {
-	cfg := Config{}
-	cfg.applyDefaults("/home/user/podsync/config.toml")
-	assert.Equal(t, "/home/user/podsync/db", cfg.Database.Dir)
+func TestMediaHostname(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+media_hostname = "https://cdn.example.com"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  media_hostname = "https://other.example.com/media"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost", config.Server.Hostname)
+	assert.Equal(t, "https://cdn.example.com", config.Feeds["A"].MediaHostname)
+	assert.Equal(t, "https://other.example.com/media", config.Feeds["B"].MediaHostname)
+
+	invalid := setup(t, strings.NewReplacer(`"https://cdn.example.com"`, `"cdn.example.com"`, `"https://other.example.com/media"`, `"ftp://other.example.com"`).Replace(file))
+	defer os.Remove(invalid)
+
+	_, err = LoadConfig(invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid server.media_hostname "cdn.example.com"`)
+	assert.Contains(t, err.Error(), `invalid media_hostname "ftp://other.example.com" for feed "B"`)
+	assert.NotContains(t, err.Error(), `for feed "A"`)
 }
 
-func TestLoadBadgerConfig(t *testing.T) {
+func TestFeedIDCollision(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.Podcast]
+  url = "https://youtube.com/channel/a"
+
+  [feeds.podcast]
+  url = "https://youtube.com/channel/b"
+
+  [feeds."a/b"]
+  url = "https://youtube.com/channel/c"
+
+  [feeds.".."]
+  url = "https://youtube.com/channel/d"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `feed ids "Podcast", "podcast" differ only by case`)
+	assert.Contains(t, err.Error(), `feed id "a/b" can't be used as a directory name`)
+	assert.Contains(t, err.Error(), `feed id ".." can't be used as a directory name`)
+
+	// Same ID can't be configured twice
+	duplicate := setup(t, strings.Replace(file, "[feeds.podcast]", "[feeds.Podcast]", 1))
+	defer os.Remove(duplicate)
+
+	_, err = LoadConfig(duplicate)
+	require.Error(t, err)
+}
+
+func TestDuplicateFeedURL(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/channel/a"
+
+  [feeds.B]
+  url = "https://youtube.com/channel/a/"
+
+  [feeds.C]
+  url = "https://youtube.com/channel/a"
+  format = "audio"
+
+  [feeds.D]
+  url = "https://youtube.com/channel/d"
+  filters = { max_duration = "2m" }
+
+  [feeds.E]
+  url = "https://youtube.com/channel/d"
+  filters = { min_duration = "3m" }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	_, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+	assert.Contains(t, hook.LastEntry().Message, `feeds "A", "B" have the same URL`)
+
+	// Files are linked with dedupe
+	hook.Reset()
+	dedupe := setup(t, file+"\n[storage]\ndedupe = true\n")
+	defer os.Remove(dedupe)
+
+	_, err = LoadConfig(dedupe)
+	require.NoError(t, err)
+	assert.Empty(t, hook.AllEntries())
+}
+
+func TestInvalidTLS(t *testing.T) {
+	tests := []struct {
+		name   string
+		server string
+		expect string
+	}{
+		{
+			name:   "Missing key",
+			server: `tls_cert = "/nonexistent/cert.pem"`,
+			expect: "both server.tls_cert and server.tls_key are required for HTTPS",
+		},
+		{
+			name:   "Missing files",
+			server: "tls_cert = \"/nonexistent/cert.pem\"\ntls_key = \"/nonexistent/key.pem\"",
+			expect: "failed to load TLS certificate",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			file := fmt.Sprintf(`
+[server]
+data_dir = "/data"
+%s
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`, tst.server)
+			path := setup(t, file)
+			defer os.Remove(path)
+
+			_, err := LoadConfig(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tst.expect)
+		})
+	}
+}
+
+func TestHooks(t *testing.T) {
 	const file = `
 [server]
 data_dir = "/data"
 
+[hooks]
+post_download = ["sh", "-c", "echo done"]
+
 [feeds]
   [feeds.A]
   url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
 
-[database]
-  badger = { truncate = true, file_io = true }
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Empty(t, config.Hooks.PreDownload)
+	assert.Equal(t, StringSlice{"sh", "-c", "echo done"}, config.Hooks.PostDownload)
+	assert.Equal(t, model.DefaultHookTimeout, config.Hooks.Timeout.Duration)
+
+	invalid := setup(t, strings.Replace(file, `post_download = ["sh"`, `timeout = "-1s"`+"\n"+`pre_download = "/nonexistent/hook.sh"`+"\n"+`post_download = ["sh"`, 1))
+	defer os.Remove(invalid)
+
+	_, err = LoadConfig(invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `hooks.pre_download command "/nonexistent/hook.sh" is not found`)
+	assert.Contains(t, err.Error(), "hooks.timeout -1s can't be negative")
+}
+
+func TestSecrets(t *testing.T) {
+	secret, err := ioutil.TempFile("", "podsync-secret-")
+	require.NoError(t, err)
+	defer os.Remove(secret.Name())
+
+	_, err = secret.WriteString("from-file\n")
+	require.NoError(t, err)
+	require.NoError(t, secret.Close())
+
+	os.Setenv("PODSYNC_TEST_TOKEN", "from-env")
+	defer os.Unsetenv("PODSYNC_TEST_TOKEN")
+
+	file := `
+[server]
+data_dir = "/data"
+username = "user"
+password = "file:` + secret.Name() + `"
+auth_token = "plain"
+
+[tokens]
+youtube = ["env:PODSYNC_TEST_TOKEN", "file:` + secret.Name() + `"]
+
+[storage]
+  [storage.s3]
+  access_key = "env:PODSYNC_TEST_TOKEN"
+  secret_key = "file:` + secret.Name() + `"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, StringSlice{"from-env", "from-file"}, config.Tokens[model.ProviderYoutube])
+	assert.Equal(t, "from-file", config.Server.Password)
+	assert.Equal(t, "plain", config.Server.AuthToken)
+	assert.Equal(t, "from-env", config.Storage.S3.AccessKey)
+	assert.Equal(t, "from-file", config.Storage.S3.SecretKey)
+
+	invalid := setup(t, strings.NewReplacer("env:PODSYNC_TEST_TOKEN", "env:PODSYNC_TEST_MISSING", secret.Name(), "/nonexistent/secret").Replace(file))
+	defer os.Remove(invalid)
+
+	_, err = LoadConfig(invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `failed to resolve tokens.youtube: environment variable "PODSYNC_TEST_MISSING" is not set`)
+	assert.Contains(t, err.Error(), `failed to resolve server.password: failed to read secret file "/nonexistent/secret"`)
+	assert.Contains(t, err.Error(), "failed to resolve storage.s3.secret_key")
+}
+
+func TestLoadFFmpegConfig(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+[ffmpeg]
+args = [ "-hide_banner" ]
 `
 	path := setup(t, file)
 	defer os.Remove(path)
@@ -178,10 +476,1085 @@ data_dir = "/data"
 	config, err := LoadConfig(path)
 	assert.NoError(t, err)
 	require.NotNil(t, config)
-	require.NotNil(t, config.Database.Badger)
 
-	assert.True(t, config.Database.Badger.Truncate)
-	assert.True(t, config.Database.Badger.FileIO)
+	assert.Equal(t, "ffmpeg", config.FFmpeg.Path)
+	assert.Equal(t, "ffprobe", config.FFmpeg.ProbePath)
+	assert.EqualValues(t, []string{"-hide_banner"}, config.FFmpeg.Args)
+}
+
+func TestInvalidFFmpegPath(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+[ffmpeg]
+path = "/nonexistent/ffmpeg"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestSponsorBlockURLs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		expect StringSlice
+	}{
+		{name: "Default", config: "", expect: StringSlice{"https://sponsor.ajay.app"}},
+		{name: "Single URL", config: `url = "https://a"`, expect: StringSlice{"https://a"}},
+		{name: "Mirrors", config: `urls = ["https://a", "https://b"]`, expect: StringSlice{"https://a", "https://b"}},
+		{name: "Both", config: "url = \"https://a\"\nurls = [\"https://b\"]", expect: StringSlice{"https://a", "https://b"}},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			file := `
+[server]
+data_dir = "/data"
+
+[sponsorblock]
+` + tst.config + `
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+			path := setup(t, file)
+			defer os.Remove(path)
+
+			config, err := LoadConfig(path)
+			require.NoError(t, err)
+			assert.Equal(t, tst.expect, config.SponsorBlock.ApiUrls)
+		})
+	}
+}
+
+func TestSponsorBlockCategories(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[sponsorblock.sponsorblock_categories]
+preview = "mute"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  sponsorblock_categories = { filler = "cut", preview = "default" }
+
+  [feeds.C]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  sponsorblock_categories = { filler = "skip" }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid sponsorblock_categories.filler "skip" for feed "C"`)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(file, `"skip"`, `"keep"`, 1)), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	// Kept by default, like in SponsorBlock
+	assert.Equal(t, "keep", config.SponsorBlock.SponsorBlockCategories.Filler)
+	assert.Equal(t, "keep", config.Feeds["A"].SponsorBlockCategories.Filler)
+	assert.Equal(t, "mute", config.Feeds["A"].SponsorBlockCategories.Preview)
+	assert.Equal(t, "cut", config.Feeds["B"].SponsorBlockCategories.Filler)
+	assert.Equal(t, "mute", config.Feeds["B"].SponsorBlockCategories.Preview)
+}
+
+func TestSponsorBlockExtraCategories(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[sponsorblock]
+extra_categories = ["filler", "preview"]
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, StringSlice{"filler", "preview"}, config.SponsorBlock.ExtraCategories)
+
+	// Categories cut via extra_categories before they had their own settings are still cut
+	assert.Equal(t, "cut", config.SponsorBlock.SponsorBlockCategories.Filler)
+	assert.Equal(t, "cut", config.Feeds["A"].SponsorBlockCategories.Preview)
+
+	invalid := setup(t, strings.Replace(file, `"preview"`, `" "`, 1))
+	defer os.Remove(invalid)
+
+	_, err = LoadConfig(invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sponsorblock.extra_categories can't contain empty names")
+}
+
+func TestInvalidSponsorBlockCategories(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[sponsorblock]
+  sponsorblock_categories = { sponsors = "delete" }
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  sponsorblock_categories = { endcards = "remove", intermissions = "mute" }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `sponsorblock.sponsorblock_categories.sponsors "delete"`)
+	assert.Contains(t, err.Error(), `sponsorblock_categories.endcards "remove" for feed "A"`)
+	assert.NotContains(t, err.Error(), "intermissions")
+}
+
+func TestInvalidFilenameTemplate(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  filename_template = "{{.Title"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid filename_template for feed "A"`)
+}
+
+func TestInvalidOutputTemplate(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  output_template = "%(title)s"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  output_template = "../%(title)s.%(ext)s"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `output_template of feed "A" must contain %(ext)s`)
+	assert.Contains(t, err.Error(), `output_template of feed "B" must be a file name without directories`)
+}
+
+func TestOrderBy(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  order_by = "title_regex"
+  order_pattern = 'Part (\d+)'
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderByPubDate, config.Feeds["A"].OrderBy)
+	assert.Nil(t, config.Feeds["A"].OrderRegexp)
+	assert.Equal(t, model.OrderByTitleRegex, config.Feeds["B"].OrderBy)
+	require.NotNil(t, config.Feeds["B"].OrderRegexp)
+	assert.Equal(t, `Part (\d+)`, config.Feeds["B"].OrderRegexp.String())
+}
+
+func TestEpisodeNumberRegex(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  episode_number_regex = 'E(\d+)'
+  season_number_regex = 'S(\d+)'
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  episode_number_regex = 'E\d+'
+  season_number_regex = 'S(\d+'
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `episode_number_regex "E\\d+" for feed "B" must have a capture group`)
+	assert.Contains(t, err.Error(), `invalid season_number_regex "S(\\d+" for feed "B"`)
+	assert.NotContains(t, err.Error(), `feed "A"`)
+
+	const valid = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  episode_number_regex = 'E(\d+)'
+`
+	path = setup(t, valid)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.NotNil(t, config.Feeds["A"].EpisodeNumberRegexp)
+	assert.Equal(t, `E(\d+)`, config.Feeds["A"].EpisodeNumberRegexp.String())
+	assert.Nil(t, config.Feeds["A"].SeasonNumberRegexp)
+}
+
+func TestInvalidOrderBy(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  order_by = "title"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  order_by = "title_regex"
+  order_pattern = 'Part \d+'
+
+  [feeds.C]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  order_by = "title_regex"
+  order_pattern = '(\d+'
+
+  [feeds.D]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  order_pattern = '(\d+)'
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid order_by "title" for feed "A"`)
+	assert.Contains(t, err.Error(), `order_pattern "Part \\d+" for feed "B" must have a capture group`)
+	assert.Contains(t, err.Error(), `invalid order_pattern "(\\d+" for feed "C"`)
+	assert.Contains(t, err.Error(), `order_pattern of feed "D" requires order_by = "title_regex"`)
+}
+
+func TestInvalidPageSizeMode(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  page_size_mode = "all"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid page_size_mode "all" for feed "A"`)
+}
+
+func TestInvalidUpdateJitter(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[downloader]
+update_jitter = "-5m"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "downloader.update_jitter -5m0s can't be negative")
+}
+
+func TestInvalidRetries(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[downloader]
+download_retries = -1
+retry_backoff = "-30s"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "downloader.download_retries -1 can't be negative")
+	assert.Contains(t, err.Error(), "downloader.retry_backoff -30s can't be negative")
+}
+
+func TestInvalidConcurrency(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[downloader]
+max_concurrent_downloads = -1
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  concurrency = -2
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "downloader.max_concurrent_downloads -1 can't be negative")
+	assert.Contains(t, err.Error(), `concurrency -2 for feed "A" can't be negative`)
+}
+
+func TestInvalidFilterPattern(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  filters = { title = "(news", not_description = "[a-" }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid filters for feed "A"`)
+	assert.Contains(t, err.Error(), `invalid filters.title pattern "(news"`)
+	assert.Contains(t, err.Error(), `invalid filters.not_description pattern "[a-"`)
+}
+
+func TestInvalidCronSchedule(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  cron_schedule = "*/5 * *"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid cron_schedule "*/5 * *" for feed "A"`)
+}
+
+func TestFeedSchedule(t *testing.T) {
+	start := time.Date(2021, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	// Cron schedule takes precedence over update period
+	feed := Feed{UpdatePeriod: Duration{time.Hour}, CronSchedule: "0 12 * * *"}
+	schedule, err := feed.Schedule()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC), schedule.Next(start))
+
+	feed.CronSchedule = ""
+	schedule, err = feed.Schedule()
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(time.Hour), schedule.Next(start))
+}
+
+func TestFormatSelectorWithMaxHeight(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  format_selector = "bestvideo[vcodec^=av01]+bestaudio"
+  max_height = 720
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `format_selector and max_height can't be used together for feed "A"`)
+}
+
+func TestAudioCodec(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  format = "audio"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  format = "audio"
+  audio_codec = "opus"
+  audio_bitrate = 64
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, model.AudioCodecMP3, config.Feeds["A"].AudioCodec)
+	assert.Equal(t, "mp3", config.Feeds["A"].Extension())
+	assert.Equal(t, model.AudioCodecOpus, config.Feeds["B"].AudioCodec)
+	assert.Equal(t, 64, config.Feeds["B"].AudioBitrate)
+	assert.Equal(t, "opus", config.Feeds["B"].Extension())
+}
+
+func TestInvalidAudioCodec(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  format = "audio"
+  audio_codec = "flac"
+  audio_bitrate = -1
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid audio_codec "flac" for feed "A"`)
+	assert.Contains(t, err.Error(), `audio_bitrate -1 for feed "A" can't be negative`)
+}
+
+func TestSourceFeed(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [feeds.B]
+  source_feed = "A"
+  format = "audio"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "A", config.Feeds["B"].SourceFeed)
+	assert.Equal(t, "https://youtube.com/watch?v=ygIUF678y40", config.Feeds["B"].URL)
+}
+
+func TestInvalidSourceFeed(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  format = "audio"
+
+  [feeds.B]
+  source_feed = "A"
+  format = "video"
+
+  [feeds.C]
+  source_feed = "B"
+
+  [feeds.D]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  source_feed = "X"
+
+  [feeds.E]
+  source_feed = "A"
+  format = "audio"
+  split_by_chapters = true
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `video feed "B" can't be transcoded from audio feed "A"`)
+	assert.Contains(t, err.Error(), `source_feed "B" of feed "C" can't have a source feed itself`)
+	assert.Contains(t, err.Error(), `source_feed "X" of feed "D" is not found`)
+	assert.Contains(t, err.Error(), `split_by_chapters of feed "E" can't be combined with source_feed`)
+}
+
+func TestKeepOriginalWithSplit(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  keep_original = true
+  split_by_chapters = true
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `keep_original of feed "A" can't be combined with split_by_chapters`)
+}
+
+func TestAPILocale(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  api_language = "zh-Hant"
+  api_region = "TW"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  api_language = "german"
+  api_region = "DEU"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid api_language "german" for feed "B"`)
+	assert.Contains(t, err.Error(), `invalid api_region "DEU" for feed "B"`)
+	assert.NotContains(t, err.Error(), `feed "A"`)
+}
+
+func TestLoudnessTarget(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  normalize_audio = true
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.EqualValues(t, -16, config.Feeds["A"].LoudnessTarget)
+}
+
+func TestInvalidLoudnessTarget(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  normalize_audio = true
+  loudness_target = -2
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `loudness_target -2 for feed "A" must be between -70 and -5 LUFS`)
+}
+
+func TestS3Storage(t *testing.T) {
+	const file = `
+[storage]
+type = "s3"
+
+  [storage.s3]
+  bucket = "podsync"
+  endpoint_url = "https://minio.example.com"
+  access_key = "key"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	// data_dir is not required for object storage
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "data directory is required")
+	assert.Contains(t, err.Error(), "both storage.s3.access_key and storage.s3.secret_key are required")
+}
+
+func TestDefaultStorage(t *testing.T) {
+	const file = `
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "data directory is required")
+}
+
+func TestIncompleteBasicAuth(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+username = "user"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "both server.username and server.password are required")
+}
+
+func TestLogFormat(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[log]
+format = "json"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "json", config.Log.Format)
+}
+
+func TestInvalidLogFormat(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[log]
+format = "xml"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid log.format "xml"`)
+}
+
+func TestBindAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{address: "127.0.0.1", valid: true},
+		{address: "::1", valid: true},
+		{address: "[2001:db8::1]", valid: true},
+		{address: "localhost:8080", valid: false},
+		{address: "256.0.0.1", valid: false},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.address, func(t *testing.T) {
+			file := fmt.Sprintf(`
+[server]
+data_dir = "/data"
+bind_address = %q
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`, tst.address)
+			path := setup(t, file)
+			defer os.Remove(path)
+
+			_, err := LoadConfig(path)
+			if tst.valid {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid server.bind_address")
+			}
+		})
+	}
+}
+
+func TestCookies(t *testing.T) {
+	cookies, err := ioutil.TempFile("", "cookies-*.txt")
+	require.NoError(t, err)
+	cookies.Close()
+	defer os.Remove(cookies.Name())
+
+	file := `
+[server]
+data_dir = "/data"
+
+[downloader]
+cookies = "` + cookies.Name() + `"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  cookies = "/nonexistent/cookies.txt"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err = LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `cookies file "/nonexistent/cookies.txt" for feed "B" is not accessible`)
+	assert.NotContains(t, err.Error(), `feed "A"`)
+
+	// Global default is used by feeds that don't set their own
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(file, `cookies = "/nonexistent/cookies.txt"`, "", 1)), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, cookies.Name(), config.Feeds["A"].Cookies)
+	assert.Equal(t, cookies.Name(), config.Feeds["B"].Cookies)
+}
+
+func TestTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-scratch-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+
+	tests := []struct {
+		name   string
+		dir    string
+		expect string
+	}{
+		{name: "Valid", dir: dir},
+		{name: "Missing", dir: filepath.Join(dir, "missing"), expect: "no such file or directory"},
+		{name: "File", dir: file, expect: "not a directory"},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			path := setup(t, `
+[server]
+data_dir = "/data"
+
+[downloader]
+temp_dir = "`+tst.dir+`"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`)
+			defer os.Remove(path)
+
+			config, err := LoadConfig(path)
+			if tst.expect == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tst.dir, config.Downloader.TempDir)
+
+				// Write check doesn't leave anything behind
+				files, err := ioutil.ReadDir(dir)
+				require.NoError(t, err)
+				assert.Len(t, files, 1)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), `downloader.temp_dir "`+tst.dir+`" is not usable`)
+			assert.Contains(t, err.Error(), tst.expect)
+		})
+	}
+}
+
+func TestHTTPHeaders(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[downloader]
+http_headers = { Referer = "https://example.com/", "X-Token" = "global" }
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  http_headers = { referer = "https://example.org/", Authorization = "Bearer token" }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Referer": "https://example.com/", "X-Token": "global"}, config.Feeds["A"].HTTPHeaders)
+
+	// Feed headers take precedence, names are case insensitive
+	assert.Equal(t, map[string]string{
+		"referer":       "https://example.org/",
+		"Authorization": "Bearer token",
+		"X-Token":       "global",
+	}, config.Feeds["B"].HTTPHeaders)
+
+	invalid := setup(t, `
+[server]
+data_dir = "/data"
+
+[downloader]
+http_headers = { "Bad Name" = "value" }
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  http_headers = { Referer = "https://example.com/\nX-Injected: 1" }
+`)
+	defer os.Remove(invalid)
+
+	_, err = LoadConfig(invalid)
+	require.Error(t, err)
+	assert.Equal(t, 1, strings.Count(err.Error(), `"Bad Name" is not a valid header name`))
+	assert.Contains(t, err.Error(), `invalid http_headers of feed "B": value of header "Referer" contains invalid characters`)
+}
+
+func TestNetwork(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[network]
+proxy = "socks5://127.0.0.1:1080"
+user_agent = "Mozilla/5.0"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "socks5://127.0.0.1:1080", config.Network.Proxy)
+	assert.Equal(t, "Mozilla/5.0", config.Network.UserAgent)
+}
+
+func TestInvalidExternalDownloader(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[downloader]
+external = "/nonexistent/aria2c"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `external downloader "/nonexistent/aria2c" is not found or not executable`)
+}
+
+func TestInvalidProxy(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[network]
+proxy = "127.0.0.1:1080"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid network.proxy "127.0.0.1:1080"`)
+}
+
+func TestFiltersCaseInsensitive(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  filters = { title = "news", not_description = "sponsored" }
+
+  [feeds.B]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+  filters = { title = "news", not_description = "sponsored", case_insensitive = true }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	sensitive := config.Feeds["A"].Filters
+	require.NotNil(t, sensitive.TitleRegexp)
+	assert.False(t, sensitive.TitleRegexp.MatchString("NEWS Update"))
+	assert.True(t, sensitive.TitleRegexp.MatchString("news update"))
+	assert.Nil(t, sensitive.NotTitleRegexp)
+
+	insensitive := config.Feeds["B"].Filters
+	require.NotNil(t, insensitive.TitleRegexp)
+	assert.True(t, insensitive.TitleRegexp.MatchString("NEWS Update"))
+	assert.True(t, insensitive.NotDescriptionRegexp.MatchString("Sponsored by"))
+	assert.Nil(t, insensitive.DescriptionRegexp)
+}
+
+func TestDefaultDatabasePath(t *testing.T) {
+	cfg := Config{}
+	cfg.applyDefaults("/home/user/podsync/config.toml")
+	assert.Equal(t, "/home/user/podsync/db", cfg.Database.Dir)
+	assert.Equal(t, "/home/user/podsync/db/partial", cfg.Downloader.PartialDir)
+
+	cfg = Config{Downloader: Downloader{PartialDir: "/scratch/partial"}}
+	cfg.applyDefaults("/home/user/podsync/config.toml")
+	assert.Equal(t, "/scratch/partial", cfg.Downloader.PartialDir)
+}
+
+func TestLoadBadgerConfig(t *testing.T) {
+	const file = `
+[server]
+data_dir = "/data"
+
+[feeds]
+  [feeds.A]
+  url = "https://youtube.com/watch?v=ygIUF678y40"
+
+[database]
+  badger = { truncate = true, file_io = true }
+`
+	path := setup(t, file)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	require.NotNil(t, config)
+	require.NotNil(t, config.Database.Badger)
+
+	assert.True(t, config.Database.Badger.Truncate)
+	assert.True(t, config.Database.Badger.FileIO)
+}
+
+func TestSizeUnmarshal(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect Size
+		err    bool
+	}{
+		{in: "100", expect: 100},
+		{in: "500K", expect: 500 * 1024},
+		{in: "2m", expect: 2 * 1024 * 1024},
+		{in: "1.5G", expect: 1536 * 1024 * 1024},
+		{in: "10GB", expect: 10 * 1024 * 1024 * 1024},
+		{in: "1TiB", expect: 1024 * 1024 * 1024 * 1024},
+		{in: "abc", err: true},
+		{in: "-1M", err: true},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.in, func(t *testing.T) {
+			var size Size
+			err := size.UnmarshalText([]byte(tst.in))
+			if tst.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tst.expect, size)
+		})
+	}
 }
 
 func setup(t *testing.T, file string) string {
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+const (
+	envPrefix  = "env:"
+	filePrefix = "file:"
+)
+
+// resolveSecret returns the value of the environment variable or the contents of the file referenced
+// as "env:NAME" or "file:/path" (e.g. a Docker secret), other values are returned as is
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, envPrefix):
+		name := strings.TrimPrefix(value, envPrefix)
+		resolved, ok := os.LookupEnv(name)
+		if !ok || resolved == "" {
+			return "", errors.Errorf("environment variable %q is not set", name)
+		}
+		return resolved, nil
+	case strings.HasPrefix(value, filePrefix):
+		path := strings.TrimPrefix(value, filePrefix)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read secret file %q", path)
+		}
+		// Files usually end with a new line
+		resolved := strings.TrimRight(string(data), "\r\n")
+		if resolved == "" {
+			return "", errors.Errorf("secret file %q is empty", path)
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+// resolveSecrets replaces references to environment variables and files in API tokens and credentials
+func (c *Config) resolveSecrets() error {
+	var result *multierror.Error
+
+	resolve := func(name string, value *string) {
+		resolved, err := resolveSecret(*value)
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to resolve %s", name))
+			return
+		}
+		*value = resolved
+	}
+
+	for provider, keys := range c.Tokens {
+		for i := range keys {
+			resolve(fmt.Sprintf("tokens.%s", provider), &keys[i])
+		}
+	}
+
+	resolve("server.password", &c.Server.Password)
+	resolve("server.auth_token", &c.Server.AuthToken)
+	resolve("storage.s3.access_key", &c.Storage.S3.AccessKey)
+	resolve("storage.s3.secret_key", &c.Storage.S3.SecretKey)
+
+	// Webhook URLs embed tokens (e.g. Discord or Slack)
+	for i := range c.Notifications.Webhooks {
+		resolve("notifications.webhooks", &c.Notifications.Webhooks[i])
+	}
+
+	return result.ErrorOrNil()
+}
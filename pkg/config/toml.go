@@ -1,6 +1,8 @@
 package config
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,6 +22,58 @@ func (d *Duration) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// Date is a point in time, that can be specified either in RFC3339 format or as "YYYY-MM-DD" (UTC)
+type Date struct {
+	time.Time
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if res, err := time.Parse(layout, string(text)); err == nil {
+			*d = Date{res}
+			return nil
+		}
+	}
+
+	return errors.Errorf("invalid date %q, expected RFC3339 or YYYY-MM-DD format", string(text))
+}
+
+// Size is a number of bytes, that can be specified in human-readable form,
+// e.g. "500K", "2M" or "1.5G" (binary units).
+type Size int64
+
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"t", 1 << 40},
+	{"g", 1 << 30},
+	{"m", 1 << 20},
+	{"k", 1 << 10},
+	{"", 1},
+}
+
+func (s *Size) UnmarshalText(text []byte) error {
+	str := strings.ToLower(strings.TrimSpace(string(text)))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "ib"), "b")
+
+	for _, unit := range sizeUnits {
+		if !strings.HasSuffix(str, unit.suffix) {
+			continue
+		}
+
+		num, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(str, unit.suffix)), 64)
+		if err != nil || num < 0 {
+			return errors.Errorf("invalid size %q", string(text))
+		}
+
+		*s = Size(num * float64(unit.scale))
+		return nil
+	}
+
+	return errors.Errorf("invalid size %q", string(text))
+}
+
 // StringSlice is a toml extension that lets you to specify either a string
 // value (a slice with just one element) or a string slice.
 type StringSlice []string
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/dgraph-io/badger"
 	"github.com/dgraph-io/badger/options"
@@ -19,6 +20,7 @@ const (
 	versionPath   = "podsync/version"
 	feedPrefix    = "feed/"
 	feedPath      = "feed/%s"
+	statusPath    = "status/%s"
 	episodePrefix = "episode/%s/"
 	episodePath   = "episode/%s/%s" // FeedID + EpisodeID
 )
@@ -123,6 +125,10 @@ func (b *Badger) GetFeed(_ context.Context, feedID string) (*model.Feed, error)
 			return err
 		}
 
+		if feed.ID == "" {
+			feed.ID = feedID
+		}
+
 		// Query episodes
 		if err := b.walkEpisodes(txn, feedID, func(episode *model.Episode) error {
 			feed.Episodes = append(feed.Episodes, episode)
@@ -139,6 +145,25 @@ func (b *Badger) GetFeed(_ context.Context, feedID string) (*model.Feed, error)
 	return &feed, nil
 }
 
+func (b *Badger) UpdateFeed(feedID string, cb func(feed *model.Feed) error) error {
+	var (
+		key  = b.getKey(feedPath, feedID)
+		feed model.Feed
+	)
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := b.getObj(txn, key, &feed); err != nil {
+			return err
+		}
+
+		if err := cb(&feed); err != nil {
+			return err
+		}
+
+		return b.setObj(txn, key, &feed, true)
+	})
+}
+
 func (b *Badger) WalkFeeds(_ context.Context, cb func(feed *model.Feed) error) error {
 	return b.db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
@@ -150,11 +175,48 @@ func (b *Badger) WalkFeeds(_ context.Context, cb func(feed *model.Feed) error) e
 				return err
 			}
 
+			// Feed ID isn't always saved along with the feed, but it's a part of the key
+			if feed.ID == "" {
+				feed.ID = strings.TrimPrefix(string(item.Key()), string(opts.Prefix))
+			}
+
 			return cb(feed)
 		})
 	})
 }
 
+func (b *Badger) GetFeedStatus(_ context.Context, feedID string) (*model.FeedStatus, error) {
+	var (
+		status model.FeedStatus
+		key    = b.getKey(statusPath, feedID)
+	)
+
+	err := b.db.View(func(txn *badger.Txn) error {
+		return b.getObj(txn, key, &status)
+	})
+
+	return &status, err
+}
+
+func (b *Badger) UpdateFeedStatus(feedID string, cb func(status *model.FeedStatus) error) error {
+	var (
+		key    = b.getKey(statusPath, feedID)
+		status model.FeedStatus
+	)
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := b.getObj(txn, key, &status); err != nil && err != model.ErrNotFound {
+			return err
+		}
+
+		if err := cb(&status); err != nil {
+			return err
+		}
+
+		return b.setObj(txn, key, &status, true)
+	})
+}
+
 func (b *Badger) DeleteFeed(_ context.Context, feedID string) error {
 	return b.db.Update(func(txn *badger.Txn) error {
 		// Feed
@@ -163,6 +225,11 @@ func (b *Badger) DeleteFeed(_ context.Context, feedID string) error {
 			return errors.Wrapf(err, "failed to delete feed %q", feedID)
 		}
 
+		// Status
+		if err := txn.Delete(b.getKey(statusPath, feedID)); err != nil {
+			return errors.Wrapf(err, "failed to delete status of feed %q", feedID)
+		}
+
 		// Episodes
 		opts := badger.DefaultIteratorOptions
 		opts.Prefix = b.getKey(episodePrefix, feedID)
@@ -191,6 +258,13 @@ func (b *Badger) GetEpisode(_ context.Context, feedID string, episodeID string)
 	return &episode, err
 }
 
+func (b *Badger) AddEpisode(feedID string, episode *model.Episode) error {
+	key := b.getKey(episodePath, feedID, episode.ID)
+	return b.db.Update(func(txn *badger.Txn) error {
+		return b.setObj(txn, key, episode, true)
+	})
+}
+
 func (b *Badger) UpdateEpisode(feedID string, episodeID string, cb func(episode *model.Episode) error) error {
 	var (
 		key     = b.getKey(episodePath, feedID, episodeID)
@@ -104,6 +104,30 @@ func TestBadger_WalkFeeds(t *testing.T) {
 	assert.Equal(t, called, 1)
 }
 
+func TestBadger_FeedIDFromKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-badger-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := NewBadger(&config.Database{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Feeds built by providers don't have ID set
+	err = db.AddFeed(testCtx, "1", &model.Feed{Title: "Feed"})
+	require.NoError(t, err)
+
+	err = db.WalkFeeds(testCtx, func(actual *model.Feed) error {
+		assert.Equal(t, "1", actual.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	feed, err := db.GetFeed(testCtx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", feed.ID)
+}
+
 func TestBadger_DeleteFeed(t *testing.T) {
 	dir, err := ioutil.TempDir("", "podsync-badger-")
 	assert.NoError(t, err)
@@ -129,6 +153,105 @@ func TestBadger_DeleteFeed(t *testing.T) {
 	assert.Equal(t, 0, called)
 }
 
+func TestBadger_UpdateFeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-badger-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := NewBadger(&config.Database{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	feed := getFeed()
+	err = db.AddFeed(testCtx, feed.ID, feed)
+	require.NoError(t, err)
+
+	err = db.UpdateFeed(feed.ID, func(feed *model.Feed) error {
+		assert.Empty(t, feed.Episodes)
+		feed.Seeded = true
+		return nil
+	})
+	assert.NoError(t, err)
+
+	stored, err := db.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Seeded)
+	assert.Equal(t, feed.Title, stored.Title)
+	assert.Len(t, stored.Episodes, len(feed.Episodes))
+
+	err = db.UpdateFeed("missing", func(feed *model.Feed) error { return nil })
+	assert.Equal(t, model.ErrNotFound, err)
+}
+
+func TestBadger_FeedStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-badger-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := NewBadger(&config.Database{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetFeedStatus(testCtx, "1")
+	assert.Equal(t, model.ErrNotFound, err)
+
+	// Created on first update
+	for i := 0; i < 2; i++ {
+		err = db.UpdateFeedStatus("1", func(status *model.FeedStatus) error {
+			status.LastError = "failed"
+			status.Failures++
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	status, err := db.GetFeedStatus(testCtx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "failed", status.LastError)
+	assert.Equal(t, 2, status.Failures)
+
+	// Deleted along with the feed
+	err = db.DeleteFeed(testCtx, "1")
+	require.NoError(t, err)
+
+	_, err = db.GetFeedStatus(testCtx, "1")
+	assert.Equal(t, model.ErrNotFound, err)
+}
+
+func TestBadger_AddEpisode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-badger-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := NewBadger(&config.Database{Dir: dir})
+	require.NoError(t, err)
+	defer db.Close()
+
+	feed := getFeed()
+	err = db.AddFeed(testCtx, feed.ID, feed)
+	require.NoError(t, err)
+
+	err = db.AddEpisode(feed.ID, &model.Episode{ID: "new", Title: "New"})
+	assert.NoError(t, err)
+
+	// Existing episodes are overwritten
+	err = db.AddEpisode(feed.ID, &model.Episode{ID: feed.Episodes[0].ID, Title: "Updated"})
+	assert.NoError(t, err)
+
+	episode, err := db.GetEpisode(testCtx, feed.ID, "new")
+	require.NoError(t, err)
+	assert.Equal(t, "New", episode.Title)
+
+	episode, err = db.GetEpisode(testCtx, feed.ID, feed.Episodes[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated", episode.Title)
+
+	stored, err := db.GetFeed(testCtx, feed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, feed.Title, stored.Title)
+	assert.Len(t, stored.Episodes, len(feed.Episodes)+1)
+}
+
 func TestBadger_UpdateEpisode(t *testing.T) {
 	dir, err := ioutil.TempDir("", "podsync-badger-")
 	assert.NoError(t, err)
@@ -24,15 +24,27 @@ type Storage interface {
 	// GetFeed gets a feed by ID
 	GetFeed(ctx context.Context, feedID string) (*model.Feed, error)
 
+	// UpdateFeed updates feed info fields, episodes are not loaded
+	UpdateFeed(feedID string, cb func(feed *model.Feed) error) error
+
 	// WalkFeeds iterates over feeds saved to database
 	WalkFeeds(ctx context.Context, cb func(feed *model.Feed) error) error
 
+	// GetFeedStatus gets the outcome of the latest feed updates
+	GetFeedStatus(ctx context.Context, feedID string) (*model.FeedStatus, error)
+
+	// UpdateFeedStatus updates the feed status, it's created if missing
+	UpdateFeedStatus(feedID string, cb func(status *model.FeedStatus) error) error
+
 	// DeleteFeed deletes feed and all related data from database
 	DeleteFeed(ctx context.Context, feedID string) error
 
 	// GetEpisode gets episode by identifier
 	GetEpisode(ctx context.Context, feedID string, episodeID string) (*model.Episode, error)
 
+	// AddEpisode saves an episode, overwriting the existing one with the same ID
+	AddEpisode(feedID string, episode *model.Episode) error
+
 	// UpdateEpisode updates episode fields
 	UpdateEpisode(feedID string, episodeID string, cb func(episode *model.Episode) error) error
 
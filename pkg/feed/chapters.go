@@ -0,0 +1,73 @@
+package feed
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/sponsorblock"
+)
+
+// See https://github.com/Podcastindex-org/podcast-namespace/blob/main/chapters/jsonChapters.md
+const (
+	chaptersType    = "application/json+chapters"
+	chaptersVersion = "1.2.0"
+)
+
+type jsonChapters struct {
+	Version  string        `json:"version"`
+	Chapters []jsonChapter `json:"chapters"`
+}
+
+type jsonChapter struct {
+	StartTime float64 `json:"startTime"`
+	EndTime   float64 `json:"endTime,omitempty"`
+	Title     string  `json:"title,omitempty"`
+}
+
+// ReadInfoChapters extracts chapters from youtube-dl info JSON (as produced by --write-info-json)
+func ReadInfoChapters(r io.Reader) ([]sponsorblock.Chapter, error) {
+	var info struct {
+		Chapters []struct {
+			StartTime float64 `json:"start_time"`
+			EndTime   float64 `json:"end_time"`
+			Title     string  `json:"title"`
+		} `json:"chapters"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&info); err != nil {
+		return nil, errors.Wrap(err, "failed to decode info JSON")
+	}
+
+	var chapters []sponsorblock.Chapter
+	for _, chapter := range info.Chapters {
+		chapters = append(chapters, sponsorblock.Chapter{
+			Start: chapter.StartTime,
+			End:   chapter.EndTime,
+			Title: chapter.Title,
+		})
+	}
+
+	return chapters, nil
+}
+
+// EncodeChapters writes chapters in Podcasting 2.0 JSON chapters format
+func EncodeChapters(w io.Writer, chapters []sponsorblock.Chapter) error {
+	out := jsonChapters{
+		Version:  chaptersVersion,
+		Chapters: []jsonChapter{},
+	}
+
+	for _, chapter := range chapters {
+		out.Chapters = append(out.Chapters, jsonChapter{
+			StartTime: chapter.Start,
+			EndTime:   chapter.End,
+			Title:     chapter.Title,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -0,0 +1,46 @@
+package feed
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/sponsorblock"
+)
+
+func TestReadInfoChapters(t *testing.T) {
+	const info = `{"id": "abc", "title": "Episode", "chapters": [
+		{"start_time": 0.0, "end_time": 60.0, "title": "Intro"},
+		{"start_time": 60.0, "end_time": 125.5, "title": "Main part"}
+	]}`
+
+	chapters, err := ReadInfoChapters(strings.NewReader(info))
+	require.NoError(t, err)
+	assert.Equal(t, []sponsorblock.Chapter{
+		{Start: 0, End: 60, Title: "Intro"},
+		{Start: 60, End: 125.5, Title: "Main part"},
+	}, chapters)
+
+	chapters, err = ReadInfoChapters(strings.NewReader(`{"id": "abc", "chapters": null}`))
+	require.NoError(t, err)
+	assert.Empty(t, chapters)
+
+	_, err = ReadInfoChapters(strings.NewReader("not json"))
+	assert.Error(t, err)
+}
+
+func TestEncodeChapters(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, EncodeChapters(&buf, []sponsorblock.Chapter{
+		{Start: 0, End: 60, Title: "Intro"},
+		{Start: 60, End: 125.5, Title: "Main part"},
+	}))
+
+	assert.JSONEq(t, `{"version": "1.2.0", "chapters": [
+		{"startTime": 0, "endTime": 60, "title": "Intro"},
+		{"startTime": 60, "endTime": 125.5, "title": "Main part"}
+	]}`, buf.String())
+}
@@ -0,0 +1,29 @@
+package feed
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// See https://github.com/Podcastindex-org/podcast-namespace/blob/main/docs/1.0.md#guid
+var guidNamespace = [16]byte{0xea, 0xd4, 0xc2, 0x36, 0xbf, 0x58, 0x58, 0xc6, 0xa2, 0xc6, 0xa6, 0xb2, 0x8d, 0x12, 0x8c, 0xb6}
+
+// PodcastGUID returns UUIDv5 of the feed URL without scheme and trailing slashes, as defined by the podcast namespace
+func PodcastGUID(feedURL string) string {
+	name := feedURL
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimRight(name, "/")
+
+	hash := sha1.New()
+	hash.Write(guidNamespace[:])
+	hash.Write([]byte(name))
+	sum := hash.Sum(nil)
+
+	sum[6] = (sum[6] & 0x0f) | 0x50 // Version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
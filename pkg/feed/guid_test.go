@@ -0,0 +1,14 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodcastGUID(t *testing.T) {
+	// Example from the podcast namespace specification
+	assert.Equal(t, "9b024349-ccf0-5f69-a609-6b82873eab3c", PodcastGUID("https://podnews.net/rss"))
+	assert.Equal(t, "9b024349-ccf0-5f69-a609-6b82873eab3c", PodcastGUID("http://podnews.net/rss/"))
+	assert.NotEqual(t, PodcastGUID("https://podnews.net/rss"), PodcastGUID("https://podnews.net/rss2"))
+}
@@ -3,6 +3,7 @@ package feed
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/gilliek/go-opml/opml"
 	"github.com/pkg/errors"
@@ -12,12 +13,21 @@ import (
 	"github.com/mxpv/podsync/pkg/model"
 )
 
+// uncategorized is a group name for feeds without custom category
+const uncategorized = "Uncategorized"
+
 func BuildOPML(ctx context.Context, config *config.Config, db feedProvider, provider urlProvider) (string, error) {
 	doc := opml.OPML{Version: "1.0"}
 	doc.Head = opml.Head{Title: "Podsync feeds"}
 	doc.Body = opml.Body{}
 
-	for _, feed := range config.Feeds {
+	var (
+		groups     = map[string][]opml.Outline{}
+		categories []string
+	)
+
+	// Sorted to keep the output stable between updates
+	for _, feed := range config.FeedList() {
 		f, err := db.GetFeed(ctx, feed.ID)
 		if err == model.ErrNotFound {
 			// As we update OPML on per-feed basis, some feeds may not yet be populated in database.
@@ -43,7 +53,36 @@ func BuildOPML(ctx context.Context, config *config.Config, db feedProvider, prov
 			XMLURL: downloadURL,
 		}
 
-		doc.Body.Outlines = append(doc.Body.Outlines, outline)
+		if !config.OPML.Grouped {
+			doc.Body.Outlines = append(doc.Body.Outlines, outline)
+			continue
+		}
+
+		category := feed.Custom.Category
+		if category == "" {
+			category = uncategorized
+		}
+
+		if _, ok := groups[category]; !ok {
+			categories = append(categories, category)
+		}
+
+		groups[category] = append(groups[category], outline)
+	}
+
+	// Keep uncategorized feeds at the end
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i] == uncategorized || categories[j] == uncategorized {
+			return categories[j] == uncategorized && categories[i] != uncategorized
+		}
+		return categories[i] < categories[j]
+	})
+	for _, category := range categories {
+		doc.Body.Outlines = append(doc.Body.Outlines, opml.Outline{
+			Title:    category,
+			Text:     category,
+			Outlines: groups[category],
+		})
 	}
 
 	out, err := doc.XML()
@@ -41,3 +41,49 @@ func TestBuildOPML(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expected, out)
 }
+
+func TestBuildOPMLGrouped(t *testing.T) {
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+	<head>
+		<title>Podsync feeds</title>
+	</head>
+	<body>
+		<outline text="Music" title="Music">
+			<outline text="desc" type="rss" xmlUrl="https://url/2.xml" title="2"></outline>
+		</outline>
+		<outline text="TV" title="TV">
+			<outline text="desc" type="rss" xmlUrl="https://url/1.xml" title="1"></outline>
+			<outline text="desc" type="rss" xmlUrl="https://url/3.xml" title="3"></outline>
+		</outline>
+		<outline text="Uncategorized" title="Uncategorized">
+			<outline text="desc" type="rss" xmlUrl="https://url/4.xml" title="4"></outline>
+		</outline>
+	</body>
+</opml>`
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	dbMock := NewMockfeedProvider(ctrl)
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		urlMock.EXPECT().URL(gomock.Any(), "", id+".xml").Return("https://url/"+id+".xml", nil)
+		dbMock.EXPECT().GetFeed(gomock.Any(), id).Return(&model.Feed{Title: id, Description: "desc"}, nil)
+	}
+
+	cfg := config.Config{
+		OPML: config.OPML{Grouped: true},
+		Feeds: map[string]*config.Feed{
+			"1": {ID: "1", OPML: true, Custom: config.Custom{Category: "TV"}},
+			"2": {ID: "2", OPML: true, Custom: config.Custom{Category: "Music"}},
+			"3": {ID: "3", OPML: true, Custom: config.Custom{Category: "TV"}},
+			"4": {ID: "4", OPML: true},
+		},
+	}
+
+	out, err := BuildOPML(context.Background(), &cfg, dbMock, urlMock)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, out)
+}
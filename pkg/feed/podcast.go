@@ -0,0 +1,116 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+
+	itunes "github.com/eduncan911/podcast"
+	"github.com/pkg/errors"
+)
+
+// See https://github.com/Podcastindex-org/podcast-namespace
+const podcastNamespace = "https://podcastindex.org/namespace/1.0"
+
+// Podcast is an iTunes podcast extended with elements from the podcast namespace
+type Podcast struct {
+	*itunes.Podcast
+	GUID   *GUID
+	Locked *Locked
+	// Items are moved out of the embedded podcast, so they can be extended as well
+	Items []*Item `xml:"item"`
+}
+
+// GUID is a <podcast:guid> element identifying the podcast across hosts and directories
+type GUID struct {
+	XMLName xml.Name `xml:"podcast:guid"`
+	Value   string   `xml:",chardata"`
+}
+
+// Locked is a <podcast:locked> element asking platforms not to import the feed
+type Locked struct {
+	XMLName xml.Name `xml:"podcast:locked"`
+	Owner   string   `xml:"owner,attr,omitempty"`
+	Value   string   `xml:",chardata"`
+}
+
+// Item is an iTunes podcast item extended with elements from the podcast namespace
+type Item struct {
+	*itunes.Item
+	// Overrides the embedded item's <guid>, which lacks the isPermaLink attribute
+	EpisodeGUID *EpisodeGUID
+	IEpisode    string `xml:"itunes:episode,omitempty"`
+	ISeason     string `xml:"itunes:season,omitempty"`
+	Transcripts []*Transcript
+	Chapters    *Chapters
+}
+
+// EpisodeGUID is an item's <guid>. Episode IDs are not URLs, so isPermaLink is set to false
+// (RSS readers assume true if the attribute is missing)
+type EpisodeGUID struct {
+	XMLName     xml.Name `xml:"guid"`
+	IsPermaLink bool     `xml:"isPermaLink,attr"`
+	Value       string   `xml:",chardata"`
+}
+
+// Transcript is a <podcast:transcript> element linking an episode transcript
+type Transcript struct {
+	XMLName  xml.Name `xml:"podcast:transcript"`
+	URL      string   `xml:"url,attr"`
+	Type     string   `xml:"type,attr"`
+	Language string   `xml:"language,attr,omitempty"`
+}
+
+// Chapters is a <podcast:chapters> element linking episode chapters JSON
+type Chapters struct {
+	XMLName xml.Name `xml:"podcast:chapters"`
+	URL     string   `xml:"url,attr"`
+	Type    string   `xml:"type,attr"`
+}
+
+type podcastWrapper struct {
+	XMLName   xml.Name `xml:"rss"`
+	Version   string   `xml:"version,attr"`
+	ATOMNS    string   `xml:"xmlns:atom,attr,omitempty"`
+	ITUNESNS  string   `xml:"xmlns:itunes,attr"`
+	PODCASTNS string   `xml:"xmlns:podcast,attr"`
+	Channel   *Podcast `xml:"channel"`
+}
+
+// Encode writes the podcast as RSS 2.0 XML
+func (p *Podcast) Encode(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "failed to write XML header")
+	}
+
+	atomLink := ""
+	if p.AtomLink != nil {
+		atomLink = "http://www.w3.org/2005/Atom"
+	}
+
+	wrapped := podcastWrapper{
+		Version:   "2.0",
+		ATOMNS:    atomLink,
+		ITUNESNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		PODCASTNS: podcastNamespace,
+		Channel:   p,
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(wrapped); err != nil {
+		return errors.Wrap(err, "failed to encode podcast")
+	}
+
+	return nil
+}
+
+// String returns the podcast XML
+func (p *Podcast) String() string {
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		return "failed to encode podcast: " + err.Error()
+	}
+
+	return buf.String()
+}
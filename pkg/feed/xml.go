@@ -3,12 +3,18 @@ package feed
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	itunes "github.com/eduncan911/podcast"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/mxpv/podsync/pkg/config"
 	"github.com/mxpv/podsync/pkg/model"
@@ -30,7 +36,82 @@ func (p timeSlice) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 
-func Build(ctx context.Context, feed *model.Feed, cfg *config.Feed, provider urlProvider) (*itunes.Podcast, error) {
+// titleNumber returns the positive integer extracted from the title with the first capture group of pattern,
+// empty if pattern is nil or there is no such number
+func titleNumber(pattern *regexp.Regexp, title string) string {
+	if pattern == nil {
+		return ""
+	}
+
+	match := pattern.FindStringSubmatch(title)
+	if match == nil {
+		return ""
+	}
+
+	number, err := strconv.Atoi(match[1])
+	if err != nil || number <= 0 {
+		return ""
+	}
+
+	return strconv.Itoa(number)
+}
+
+// sortByTitleNumber orders episodes by the number extracted from titles with the first capture group of pattern
+// in descending order. Episodes with equal numbers and episodes without a number (which go last) keep their order.
+func sortByTitleNumber(episodes []*model.Episode, pattern *regexp.Regexp) {
+	numbers := make(map[*model.Episode]float64, len(episodes))
+	for _, episode := range episodes {
+		match := pattern.FindStringSubmatch(episode.Title)
+		if match == nil {
+			continue
+		}
+
+		if number, err := strconv.ParseFloat(match[1], 64); err == nil {
+			numbers[episode] = number
+		}
+	}
+
+	sort.SliceStable(episodes, func(i, j int) bool {
+		a, okA := numbers[episodes[i]]
+		b, okB := numbers[episodes[j]]
+		if okA != okB {
+			return okA
+		}
+
+		return okA && a > b
+	})
+}
+
+// opusType is the MIME type of Opus episodes (Ogg container)
+const opusType = "audio/ogg"
+
+// mediaURLs points links to episode files at the media hostname (e.g. a CDN) instead of the storage one
+type mediaURLs struct {
+	urlProvider
+	hostname string
+}
+
+func (m *mediaURLs) URL(ctx context.Context, ns string, fileName string) (string, error) {
+	link, err := m.urlProvider.URL(ctx, ns, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse URL %q", link)
+	}
+
+	// Path is kept, so the media hostname is expected to mirror the storage layout
+	link = strings.TrimSuffix(m.hostname, "/") + u.EscapedPath()
+	if u.RawQuery != "" {
+		link += "?" + u.RawQuery
+	}
+
+	return link, nil
+}
+
+func Build(ctx context.Context, feed *model.Feed, cfg *config.Feed, provider urlProvider) (*Podcast, error) {
 	const (
 		podsyncGenerator = "Podsync generator (support us at https://github.com/mxpv/podsync)"
 		defaultCategory  = "TV & Film"
@@ -46,7 +127,8 @@ func Build(ctx context.Context, feed *model.Feed, cfg *config.Feed, provider url
 	p.IAuthor = feed.Title
 	p.AddSummary(feed.Description)
 
-	if cfg.Custom.CoverArt != "" {
+	// Resized cover art is stored by updater and passed as the feed's one
+	if cfg.Custom.CoverArt != "" && !cfg.Custom.CoverArtResize {
 		p.AddImage(cfg.Custom.CoverArt)
 	} else {
 		p.AddImage(feed.CoverArt)
@@ -68,6 +150,14 @@ func Build(ctx context.Context, feed *model.Feed, cfg *config.Feed, provider url
 		p.Language = cfg.Custom.Language
 	}
 
+	if cfg.Custom.Block {
+		p.IBlock = "Yes"
+	}
+
+	if cfg.Custom.Complete {
+		p.IComplete = "Yes"
+	}
+
 	for _, episode := range feed.Episodes {
 		if episode.PubDate.IsZero() {
 			episode.PubDate = now
@@ -76,6 +166,26 @@ func Build(ctx context.Context, feed *model.Feed, cfg *config.Feed, provider url
 
 	// Sort all episodes in descending order
 	sort.Sort(timeSlice(feed.Episodes))
+	if cfg.OrderBy == model.OrderByTitleRegex && cfg.OrderRegexp != nil {
+		sortByTitleNumber(feed.Episodes, cfg.OrderRegexp)
+	}
+
+	if cfg.MediaHostname != "" {
+		provider = &mediaURLs{urlProvider: provider, hostname: cfg.MediaHostname}
+	}
+
+	result := &Podcast{Podcast: &p}
+
+	// Derived from the source URL rather than the XML one, so it stays the same when moving to another host
+	guid := cfg.Custom.PodcastGUID
+	if guid == "" {
+		guid = PodcastGUID(cfg.URL)
+	}
+	result.GUID = &GUID{Value: guid}
+
+	if cfg.Custom.Locked {
+		result.Locked = &Locked{Owner: cfg.Custom.OwnerEmail, Value: "yes"}
+	}
 
 	for i, episode := range feed.Episodes {
 		if episode.Status != model.EpisodeDownloaded {
@@ -95,12 +205,29 @@ func Build(ctx context.Context, feed *model.Feed, cfg *config.Feed, provider url
 
 		item.AddPubDate(&episode.PubDate)
 		item.AddSummary(episode.Description)
-		item.AddImage(episode.Thumbnail)
-		item.AddDuration(episode.Duration)
+		image := episode.Thumbnail
+		if cfg.EpisodeArtwork {
+			// Prefer the stored copy, as thumbnail links of some providers expire
+			if artworkURL, err := provider.URL(ctx, cfg.ID, ArtworkName(cfg, episode)); err == nil {
+				image = artworkURL
+			}
+		}
+		item.AddImage(image)
+		if episode.ActualDuration > 0 {
+			item.AddDuration(episode.ActualDuration)
+		} else {
+			item.AddDuration(episode.Duration)
+		}
 
 		enclosureType := itunes.MP4
 		if feed.Format == model.FormatAudio {
-			enclosureType = itunes.MP3
+			switch cfg.AudioCodec {
+			case model.AudioCodecAAC, model.AudioCodecOpus:
+				// Opus type is set after adding the item, as the library doesn't know it
+				enclosureType = itunes.M4A
+			default:
+				enclosureType = itunes.MP3
+			}
 		}
 
 		episodeName := EpisodeName(cfg, episode)
@@ -125,16 +252,136 @@ func Build(ctx context.Context, feed *model.Feed, cfg *config.Feed, provider url
 		if _, err := p.AddItem(item); err != nil {
 			return nil, errors.Wrapf(err, "failed to add item to podcast (id %q)", episode.ID)
 		}
+
+		extended := &Item{Item: p.Items[len(p.Items)-1]}
+		// The provider's video ID is used rather than the enclosure URL, so the GUID survives
+		// changes of hostname, storage or file name templates and apps don't download episodes again
+		extended.EpisodeGUID = &EpisodeGUID{Value: episode.ID}
+		extended.IEpisode = titleNumber(cfg.EpisodeNumberRegexp, episode.Title)
+		extended.ISeason = titleNumber(cfg.SeasonNumberRegexp, episode.Title)
+		if feed.Format == model.FormatAudio && cfg.AudioCodec == model.AudioCodecOpus {
+			extended.Enclosure.TypeFormatted = opusType
+		}
+
+		if cfg.Transcripts {
+			// Not every episode has captions, so only link the transcripts that were actually stored
+			transcriptName := TranscriptName(cfg, episode)
+			if transcriptURL, err := provider.URL(ctx, cfg.ID, transcriptName); err == nil {
+				extended.Transcripts = append(extended.Transcripts, &Transcript{
+					URL:      transcriptURL,
+					Type:     "text/vtt",
+					Language: cfg.Custom.Language,
+				})
+			}
+		}
+
+		if cfg.PublishChapters {
+			if chaptersURL, err := provider.URL(ctx, cfg.ID, ChaptersName(cfg, episode)); err == nil {
+				extended.Chapters = &Chapters{URL: chaptersURL, Type: chaptersType}
+			}
+		}
+
+		result.Items = append(result.Items, extended)
+
+		// Episodes are sorted, so the rest are older (or lower numbered) ones
+		if cfg.FeedLimit > 0 && len(result.Items) >= cfg.FeedLimit {
+			break
+		}
 	}
 
-	return &p, nil
+	// Items are encoded from the extended list
+	p.Items = nil
+
+	return result, nil
+}
+
+// TranscriptName returns a file name of the episode transcript (WebVTT subtitles)
+func TranscriptName(feedConfig *config.Feed, episode *model.Episode) string {
+	return sidecarName(feedConfig, episode, ".vtt")
+}
+
+// ChaptersName returns a file name of the episode chapters JSON
+func ChaptersName(feedConfig *config.Feed, episode *model.Episode) string {
+	return sidecarName(feedConfig, episode, ".chapters.json")
+}
+
+// OriginalName returns a file name of the episode file before SponsorBlock segments were cut out (see keep_original)
+func OriginalName(feedConfig *config.Feed, episode *model.Episode) string {
+	return sidecarName(feedConfig, episode, ".original."+feedConfig.Extension())
 }
 
+// CoverArtName is a file name of the resized feed cover art (see cover_art_resize)
+const CoverArtName = "podsync-cover.jpg"
+
+// ArtworkName returns a file name of the episode artwork (always JPEG)
+func ArtworkName(feedConfig *config.Feed, episode *model.Episode) string {
+	return sidecarName(feedConfig, episode, ".jpg")
+}
+
+// InfoName returns a file name of the episode info JSON
+func InfoName(feedConfig *config.Feed, episode *model.Episode) string {
+	return sidecarName(feedConfig, episode, ".info.json")
+}
+
+// sidecarName replaces the episode file extension with the given suffix
+func sidecarName(feedConfig *config.Feed, episode *model.Episode, suffix string) string {
+	name := EpisodeName(feedConfig, episode)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + suffix
+}
+
+// unsafeFilenameChars are replaced in rendered episode names
+var unsafeFilenameChars = strings.NewReplacer(
+	"/", "_", "\\", "_", ":", "_", "*", "_", "?", "_",
+	"\"", "_", "<", "_", ">", "_", "|", "_",
+)
+
+// EpisodeName returns a file name of the episode, rendered from the feed's filename template if set
 func EpisodeName(feedConfig *config.Feed, episode *model.Episode) string {
-	ext := "mp4"
-	if feedConfig.Format == model.FormatAudio {
-		ext = "mp3"
+	name := episode.ID
+	if feedConfig.FilenameTemplate != "" {
+		rendered, err := renderEpisodeName(feedConfig, episode)
+		if err != nil {
+			log.WithError(err).Warnf("failed to render filename template for episode %q, using episode ID", episode.ID)
+		} else if rendered != "" {
+			name = rendered
+		}
+	}
+
+	return fmt.Sprintf("%s.%s", name, feedConfig.Extension())
+}
+
+func renderEpisodeName(feedConfig *config.Feed, episode *model.Episode) (string, error) {
+	tmpl, err := template.New("filename").Parse(feedConfig.FilenameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		ID      string
+		Title   string
+		PubDate time.Time
+		FeedID  string
+	}{
+		ID:      episode.ID,
+		Title:   episode.Title,
+		PubDate: episode.PubDate,
+		FeedID:  feedConfig.ID,
 	}
 
-	return fmt.Sprintf("%s.%s", episode.ID, ext)
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, buf.String())
+
+	name = unsafeFilenameChars.Replace(name)
+
+	// Leading dots would make the file hidden (or refer to the parent directory)
+	return strings.Trim(name, " ."), nil
 }
@@ -0,0 +1,486 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestEpisodeName(t *testing.T) {
+	episode := &model.Episode{
+		ID:      "abc",
+		Title:   "What's new: 1/2",
+		PubDate: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name     string
+		format   model.Format
+		codec    model.AudioCodec
+		template string
+		expect   string
+	}{
+		{
+			name:   "Default video",
+			format: model.FormatVideo,
+			expect: "abc.mp4",
+		},
+		{
+			name:   "Default audio",
+			format: model.FormatAudio,
+			expect: "abc.mp3",
+		},
+		{
+			name:   "AAC audio",
+			format: model.FormatAudio,
+			codec:  model.AudioCodecAAC,
+			expect: "abc.m4a",
+		},
+		{
+			name:   "Opus audio",
+			format: model.FormatAudio,
+			codec:  model.AudioCodecOpus,
+			expect: "abc.opus",
+		},
+		{
+			name:     "Date and title",
+			format:   model.FormatAudio,
+			template: `{{.PubDate.Format "2006-01-02"}} - {{.Title}}`,
+			expect:   "2023-05-01 - What's new_ 1_2.mp3",
+		},
+		{
+			name:     "Feed ID",
+			format:   model.FormatVideo,
+			template: "{{.FeedID}}-{{.ID}}",
+			expect:   "feed-abc.mp4",
+		},
+		{
+			name:     "Parent directory",
+			format:   model.FormatAudio,
+			template: "../{{.ID}}",
+			expect:   "_abc.mp3",
+		},
+		{
+			name:     "Empty result",
+			format:   model.FormatAudio,
+			template: "{{if false}}x{{end}}",
+			expect:   "abc.mp3",
+		},
+		{
+			name:     "Invalid template",
+			format:   model.FormatAudio,
+			template: "{{.Unknown}}",
+			expect:   "abc.mp3",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			cfg := &config.Feed{ID: "feed", Format: tst.format, AudioCodec: tst.codec, FilenameTemplate: tst.template}
+			assert.Equal(t, tst.expect, EpisodeName(cfg, episode))
+		})
+	}
+}
+
+func TestBuildTranscripts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.mp3").Return("https://url/1/a.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.vtt").Return("https://url/1/a.vtt", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "b.mp3").Return("https://url/1/b.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "b.vtt").Return("", errors.New("not found"))
+
+	now := time.Now()
+	feed := &model.Feed{
+		Title:  "Feed",
+		Format: model.FormatAudio,
+		Episodes: []*model.Episode{
+			{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: now},
+			{ID: "b", Title: "B", Status: model.EpisodeDownloaded, PubDate: now.Add(-time.Hour)},
+		},
+	}
+
+	cfg := &config.Feed{ID: "1", Format: model.FormatAudio, Transcripts: true, Custom: config.Custom{Language: "en"}}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	require.Len(t, podcast.Items, 2)
+	assert.Len(t, podcast.Podcast.Items, 0)
+
+	out := podcast.String()
+	assert.Contains(t, out, `xmlns:podcast="https://podcastindex.org/namespace/1.0"`)
+	assert.Contains(t, out, `<podcast:transcript url="https://url/1/a.vtt" type="text/vtt" language="en"></podcast:transcript>`)
+	assert.Equal(t, 1, strings.Count(out, "<podcast:transcript "))
+	assert.Equal(t, 2, strings.Count(out, "<item>"))
+}
+
+func TestBuildChapters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.mp3").Return("https://url/1/a.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.chapters.json").Return("https://url/1/a.chapters.json", nil)
+
+	feed := &model.Feed{
+		Title:    "Feed",
+		Format:   model.FormatAudio,
+		Episodes: []*model.Episode{{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: time.Now()}},
+	}
+
+	cfg := &config.Feed{ID: "1", Format: model.FormatAudio, PublishChapters: true}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	assert.Contains(t, podcast.String(), `<podcast:chapters url="https://url/1/a.chapters.json" type="application/json+chapters"></podcast:chapters>`)
+}
+
+func TestBuildEpisodeArtwork(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.mp3").Return("https://url/1/a.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.jpg").Return("https://url/1/a.jpg", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "b.mp3").Return("https://url/1/b.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "b.jpg").Return("", errors.New("not found"))
+
+	now := time.Now()
+	feed := &model.Feed{
+		Title:  "Feed",
+		Format: model.FormatAudio,
+		Episodes: []*model.Episode{
+			{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: now, Thumbnail: "https://i.ytimg.com/a.jpg"},
+			{ID: "b", Title: "B", Status: model.EpisodeDownloaded, PubDate: now.Add(-time.Hour), Thumbnail: "https://i.ytimg.com/b.jpg"},
+		},
+	}
+
+	cfg := &config.Feed{ID: "1", Format: model.FormatAudio, EpisodeArtwork: true}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	require.Len(t, podcast.Items, 2)
+	assert.Equal(t, "https://url/1/a.jpg", podcast.Items[0].IImage.HREF)
+
+	// Falls back to the provider's thumbnail if there is no stored artwork
+	assert.Equal(t, "https://i.ytimg.com/b.jpg", podcast.Items[1].IImage.HREF)
+}
+
+func TestBuildEpisodeGUID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.mp3").Return("https://old.host/1/a.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.mp3").Return("https://new.host/1/a.mp3", nil)
+
+	feed := &model.Feed{
+		Title:    "Feed",
+		Format:   model.FormatAudio,
+		Episodes: []*model.Episode{{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: time.Now()}},
+	}
+
+	cfg := &config.Feed{ID: "1", Format: model.FormatAudio}
+
+	var guids []string
+	for _, host := range []string{"https://old.host", "https://new.host"} {
+		podcast, err := Build(context.Background(), feed, cfg, urlMock)
+		require.NoError(t, err)
+		require.Len(t, podcast.Items, 1)
+
+		out := podcast.String()
+		assert.Contains(t, out, host+"/1/a.mp3")
+		assert.Contains(t, out, `<guid isPermaLink="false">a</guid>`)
+		assert.Equal(t, 1, strings.Count(out, "<guid"))
+		guids = append(guids, podcast.Items[0].EpisodeGUID.Value)
+	}
+
+	// Enclosure URL changes with the hostname, the GUID doesn't
+	assert.Equal(t, []string{"a", "a"}, guids)
+}
+
+func TestBuildMediaHostname(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a b.mp3").Return("https://app.host/1/a%20b.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a b.vtt").Return("https://app.host/1/a%20b.vtt", nil)
+
+	feed := &model.Feed{
+		Title:    "Feed",
+		Format:   model.FormatAudio,
+		Episodes: []*model.Episode{{ID: "a", Title: "a b", Status: model.EpisodeDownloaded, PubDate: time.Now()}},
+	}
+
+	cfg := &config.Feed{
+		ID:               "1",
+		Format:           model.FormatAudio,
+		FilenameTemplate: "{{.Title}}",
+		Transcripts:      true,
+		MediaHostname:    "https://cdn.host/podsync/",
+	}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	require.Len(t, podcast.Items, 1)
+	assert.Equal(t, "https://cdn.host/podsync/1/a%20b.mp3", podcast.Items[0].Enclosure.URL)
+	assert.Equal(t, "https://cdn.host/podsync/1/a%20b.vtt", podcast.Items[0].Transcripts[0].URL)
+}
+
+func TestBuildCoverArt(t *testing.T) {
+	feed := &model.Feed{Title: "Feed", CoverArt: "https://provider/art.jpg"}
+	cfg := &config.Feed{ID: "1", Custom: config.Custom{CoverArt: "https://custom/art.png"}}
+
+	podcast, err := Build(context.Background(), feed, cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://custom/art.png", podcast.IImage.HREF)
+
+	// Resized copy is passed as the feed's cover art
+	cfg.Custom.CoverArtResize = true
+	feed.CoverArt = "http://localhost/1/podsync-cover.jpg"
+	podcast, err = Build(context.Background(), feed, cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/1/podsync-cover.jpg", podcast.IImage.HREF)
+}
+
+func TestBuildPodcastGUID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	feed := &model.Feed{Title: "Feed", Format: model.FormatAudio}
+
+	cfg := &config.Feed{ID: "1", URL: "https://podnews.net/rss", Format: model.FormatAudio}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	assert.Contains(t, podcast.String(), "<podcast:guid>9b024349-ccf0-5f69-a609-6b82873eab3c</podcast:guid>")
+	assert.NotContains(t, podcast.String(), "podcast:locked")
+
+	cfg.Custom = config.Custom{PodcastGUID: "917393e3-1b1e-5cef-ace4-edaa54e1f810", Locked: true, OwnerEmail: "me@example.com"}
+
+	podcast, err = Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	assert.Contains(t, podcast.String(), "<podcast:guid>917393e3-1b1e-5cef-ace4-edaa54e1f810</podcast:guid>")
+	assert.Contains(t, podcast.String(), `<podcast:locked owner="me@example.com">yes</podcast:locked>`)
+}
+
+func TestBuildBlockComplete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	feed := &model.Feed{Title: "Feed", Format: model.FormatAudio}
+
+	cfg := &config.Feed{ID: "1", Format: model.FormatAudio}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	assert.NotContains(t, podcast.String(), "itunes:block")
+	assert.NotContains(t, podcast.String(), "itunes:complete")
+
+	cfg.Custom = config.Custom{Block: true, Complete: true}
+
+	podcast, err = Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	assert.Contains(t, podcast.String(), "<itunes:block>Yes</itunes:block>")
+	assert.Contains(t, podcast.String(), "<itunes:complete>Yes</itunes:complete>")
+}
+
+func TestBuildAudioCodec(t *testing.T) {
+	tests := []struct {
+		codec  model.AudioCodec
+		name   string
+		expect string
+	}{
+		{codec: model.AudioCodecMP3, name: "a.mp3", expect: "audio/mpeg"},
+		{codec: model.AudioCodecAAC, name: "a.m4a", expect: "audio/x-m4a"},
+		{codec: model.AudioCodecOpus, name: "a.opus", expect: "audio/ogg"},
+	}
+
+	for _, tst := range tests {
+		t.Run(string(tst.codec), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlMock := NewMockurlProvider(ctrl)
+			urlMock.EXPECT().URL(gomock.Any(), "1", tst.name).Return("https://url/1/"+tst.name, nil)
+
+			feed := &model.Feed{
+				Title:    "Feed",
+				Format:   model.FormatAudio,
+				Episodes: []*model.Episode{{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: time.Now()}},
+			}
+
+			cfg := &config.Feed{ID: "1", Format: model.FormatAudio, AudioCodec: tst.codec}
+
+			podcast, err := Build(context.Background(), feed, cfg, urlMock)
+			require.NoError(t, err)
+			require.Len(t, podcast.Items, 1)
+			assert.Equal(t, tst.expect, podcast.Items[0].Enclosure.TypeFormatted)
+		})
+	}
+}
+
+func TestBuildActualDuration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", gomock.Any()).Return("https://url/1/a.mp3", nil).Times(2)
+
+	now := time.Now()
+	feed := &model.Feed{
+		Title:  "Feed",
+		Format: model.FormatAudio,
+		Episodes: []*model.Episode{
+			{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: now, Duration: 100, ActualDuration: 90},
+			{ID: "b", Title: "B", Status: model.EpisodeDownloaded, PubDate: now.Add(-time.Hour), Duration: 100},
+		},
+	}
+
+	cfg := &config.Feed{ID: "1", Format: model.FormatAudio}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	require.Len(t, podcast.Items, 2)
+	assert.Equal(t, "1:30", podcast.Items[0].IDuration)
+	assert.Equal(t, "1:40", podcast.Items[1].IDuration)
+}
+
+func TestBuildFeedLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "a.mp3").Return("https://url/1/a.mp3", nil)
+	urlMock.EXPECT().URL(gomock.Any(), "1", "c.mp3").Return("https://url/1/c.mp3", nil)
+
+	now := time.Now()
+	feed := &model.Feed{
+		Title:  "Feed",
+		Format: model.FormatAudio,
+		Episodes: []*model.Episode{
+			{ID: "d", Title: "D", Status: model.EpisodeDownloaded, PubDate: now.Add(-3 * time.Hour)},
+			{ID: "c", Title: "C", Status: model.EpisodeDownloaded, PubDate: now.Add(-2 * time.Hour)},
+			{ID: "b", Title: "B", Status: model.EpisodeNew, PubDate: now.Add(-time.Hour)},
+			{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: now},
+		},
+	}
+
+	cfg := &config.Feed{ID: "1", Format: model.FormatAudio, FeedLimit: 2}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	require.Len(t, podcast.Items, 2)
+	assert.Equal(t, "a", podcast.Items[0].GUID)
+	assert.Equal(t, "c", podcast.Items[1].GUID)
+}
+
+func TestBuildOrderByTitle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", gomock.Any()).Return("https://url/1/file.mp3", nil).AnyTimes()
+
+	now := time.Now()
+	feed := &model.Feed{
+		Title:  "Feed",
+		Format: model.FormatAudio,
+		Episodes: []*model.Episode{
+			{ID: "p1", Title: "Part 1 (re-upload)", Status: model.EpisodeDownloaded, PubDate: now},
+			{ID: "trailer", Title: "Trailer", Status: model.EpisodeDownloaded, PubDate: now.Add(-time.Hour)},
+			{ID: "p3", Title: "Part 3", Status: model.EpisodeDownloaded, PubDate: now.Add(-2 * time.Hour)},
+			{ID: "p10", Title: "Part 10", Status: model.EpisodeDownloaded, PubDate: now.Add(-3 * time.Hour)},
+			{ID: "p2", Title: "Part 2", Status: model.EpisodeDownloaded, PubDate: now.Add(-4 * time.Hour)},
+			{ID: "bonus", Title: "Bonus", Status: model.EpisodeDownloaded, PubDate: now.Add(-5 * time.Hour)},
+		},
+	}
+
+	cfg := &config.Feed{
+		ID:          "1",
+		Format:      model.FormatAudio,
+		OrderBy:     model.OrderByTitleRegex,
+		OrderRegexp: regexp.MustCompile(`Part (\d+)`),
+	}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, item := range podcast.Items {
+		ids = append(ids, item.GUID)
+	}
+	// Episodes without a number go last, newest first
+	assert.Equal(t, []string{"p10", "p3", "p2", "p1", "trailer", "bonus"}, ids)
+}
+
+func TestBuildEpisodeNumbers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlMock := NewMockurlProvider(ctrl)
+	urlMock.EXPECT().URL(gomock.Any(), "1", gomock.Any()).Return("https://localhost/1/file.mp3", nil).AnyTimes()
+
+	now := time.Now()
+	feed := &model.Feed{
+		Title: "Feed",
+		Episodes: []*model.Episode{
+			{ID: "a", Title: "S02E07 - Title", Status: model.EpisodeDownloaded, PubDate: now},
+			{ID: "b", Title: "Episode 8", Status: model.EpisodeDownloaded, PubDate: now.Add(-time.Hour)},
+			{ID: "c", Title: "Trailer", Status: model.EpisodeDownloaded, PubDate: now.Add(-2 * time.Hour)},
+		},
+	}
+
+	cfg := &config.Feed{
+		ID:                  "1",
+		Format:              model.FormatAudio,
+		EpisodeNumberRegexp: regexp.MustCompile(`(?:E|Episode )(\d+)`),
+		SeasonNumberRegexp:  regexp.MustCompile(`S(\d+)`),
+	}
+
+	podcast, err := Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	require.Len(t, podcast.Items, 3)
+
+	assert.Equal(t, "7", podcast.Items[0].IEpisode)
+	assert.Equal(t, "2", podcast.Items[0].ISeason)
+	assert.Equal(t, "8", podcast.Items[1].IEpisode)
+	assert.Empty(t, podcast.Items[1].ISeason)
+	assert.Empty(t, podcast.Items[2].IEpisode)
+
+	out := podcast.String()
+	assert.Contains(t, out, "<itunes:episode>7</itunes:episode>")
+	assert.Contains(t, out, "<itunes:season>2</itunes:season>")
+	assert.Equal(t, 2, strings.Count(out, "<itunes:episode>"))
+
+	// Not configured
+	cfg.EpisodeNumberRegexp, cfg.SeasonNumberRegexp = nil, nil
+	podcast, err = Build(context.Background(), feed, cfg, urlMock)
+	require.NoError(t, err)
+	assert.NotContains(t, podcast.String(), "<itunes:episode>")
+	assert.NotContains(t, podcast.String(), "<itunes:season>")
+}
+
+func TestTitleNumber(t *testing.T) {
+	pattern := regexp.MustCompile(`#(\S+)`)
+	assert.Equal(t, "12", titleNumber(pattern, "Show #012"))
+	assert.Empty(t, titleNumber(pattern, "Show #0"))
+	assert.Empty(t, titleNumber(pattern, "Show #one"))
+	assert.Empty(t, titleNumber(pattern, "Show"))
+	assert.Empty(t, titleNumber(nil, "Show #1"))
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// FreeSpace returns the number of bytes available to unprivileged users on the file system containing path
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, errors.Wrapf(err, "failed to get file system stats of %s", path)
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
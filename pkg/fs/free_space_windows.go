@@ -0,0 +1,25 @@
+package fs
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// FreeSpace returns the number of bytes available to the current user on the volume containing path
+func FreeSpace(path string) (uint64, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	if ret, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&available)), 0, 0); ret == 0 {
+		return 0, errors.Wrapf(err, "failed to get free space of %s", path)
+	}
+
+	return available, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -59,6 +61,55 @@ func (l *Local) Create(ctx context.Context, ns string, fileName string, reader i
 	return written, nil
 }
 
+// Link creates a hard link, so deleting either of the files doesn't affect the other one
+func (l *Local) Link(ctx context.Context, srcNs string, srcFileName string, ns string, fileName string) (int64, error) {
+	var (
+		source  = filepath.Join(l.rootDir, srcNs, srcFileName)
+		feedDir = filepath.Join(l.rootDir, ns)
+	)
+
+	stat, err := os.Stat(source)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(feedDir, 0755); err != nil {
+		return 0, errors.Wrapf(err, "failed to create feed dir: %s", feedDir)
+	}
+
+	if err := os.Link(source, filepath.Join(feedDir, fileName)); err != nil {
+		return 0, errors.Wrap(err, "failed to link file")
+	}
+
+	return stat.Size(), nil
+}
+
+func (l *Local) Open(ctx context.Context, ns string, fileName string) (io.ReadCloser, error) {
+	path := filepath.Join(l.rootDir, ns, fileName)
+	return os.Open(path)
+}
+
+func (l *Local) Walk(ctx context.Context, ns string, cb func(fileName string) error) error {
+	files, err := ioutil.ReadDir(filepath.Join(l.rootDir, ns))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		if err := cb(file.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (l *Local) Delete(ctx context.Context, ns string, fileName string) error {
 	path := filepath.Join(l.rootDir, ns, fileName)
 	return os.Remove(path)
@@ -80,6 +131,9 @@ func (l *Local) URL(ctx context.Context, ns string, fileName string) (string, er
 		return "", errors.Wrap(err, "failed to check whether file exists")
 	}
 
+	// File names may contain spaces and other characters when rendered from a template
+	fileName = url.PathEscape(fileName)
+
 	if ns == "" {
 		return fmt.Sprintf("%s/%s", l.hostname, fileName), nil
 	}
@@ -87,18 +141,34 @@ func (l *Local) URL(ctx context.Context, ns string, fileName string) (string, er
 	return fmt.Sprintf("%s/%s/%s", l.hostname, ns, fileName), nil
 }
 
+// copyFile writes to a temporary file first and renames it when done,
+// so an interrupted copy never leaves a partial file at the destination path
 func (l *Local) copyFile(source io.Reader, destinationPath string) (int64, error) {
-	dest, err := os.Create(destinationPath)
+	partPath := destinationPath + ".part"
+
+	dest, err := os.Create(partPath)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to create destination file")
 	}
 
-	defer dest.Close()
-
 	written, err := io.Copy(dest, source)
+	if err == nil {
+		// Flush data before renaming, otherwise a crash might leave an empty file in place of the old one
+		err = dest.Sync()
+	}
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+
 	if err != nil {
+		os.Remove(partPath)
 		return 0, errors.Wrap(err, "failed to copy data")
 	}
 
+	if err := os.Rename(partPath, destinationPath); err != nil {
+		os.Remove(partPath)
+		return 0, errors.Wrap(err, "failed to rename destination file")
+	}
+
 	return written, nil
 }
@@ -3,6 +3,8 @@ package fs
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -61,6 +63,64 @@ func TestLocal_Size(t *testing.T) {
 	assert.EqualValues(t, 5, sz)
 }
 
+func TestLocal_Open(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "podsync-local-stor-")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	stor, err := NewLocal(tmpDir, "localhost")
+	assert.NoError(t, err)
+
+	_, err = stor.Create(testCtx, "1", "test", bytes.NewBuffer([]byte{1, 5, 7, 8, 3}))
+	assert.NoError(t, err)
+
+	reader, err := stor.Open(testCtx, "1", "test")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 5, 7, 8, 3}, data)
+
+	_, err = stor.Open(testCtx, "1", "missing")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLocal_Walk(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "podsync-local-stor-")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	stor, err := NewLocal(tmpDir, "localhost")
+	assert.NoError(t, err)
+
+	for _, name := range []string{"b", "a"} {
+		_, err = stor.Create(testCtx, "1", name, bytes.NewBufferString("data"))
+		require.NoError(t, err)
+	}
+	_, err = stor.Create(testCtx, "", "1.xml", bytes.NewBufferString("<rss/>"))
+	require.NoError(t, err)
+
+	walk := func(ns string) []string {
+		var files []string
+		require.NoError(t, stor.Walk(testCtx, ns, func(fileName string) error {
+			files = append(files, fileName)
+			return nil
+		}))
+		return files
+	}
+
+	assert.Equal(t, []string{"a", "b"}, walk("1"))
+	// Feed directories are not listed
+	assert.Equal(t, []string{"1.xml"}, walk(""))
+	assert.Empty(t, walk("missing"))
+
+	stop := errors.New("stop")
+	assert.Equal(t, stop, stor.Walk(testCtx, "1", func(string) error { return stop }))
+}
+
 func TestLocal_NoSize(t *testing.T) {
 	stor, err := NewLocal("", "localhost")
 	assert.NoError(t, err)
@@ -106,6 +166,13 @@ func TestLocal_URL(t *testing.T) {
 	url, err := stor.URL(testCtx, "1", "test")
 	assert.NoError(t, err)
 	assert.EqualValues(t, "http://localhost/1/test", url)
+
+	_, err = stor.Create(testCtx, "1", "2023-05-01 - Title #1.mp3", bytes.NewBuffer([]byte{1}))
+	assert.NoError(t, err)
+
+	url, err = stor.URL(testCtx, "1", "2023-05-01 - Title #1.mp3")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "http://localhost/1/2023-05-01%20-%20Title%20%231.mp3", url)
 }
 
 func TestLocal_copyFile(t *testing.T) {
@@ -127,3 +194,79 @@ func TestLocal_copyFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, 3, stat.Size())
 }
+
+func TestLocal_Link(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "podsync-local-stor-")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	stor, err := NewLocal(tmpDir, "localhost")
+	assert.NoError(t, err)
+
+	_, err = stor.Create(testCtx, "1", "test", bytes.NewBuffer([]byte{1, 5, 7, 8, 3}))
+	assert.NoError(t, err)
+
+	size, err := stor.Link(testCtx, "1", "test", "2", "linked")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+
+	// Deleting the source doesn't affect the link
+	err = stor.Delete(testCtx, "1", "test")
+	assert.NoError(t, err)
+
+	sz, err := stor.Size(testCtx, "2", "linked")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, sz)
+
+	_, err = stor.Link(testCtx, "1", "missing", "2", "missing")
+	assert.True(t, os.IsNotExist(err))
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("interrupted")
+}
+
+func TestLocal_CreateKeepsOldFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "podsync-local-stor-")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	stor, err := NewLocal(tmpDir, "localhost")
+	assert.NoError(t, err)
+
+	_, err = stor.Create(testCtx, "", "1.xml", bytes.NewBufferString("<rss>old</rss>"))
+	require.NoError(t, err)
+
+	// Failed write of the new feed doesn't affect the one being served
+	_, err = stor.Create(testCtx, "", "1.xml", io.MultiReader(bytes.NewBufferString("<rss>ne"), failingReader{}))
+	assert.Error(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(tmpDir, "1.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<rss>old</rss>", string(data))
+
+	_, err = os.Stat(filepath.Join(tmpDir, "1.xml.part"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLocal_CreateInterrupted(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "podsync-local-stor-")
+	require.NoError(t, err)
+
+	defer os.RemoveAll(tmpDir)
+
+	stor, err := NewLocal(tmpDir, "localhost")
+	assert.NoError(t, err)
+
+	_, err = stor.Create(testCtx, "1", "test", io.MultiReader(bytes.NewBuffer([]byte{1, 5, 7}), failingReader{}))
+	assert.Error(t, err)
+
+	// Neither partial nor temporary file is left behind
+	files, err := ioutil.ReadDir(filepath.Join(tmpDir, "1"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,215 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+// S3 keeps files in S3 compatible object storage
+type S3 struct {
+	api       s3iface.S3API
+	uploader  *s3manager.Uploader
+	bucket    string
+	prefix    string
+	publicURL string
+}
+
+func NewS3(cfg *config.S3) (*S3, error) {
+	awsConfig := aws.NewConfig()
+
+	if cfg.Region != "" {
+		awsConfig = awsConfig.WithRegion(cfg.Region)
+	}
+
+	if cfg.EndpointURL != "" {
+		// Most S3 compatible services don't support virtual-hosted buckets
+		awsConfig = awsConfig.WithEndpoint(cfg.EndpointURL).WithS3ForcePathStyle(true)
+	}
+
+	if cfg.AccessKey != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, ""))
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create S3 session")
+	}
+
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		if cfg.EndpointURL != "" {
+			publicURL = fmt.Sprintf("%s/%s", strings.TrimSuffix(cfg.EndpointURL, "/"), cfg.Bucket)
+		} else {
+			publicURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, aws.StringValue(sess.Config.Region))
+		}
+	}
+
+	api := s3.New(sess)
+
+	return &S3{
+		api:       api,
+		uploader:  s3manager.NewUploaderWithClient(api),
+		bucket:    cfg.Bucket,
+		prefix:    strings.Trim(cfg.Prefix, "/"),
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}, nil
+}
+
+// Create uploads the file, large files are streamed in parts instead of being read into memory.
+// Objects are replaced atomically, a failed upload (including multipart) keeps the old object.
+func (s *S3) Create(ctx context.Context, ns string, fileName string, reader io.Reader) (int64, error) {
+	var (
+		key     = s.key(ns, fileName)
+		counter = &countingReader{reader: reader}
+		logger  = log.WithField("episode_id", fileName)
+	)
+
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   counter,
+	}
+
+	// Podcast apps rely on content type of episodes
+	if contentType := ContentType(fileName); contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	logger.Debugf("uploading to s3://%s/%s", s.bucket, key)
+	if _, err := s.uploader.UploadWithContext(ctx, input); err != nil {
+		return 0, errors.Wrap(err, "failed to upload file")
+	}
+
+	logger.Debugf("uploaded %d bytes", counter.count)
+	return counter.count, nil
+}
+
+// Open downloads the object, missing objects are reported as os.ErrNotExist
+func (s *S3) Open(ctx context.Context, ns string, fileName string) (io.ReadCloser, error) {
+	key := s.key(ns, fileName)
+
+	object, err := s.api.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() == http.StatusNotFound {
+			return nil, &os.PathError{Op: "open", Path: key, Err: os.ErrNotExist}
+		}
+
+		return nil, errors.Wrapf(err, "failed to get %q", key)
+	}
+
+	return object.Body, nil
+}
+
+// Walk lists objects under the namespace prefix, deeper keys are grouped into common prefixes and skipped
+func (s *S3) Walk(ctx context.Context, ns string, cb func(fileName string) error) error {
+	prefix := s.key(ns, "")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var cbErr error
+	err := s.api.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			if cbErr = cb(strings.TrimPrefix(aws.StringValue(object.Key), prefix)); cbErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to list objects")
+	}
+
+	return cbErr
+}
+
+func (s *S3) Delete(ctx context.Context, ns string, fileName string) error {
+	key := s.key(ns, fileName)
+
+	// S3 doesn't report missing objects on delete, so check first to behave like local storage
+	if _, err := s.Size(ctx, ns, fileName); err != nil {
+		return err
+	}
+
+	if _, err := s.api.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return errors.Wrapf(err, "failed to delete %q", key)
+	}
+
+	return nil
+}
+
+// Size returns the size of an object, missing objects are reported as os.ErrNotExist
+func (s *S3) Size(ctx context.Context, ns string, fileName string) (int64, error) {
+	key := s.key(ns, fileName)
+
+	head, err := s.api.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() == http.StatusNotFound {
+			return 0, &os.PathError{Op: "stat", Path: key, Err: os.ErrNotExist}
+		}
+
+		return 0, errors.Wrapf(err, "failed to get %q info", key)
+	}
+
+	return aws.Int64Value(head.ContentLength), nil
+}
+
+func (s *S3) URL(ctx context.Context, ns string, fileName string) (string, error) {
+	if _, err := s.Size(ctx, ns, fileName); err != nil {
+		return "", errors.Wrap(err, "failed to check whether file exists")
+	}
+
+	parts := strings.Split(s.key(ns, fileName), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+
+	return fmt.Sprintf("%s/%s", s.publicURL, strings.Join(parts, "/")), nil
+}
+
+func (s *S3) key(ns string, fileName string) string {
+	return path.Join(s.prefix, ns, fileName)
+}
+
+// countingReader counts bytes read from the underlying reader
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+// fakeS3 is a minimal in-memory implementation of S3 object API
+type fakeS3 struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") == "2" {
+			f.list(w, r)
+			return
+		}
+
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	case http.MethodHead:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list responds with objects of the bucket matching prefix, keys containing delimiter after prefix are skipped
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var (
+		bucket    = strings.Trim(r.URL.Path, "/") + "/"
+		prefix    = r.URL.Query().Get("prefix")
+		delimiter = r.URL.Query().Get("delimiter")
+		keys      []string
+	)
+
+	for name := range f.objects {
+		key := strings.TrimPrefix(name, "/"+bucket)
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" && strings.Contains(strings.TrimPrefix(key, prefix), delimiter) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><IsTruncated>false</IsTruncated>`)
+	for _, key := range keys {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", key)
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	stor, err := NewS3(&config.S3{
+		Bucket:      "podsync",
+		Region:      "us-east-1",
+		EndpointURL: server.URL,
+		Prefix:      "/feeds/",
+		AccessKey:   "key",
+		SecretKey:   "secret",
+		PublicURL:   "https://cdn.example.com/",
+	})
+	require.NoError(t, err)
+
+	_, err = stor.Size(testCtx, "1", "a.mp3")
+	assert.True(t, os.IsNotExist(err))
+
+	written, err := stor.Create(testCtx, "1", "a.mp3", bytes.NewBuffer([]byte{1, 5, 7, 8, 3}))
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, written)
+	assert.Equal(t, []byte{1, 5, 7, 8, 3}, fake.objects["/podsync/feeds/1/a.mp3"])
+	assert.Equal(t, "audio/mpeg", fake.types["/podsync/feeds/1/a.mp3"])
+
+	size, err := stor.Size(testCtx, "1", "a.mp3")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, size)
+
+	url, err := stor.URL(testCtx, "1", "a.mp3")
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/feeds/1/a.mp3", url)
+
+	reader, err := stor.Open(testCtx, "1", "a.mp3")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 5, 7, 8, 3}, data)
+
+	_, err = stor.Create(testCtx, "", "1.xml", bytes.NewBufferString("<rss/>"))
+	require.NoError(t, err)
+
+	var files []string
+	require.NoError(t, stor.Walk(testCtx, "1", func(fileName string) error {
+		files = append(files, fileName)
+		return nil
+	}))
+	assert.Equal(t, []string{"a.mp3"}, files)
+
+	files = nil
+	require.NoError(t, stor.Walk(testCtx, "", func(fileName string) error {
+		files = append(files, fileName)
+		return nil
+	}))
+	assert.Equal(t, []string{"1.xml"}, files)
+
+	require.NoError(t, stor.Delete(testCtx, "", "1.xml"))
+
+	err = stor.Delete(testCtx, "1", "a.mp3")
+	require.NoError(t, err)
+	assert.Empty(t, fake.objects)
+
+	err = stor.Delete(testCtx, "1", "a.mp3")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = stor.Open(testCtx, "1", "a.mp3")
+	assert.True(t, os.IsNotExist(err))
+}
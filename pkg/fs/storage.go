@@ -3,10 +3,31 @@ package fs
 import (
 	"context"
 	"io"
+	"mime"
+	"path/filepath"
 )
 
+// contentTypes of episode files, these are not always known to the system mime database
+var contentTypes = map[string]string{
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".opus": "audio/ogg",
+	".vtt":  "text/vtt",
+}
+
+// ContentType returns the content type of a file by its extension, or an empty string if unknown
+func ContentType(fileName string) string {
+	ext := filepath.Ext(fileName)
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
 type Storage interface {
-	// Create will create a new file from reader
+	// Create will create a new file from reader. Existing files are replaced atomically,
+	// so a failed or interrupted write never leaves a partial file (e.g. a truncated feed XML)
 	Create(ctx context.Context, ns string, fileName string, reader io.Reader) (int64, error)
 
 	// Delete deletes the file
@@ -18,3 +39,22 @@ type Storage interface {
 	// URL will generate a download link for a file
 	URL(ctx context.Context, ns string, fileName string) (string, error)
 }
+
+// Opener is implemented by storages able to read files back (e.g. to transcode them)
+type Opener interface {
+	// Open returns a reader of the file, missing files are reported as os.ErrNotExist
+	Open(ctx context.Context, ns string, fileName string) (io.ReadCloser, error)
+}
+
+// Linker is implemented by storages able to share a file between namespaces without copying it
+type Linker interface {
+	// Link makes the file available under another namespace and name, returns its size in bytes
+	Link(ctx context.Context, srcNs string, srcFileName string, ns string, fileName string) (int64, error)
+}
+
+// Walker is implemented by storages able to list files
+type Walker interface {
+	// Walk calls cb with the name of each file in the namespace (files in subdirectories are not listed).
+	// Missing namespaces have no files.
+	Walk(ctx context.Context, ns string, cb func(fileName string) error) error
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "podsync"
+
+var labels = []string{"feed_id", "provider"}
+
+var (
+	episodesDownloaded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "episodes_downloaded_total",
+		Help:      "Total number of downloaded episodes",
+	}, labels)
+
+	downloadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_failures_total",
+		Help:      "Total number of failed episode downloads",
+	}, labels)
+
+	bytesDownloaded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Total size of downloaded episodes in bytes",
+	}, labels)
+
+	segmentsCut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sponsorblock_segments_cut_total",
+		Help:      "Total number of SponsorBlock segments cut out of episodes",
+	}, labels)
+
+	updateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "update_duration_seconds",
+		Help:      "Duration of feed updates in seconds",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14), // 1s .. ~2.3h
+	}, labels)
+)
+
+func init() {
+	prometheus.MustRegister(
+		episodesDownloaded,
+		downloadFailures,
+		bytesDownloaded,
+		segmentsCut,
+		updateDuration,
+	)
+}
+
+// Handler returns HTTP handler to expose metrics to Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// EpisodeDownloaded records a successfully downloaded episode of the given size
+func EpisodeDownloaded(feedID, provider string, size int64) {
+	episodesDownloaded.WithLabelValues(feedID, provider).Inc()
+	bytesDownloaded.WithLabelValues(feedID, provider).Add(float64(size))
+}
+
+// DownloadFailed records a failed episode download
+func DownloadFailed(feedID, provider string) {
+	downloadFailures.WithLabelValues(feedID, provider).Inc()
+}
+
+// SegmentsCut records the number of SponsorBlock segments cut out of an episode
+func SegmentsCut(feedID, provider string, count int) {
+	segmentsCut.WithLabelValues(feedID, provider).Add(float64(count))
+}
+
+// UpdateCompleted records the duration of a successful feed update
+func UpdateCompleted(feedID, provider string, elapsed time.Duration) {
+	updateDuration.WithLabelValues(feedID, provider).Observe(elapsed.Seconds())
+}
@@ -5,11 +5,26 @@ import (
 )
 
 const (
-	DefaultFormat        = FormatVideo
-	DefaultQuality       = QualityHigh
-	DefaultPageSize      = 50
-	DefaultUpdatePeriod  = 6 * time.Hour
-	DefaultLogMaxSize    = 50 // megabytes
-	DefaultLogMaxAge     = 30 // days
-	DefaultLogMaxBackups = 7
+	DefaultFormat              = FormatVideo
+	DefaultQuality             = QualityHigh
+	DefaultAudioCodec          = AudioCodecMP3
+	DefaultPageSize            = 50
+	DefaultConcurrency         = 1
+	DefaultUpdatePeriod        = 6 * time.Hour
+	DefaultLogMaxSize          = 50 // megabytes
+	DefaultLogMaxAge           = 30 // days
+	DefaultLogMaxBackups       = 7
+	DefaultLogFormat           = "text"
+	DefaultRetryBackoff        = 10 * time.Second
+	DefaultFFmpegPath          = "ffmpeg"
+	DefaultFFprobePath         = "ffprobe"
+	DefaultDownloadOrder       = DownloadOrderNewestFirst
+	DefaultPageSizeMode        = PageSizeQueued
+	DefaultOrderBy             = OrderByPubDate
+	DefaultSponsorBlockURL     = "https://sponsor.ajay.app"
+	DefaultSponsorBlockTimeout = 30 * time.Second
+	DefaultLoudnessTarget      = -16 // LUFS
+	DefaultStorageType         = StorageLocal
+	DefaultShutdownTimeout     = time.Minute
+	DefaultHookTimeout         = time.Minute
 )
@@ -20,6 +20,59 @@ const (
 	FormatVideo = Format("video")
 )
 
+// AudioCodec to encode episodes of audio feeds with
+type AudioCodec string
+
+const (
+	AudioCodecMP3  = AudioCodec("mp3")
+	AudioCodecAAC  = AudioCodec("aac")
+	AudioCodecOpus = AudioCodec("opus")
+)
+
+// Extension returns the file extension of episodes encoded with the codec
+func (c AudioCodec) Extension() string {
+	switch c {
+	case AudioCodecAAC:
+		return "m4a"
+	case AudioCodecOpus:
+		return "opus"
+	default:
+		return "mp3"
+	}
+}
+
+// DownloadOrder to use when queueing episodes for download
+type DownloadOrder string
+
+const (
+	DownloadOrderNewestFirst = DownloadOrder("newest_first")
+	DownloadOrderOldestFirst = DownloadOrder("oldest_first")
+)
+
+// PageSizeMode selects episodes counted toward page_size when queueing downloads
+type PageSizeMode string
+
+const (
+	PageSizeQueued  = PageSizeMode("queued")  // Up to page_size episodes are downloaded each update
+	PageSizeScanned = PageSizeMode("scanned") // Only the page_size newest episodes are downloaded, whatever their status
+)
+
+// OrderBy is the order of episodes in feed XML
+type OrderBy string
+
+const (
+	OrderByPubDate    = OrderBy("pubdate")     // Newest episodes first
+	OrderByTitleRegex = OrderBy("title_regex") // Highest numbers extracted from titles first
+)
+
+// StorageType is a backend to keep feeds and episode files in
+type StorageType string
+
+const (
+	StorageLocal = StorageType("local")
+	StorageS3    = StorageType("s3")
+)
+
 type Episode struct {
 	// ID of episode
 	ID          string        `json:"id"`
@@ -32,13 +85,28 @@ type Episode struct {
 	Size        int64         `json:"size"`
 	Order       string        `json:"order"`
 	Status      EpisodeStatus `json:"status"` // Disk status
+
+	// Duration of the downloaded file if it differs from the source one (e.g. after cutting SponsorBlock segments).
+	// Episodes stored before this field was added decode to 0 and fall back to Duration.
+	ActualDuration int64 `json:"actual_duration,omitempty"`
+
+	// Live is set for live streams and premieres which haven't ended when the episode was listed,
+	// their status is checked again before downloading.
+	Live bool `json:"live,omitempty"`
+
+	// Parent is the ID of the episode this one was split from by chapters (see split_by_chapters)
+	Parent string `json:"parent,omitempty"`
+
+	// Redownload is set by the redownload command. Such episodes are kept in database when they are
+	// no longer listed by the provider (e.g. older than page_size), so they are actually downloaded again.
+	Redownload bool `json:"redownload,omitempty"`
 }
 
 type Feed struct {
 	ID             string     `json:"feed_id"`
 	ItemID         string     `json:"item_id"`
 	LinkType       Type       `json:"link_type"` // Either group, channel or user
-	Provider       Provider   `json:"provider"`  // Youtube or Vimeo
+	Provider       Provider   `json:"provider"`  // Youtube, Vimeo, SoundCloud, Bitchute or Odysee
 	CreatedAt      time.Time  `json:"created_at"`
 	LastAccess     time.Time  `json:"last_access"`
 	ExpirationTime time.Time  `json:"expiration_time"`
@@ -53,6 +121,15 @@ type Feed struct {
 	ItemURL        string     `json:"item_url"` // Platform specific URL
 	Episodes       []*Episode `json:"-"`        // Array of episodes
 	UpdatedAt      time.Time  `json:"updated_at"`
+	Seeded         bool       `json:"seeded,omitempty"` // The whole feed was fetched once (see backfill option)
+}
+
+// FeedStatus is the outcome of the latest feed updates
+type FeedStatus struct {
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at"`
+	Failures    int       `json:"failures"` // Updates failed in a row
 }
 
 type EpisodeStatus string
@@ -62,4 +139,7 @@ const (
 	EpisodeDownloaded = EpisodeStatus("downloaded") // Downloaded, encoded and available for download
 	EpisodeError      = EpisodeStatus("error")      // Could not download, will retry
 	EpisodeCleaned    = EpisodeStatus("cleaned")    // Downloaded and later removed from disk due to update strategy
+	EpisodeSplit      = EpisodeStatus("split")      // Downloaded and split into episodes by chapters, has no file of its own
+	EpisodeIgnored    = EpisodeStatus("ignored")    // Skipped for a newer episode (see latest_only), never downloaded
+	EpisodeTooLarge   = EpisodeStatus("too_large")  // Refused by the downloader due to max_filesize, never downloaded
 )
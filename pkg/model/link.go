@@ -12,13 +12,16 @@ const (
 type Provider string
 
 const (
-	ProviderYoutube = Provider("youtube")
-	ProviderVimeo   = Provider("vimeo")
+	ProviderYoutube    = Provider("youtube")
+	ProviderVimeo      = Provider("vimeo")
+	ProviderSoundCloud = Provider("soundcloud")
+	ProviderBitchute   = Provider("bitchute")
+	ProviderOdysee     = Provider("odysee")
 )
 
 // Info represents data extracted from URL
 type Info struct {
 	LinkType Type     // Either group, channel or user
-	Provider Provider // Youtube or Vimeo
+	Provider Provider // Youtube, Vimeo, SoundCloud, Bitchute or Odysee
 	ItemID   string
 }
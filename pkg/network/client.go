@@ -0,0 +1,45 @@
+package network
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+// NewClient creates an HTTP client for outbound requests.
+// Requests are sent through the configured proxy (or the one from HTTP_PROXY/HTTPS_PROXY environment variables)
+// with the configured User-Agent header.
+func NewClient(cfg *config.Network) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse proxy URL %q", cfg.Proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &http.Client{Transport: &userAgentTransport{next: transport, userAgent: cfg.UserAgent}}, nil
+}
+
+// userAgentTransport sets User-Agent header of outgoing requests
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent == "" {
+		return t.next.RoundTrip(req)
+	}
+
+	// RoundTripper must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
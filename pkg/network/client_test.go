@@ -0,0 +1,47 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+func TestNewClient_UserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&config.Network{UserAgent: "podsync-test"})
+	require.NoError(t, err)
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "podsync-test", userAgent)
+}
+
+func TestNewClient_Proxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Proxied requests have absolute URLs
+		requested = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(&config.Network{Proxy: proxy.URL})
+	require.NoError(t, err)
+
+	resp, err := client.Get("http://podsync.invalid/api")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "http://podsync.invalid/api", requested)
+}
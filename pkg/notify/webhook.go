@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+)
+
+const (
+	defaultTemplate = "New episode in {{.FeedID}}: {{.Title}} {{.VideoURL}}"
+	requestTimeout  = 30 * time.Second
+)
+
+// Episode is the data available to the message template
+type Episode struct {
+	FeedID   string
+	ID       string
+	Title    string
+	VideoURL string
+}
+
+// Webhook posts messages about new episodes to a list of webhook URLs (e.g. Discord or Slack)
+type Webhook struct {
+	urls     []string
+	template *template.Template
+	batch    bool
+	client   *http.Client
+}
+
+// NewWebhook creates a notifier sending requests via client (see network.NewClient)
+func NewWebhook(cfg *config.Notifications, client *http.Client) (*Webhook, error) {
+	text := cfg.Template
+	if text == "" {
+		text = defaultTemplate
+	}
+
+	tmpl, err := template.New("notification").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse notification template")
+	}
+
+	return &Webhook{
+		urls:     cfg.Webhooks,
+		template: tmpl,
+		batch:    cfg.Batch,
+		client:   client,
+	}, nil
+}
+
+// Batch returns true if all episodes from one update cycle should be sent in a single notification
+func (w *Webhook) Batch() bool {
+	return w.batch
+}
+
+// Notify sends a single message listing all the given episodes to each webhook.
+// Errors are logged and never returned, as notifications must not fail updates.
+func (w *Webhook) Notify(ctx context.Context, episodes ...Episode) {
+	if len(w.urls) == 0 || len(episodes) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(episodes))
+	for _, episode := range episodes {
+		var buf bytes.Buffer
+		if err := w.template.Execute(&buf, episode); err != nil {
+			log.WithError(err).Errorf("failed to render notification for episode %q", episode.ID)
+			continue
+		}
+		lines = append(lines, buf.String())
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+
+	message := strings.Join(lines, "\n")
+
+	// Discord reads "content" and Slack reads "text", so set both
+	body, err := json.Marshal(map[string]string{
+		"content": message,
+		"text":    message,
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to marshal notification")
+		return
+	}
+
+	for _, url := range w.urls {
+		if err := w.post(ctx, url, body); err != nil {
+			log.WithError(err).Warnf("failed to send notification to %s", url)
+		}
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, url string, body []byte) error {
+	// Shared client has no timeout of its own
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
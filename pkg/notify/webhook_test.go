@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/network"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	var messages []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, body["content"], body["text"])
+		messages = append(messages, body["content"])
+	}))
+	defer server.Close()
+
+	hook, err := NewWebhook(&config.Notifications{
+		Webhooks: []string{server.URL},
+		Template: "{{.FeedID}}: {{.Title}} ({{.VideoURL}})",
+	}, http.DefaultClient)
+	require.NoError(t, err)
+
+	hook.Notify(context.Background(),
+		Episode{FeedID: "A", Title: "1", VideoURL: "http://1"},
+		Episode{FeedID: "A", Title: "2", VideoURL: "http://2"},
+	)
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, "A: 1 (http://1)\nA: 2 (http://2)", messages[0])
+}
+
+func TestWebhook_NotifyError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	hook, err := NewWebhook(&config.Notifications{Webhooks: []string{server.URL}}, http.DefaultClient)
+	require.NoError(t, err)
+
+	// Must not panic or block
+	hook.Notify(context.Background(), Episode{FeedID: "A", Title: "1"})
+}
+
+func TestWebhook_InvalidTemplate(t *testing.T) {
+	_, err := NewWebhook(&config.Notifications{Template: "{{.Title"}, http.DefaultClient)
+	assert.Error(t, err)
+}
+
+func TestWebhook_NetworkClient(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+	}))
+	defer server.Close()
+
+	client, err := network.NewClient(&config.Network{UserAgent: "podsync-test"})
+	require.NoError(t, err)
+
+	hook, err := NewWebhook(&config.Notifications{Webhooks: []string{server.URL}}, client)
+	require.NoError(t, err)
+
+	hook.Notify(context.Background(), Episode{FeedID: "A", Title: "1"})
+	assert.Equal(t, "podsync-test", userAgent)
+}
@@ -0,0 +1,195 @@
+package sponsorblock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const metadataHeader = ";FFMETADATA1"
+
+// Chapter is a named part of an episode, start and end are in seconds
+type Chapter struct {
+	Start float64
+	End   float64
+	Title string
+}
+
+// ReadChapters parses chapters from ffmpeg metadata file (as produced by `ffmpeg -i input -f ffmetadata output`)
+func ReadChapters(r io.Reader) ([]Chapter, error) {
+	var (
+		chapters []Chapter
+		current  *Chapter
+		timebase = 1.0 / 1000 // ffmpeg default
+		scanner  = bufio.NewScanner(r)
+		first    = true
+	)
+
+	flush := func() {
+		if current != nil {
+			chapters = append(chapters, *current)
+			current = nil
+		}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			if line != metadataHeader {
+				return nil, errors.New("invalid ffmetadata header")
+			}
+			first = false
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			flush()
+			if line == "[CHAPTER]" {
+				current = &Chapter{}
+				timebase = 1.0 / 1000
+			}
+			continue
+		}
+
+		if current == nil {
+			// Global or stream metadata
+			continue
+		}
+
+		key, value := splitMetadata(line)
+		switch key {
+		case "TIMEBASE":
+			parts := strings.SplitN(value, "/", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("invalid chapter timebase %q", value)
+			}
+			num, err1 := strconv.ParseFloat(parts[0], 64)
+			den, err2 := strconv.ParseFloat(parts[1], 64)
+			if err1 != nil || err2 != nil || den == 0 {
+				return nil, errors.Errorf("invalid chapter timebase %q", value)
+			}
+			timebase = num / den
+		case "START", "END":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid chapter %s %q", strings.ToLower(key), value)
+			}
+			if key == "START" {
+				current.Start = float64(ts) * timebase
+			} else {
+				current.End = float64(ts) * timebase
+			}
+		case "title":
+			current.Title = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read ffmetadata")
+	}
+
+	flush()
+	return chapters, nil
+}
+
+// WriteChapters writes chapters in ffmpeg metadata format, to be passed to ffmpeg with -map_chapters
+func WriteChapters(w io.Writer, chapters []Chapter) error {
+	var b strings.Builder
+	b.WriteString(metadataHeader + "\n")
+	for _, chapter := range chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\n",
+			int64(math.Round(chapter.Start*1000)), int64(math.Round(chapter.End*1000)))
+		if chapter.Title != "" {
+			fmt.Fprintf(&b, "title=%s\n", escapeMetadata(chapter.Title))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// AdjustChapters shifts chapters to match a file where only keeps ranges are left (see Ranges).
+// Chapters which were entirely cut out are dropped.
+func AdjustChapters(chapters []Chapter, keeps [][2]float64) []Chapter {
+	var result []Chapter
+	for _, chapter := range chapters {
+		adjusted := Chapter{
+			Start: adjustTime(chapter.Start, keeps),
+			End:   adjustTime(chapter.End, keeps),
+			Title: chapter.Title,
+		}
+
+		if adjusted.End <= adjusted.Start {
+			continue
+		}
+
+		result = append(result, adjusted)
+	}
+
+	return result
+}
+
+// adjustTime maps a timestamp in the source file to the timestamp in the cut file.
+// Timestamps inside removed segments are moved to the beginning of the next kept range.
+func adjustTime(t float64, keeps [][2]float64) float64 {
+	var offset float64
+	for _, keep := range keeps {
+		start, end := keep[0], keep[1]
+		if t < start {
+			return offset
+		}
+
+		if end < 0 || t <= end {
+			return offset + t - start
+		}
+
+		offset += end - start
+	}
+
+	return offset
+}
+
+func splitMetadata(line string) (string, string) {
+	var (
+		key     strings.Builder
+		value   strings.Builder
+		current = &key
+		escaped = false
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '=' && current == &key:
+			current = &value
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	return key.String(), value.String()
+}
+
+func escapeMetadata(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		`=`, `\=`,
+		`;`, `\;`,
+		`#`, `\#`,
+		"\n", " ",
+	)
+	return replacer.Replace(s)
+}
@@ -0,0 +1,102 @@
+package sponsorblock
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChapters(t *testing.T) {
+	const metadata = `;FFMETADATA1
+title=Episode
+artist=Someone
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=60000
+title=Intro
+[CHAPTER]
+TIMEBASE=1/10
+START=600
+END=1200
+title=Part 1 \= the beginning
+[STREAM]
+title=ignored
+`
+
+	chapters, err := ReadChapters(strings.NewReader(metadata))
+	require.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Start: 0, End: 60, Title: "Intro"},
+		{Start: 60, End: 120, Title: "Part 1 = the beginning"},
+	}, chapters)
+}
+
+func TestReadChapters_InvalidHeader(t *testing.T) {
+	_, err := ReadChapters(strings.NewReader("[CHAPTER]\nSTART=0\n"))
+	assert.Error(t, err)
+}
+
+func TestWriteChapters(t *testing.T) {
+	chapters := []Chapter{
+		{Start: 0, End: 10.5, Title: "Intro; part=1"},
+		{Start: 10.5, End: 20},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteChapters(&buf, chapters))
+	assert.Equal(t, ";FFMETADATA1\n"+
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=10500\ntitle=Intro\\; part\\=1\n"+
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=10500\nEND=20000\n", buf.String())
+
+	// Round trip
+	actual, err := ReadChapters(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, chapters, actual)
+}
+
+func TestAdjustChapters(t *testing.T) {
+	// 10-20 and 50-60 are cut out
+	keeps := [][2]float64{{0, 10}, {20, 50}, {60, -1}}
+
+	tests := []struct {
+		name     string
+		chapters []Chapter
+		expect   []Chapter
+	}{
+		{
+			name:     "Before any cut",
+			chapters: []Chapter{{Start: 0, End: 5, Title: "a"}},
+			expect:   []Chapter{{Start: 0, End: 5, Title: "a"}},
+		},
+		{
+			name:     "Spanning a cut",
+			chapters: []Chapter{{Start: 5, End: 30, Title: "a"}},
+			expect:   []Chapter{{Start: 5, End: 20, Title: "a"}},
+		},
+		{
+			name:     "Starting inside a cut",
+			chapters: []Chapter{{Start: 15, End: 30, Title: "a"}},
+			expect:   []Chapter{{Start: 10, End: 20, Title: "a"}},
+		},
+		{
+			name:     "After all cuts",
+			chapters: []Chapter{{Start: 70, End: 100, Title: "a"}},
+			expect:   []Chapter{{Start: 50, End: 80, Title: "a"}},
+		},
+		{
+			name:     "Entirely cut out",
+			chapters: []Chapter{{Start: 0, End: 10, Title: "a"}, {Start: 50, End: 60, Title: "sponsor"}, {Start: 60, End: 70, Title: "b"}},
+			expect:   []Chapter{{Start: 0, End: 10, Title: "a"}, {Start: 40, End: 50, Title: "b"}},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert.Equal(t, tst.expect, AdjustChapters(tst.chapters, keeps))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package sponsorblock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// SponsorBlock action types, other types (poi, full, chapter) don't mark ranges to remove
+const (
+	actionSkip = "skip"
+	actionMute = "mute"
+)
+
+// actionTypes is the API query of action types to return
+var actionTypes = []string{actionSkip, actionMute}
+
+// Segment is a time range of a video submitted to SponsorBlock
+type Segment struct {
+	Segment    []float64 `json:"segment"`
+	UUID       string    `json:"UUID"`
+	Category   string    `json:"category"`
+	ActionType string    `json:"actionType"`
+}
+
+// Client queries segments from SponsorBlock API
+type Client struct {
+	urls   []string
+	client *http.Client
+}
+
+// NewClient creates a SponsorBlock client sending requests via httpClient. Servers are queried in order
+// until one of them responds, requests taking longer than timeout are aborted (0 - no timeout).
+func NewClient(httpClient *http.Client, apiURLs []string, timeout time.Duration) *Client {
+	// Copy to set timeout without affecting other users of the client
+	client := *httpClient
+	client.Timeout = timeout
+
+	return &Client{urls: apiURLs, client: &client}
+}
+
+// GetSegments returns the list of segments of the given categories (see Categories) submitted for the video ID.
+// Returns empty list if there are no segments available yet or no categories are requested.
+func (c *Client) GetSegments(ctx context.Context, videoID string, categories []string) ([]Segment, error) {
+	if len(c.urls) == 0 {
+		return nil, errors.New("no sponsorblock servers configured")
+	}
+
+	if len(categories) == 0 {
+		return nil, nil
+	}
+
+	query, err := json.Marshal(categories)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode sponsorblock categories")
+	}
+
+	actions, err := json.Marshal(actionTypes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode sponsorblock action types")
+	}
+
+	var lastErr error
+	for _, apiURL := range c.urls {
+		segments, err := c.getSegments(ctx, apiURL, videoID, string(query), string(actions))
+		if err == nil {
+			log.Debugf("sponsorblock segments for %q served by %s", videoID, apiURL)
+			return segments, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		log.WithError(err).Warnf("sponsorblock server %s failed", apiURL)
+		lastErr = err
+	}
+
+	return nil, errors.Wrap(lastErr, "all sponsorblock servers failed")
+}
+
+func (c *Client) getSegments(ctx context.Context, apiURL string, videoID string, categories string, actions string) ([]Segment, error) {
+	query := url.Values{}
+	query.Set("categories", categories)
+	query.Set("actionTypes", actions)
+	query.Set("videoID", videoID)
+
+	link := fmt.Sprintf("%s/api/skipSegments?%s", apiURL, query.Encode())
+	log.Debugf("querying sponsorblock %s", link)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create sponsorblock request")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve sponsor segments from sponsorblock server")
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, nil
+	case http.StatusOK:
+		// Parse below
+	default:
+		return nil, errors.Errorf("sponsorblock server returned unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading body of sponsorblock response")
+	}
+
+	log.Debugf("sponsorblock responded with json %s", data)
+
+	var segments []Segment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		return nil, errors.Wrap(err, "failed to parse sponsorblock response")
+	}
+
+	return validSegments(videoID, segments), nil
+}
+
+// validSegments drops segments without a start and end timestamp, so a single broken submission
+// doesn't fail the whole episode
+func validSegments(videoID string, segments []Segment) []Segment {
+	valid := segments[:0]
+	for _, segment := range segments {
+		if len(segment.Segment) != 2 {
+			log.Warnf("ignoring malformed sponsorblock segment %q for %q: expected 2 timestamps, got %d",
+				segment.UUID, videoID, len(segment.Segment))
+			continue
+		}
+		valid = append(valid, segment)
+	}
+
+	return valid
+}
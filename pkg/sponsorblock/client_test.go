@@ -0,0 +1,129 @@
+package sponsorblock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testCtx             = context.Background()
+	testQueryCategories = []string{"sponsor", "selfpromo"}
+)
+
+func TestClient_GetSegments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/skipSegments", r.URL.Path)
+		assert.Equal(t, `["sponsor","selfpromo"]`, r.URL.Query().Get("categories"))
+		assert.Equal(t, `["skip","mute"]`, r.URL.Query().Get("actionTypes"))
+
+		switch r.URL.Query().Get("videoID") {
+		case "found":
+			fmt.Fprint(w, `[{"segment": [1.5, 2.5], "UUID": "abc", "category": "sponsor", "actionType": "skip"}]`)
+		case "broken":
+			fmt.Fprint(w, `{`)
+		case "partial":
+			fmt.Fprint(w, `[
+				{"UUID": "missing", "category": "sponsor"},
+				{"segment": [], "UUID": "empty", "category": "sponsor"},
+				{"segment": [3], "UUID": "single", "category": "sponsor"},
+				{"segment": [1, 2, 3], "UUID": "triple", "category": "sponsor"},
+				{"segment": [1.5, 2.5], "UUID": "abc", "category": "sponsor"}
+			]`)
+		case "invalid":
+			fmt.Fprint(w, `[{"segment": ["start", "end"], "UUID": "abc", "category": "sponsor"}]`)
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(http.DefaultClient, []string{server.URL}, time.Second)
+
+	segments, err := client.GetSegments(testCtx, "found", testQueryCategories)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, Segment{Segment: []float64{1.5, 2.5}, UUID: "abc", Category: "sponsor", ActionType: "skip"}, segments[0])
+
+	segments, err = client.GetSegments(testCtx, "missing", testQueryCategories)
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+
+	_, err = client.GetSegments(testCtx, "broken", testQueryCategories)
+	assert.Error(t, err)
+
+	// Malformed segments are skipped
+	segments, err = client.GetSegments(testCtx, "partial", testQueryCategories)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, "abc", segments[0].UUID)
+
+	_, err = client.GetSegments(testCtx, "invalid", testQueryCategories)
+	assert.Error(t, err)
+
+	_, err = client.GetSegments(testCtx, "error", testQueryCategories)
+	assert.Error(t, err)
+
+	// Nothing to query
+	segments, err = client.GetSegments(testCtx, "error", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+}
+
+func TestClient_GetSegmentsTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := NewClient(http.DefaultClient, []string{server.URL}, 50*time.Millisecond)
+	_, err := client.GetSegments(testCtx, "hung", testQueryCategories)
+	assert.Error(t, err)
+
+	// Context cancellation aborts the request as well
+	client = NewClient(http.DefaultClient, []string{server.URL}, 0)
+	ctx, cancel := context.WithTimeout(testCtx, 50*time.Millisecond)
+	defer cancel()
+	_, err = client.GetSegments(ctx, "hung", testQueryCategories)
+	assert.Error(t, err)
+}
+
+func TestClient_GetSegmentsFailover(t *testing.T) {
+	var downCalls int
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downCalls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"segment": [1.5, 2.5], "UUID": "abc", "category": "sponsor"}]`)
+	}))
+	defer mirror.Close()
+
+	client := NewClient(http.DefaultClient, []string{down.URL, mirror.URL}, time.Second)
+	segments, err := client.GetSegments(testCtx, "found", testQueryCategories)
+	require.NoError(t, err)
+	assert.Len(t, segments, 1)
+	assert.Equal(t, 1, downCalls)
+
+	// All servers failing
+	client = NewClient(http.DefaultClient, []string{down.URL, down.URL}, time.Second)
+	_, err = client.GetSegments(testCtx, "found", testQueryCategories)
+	assert.Error(t, err)
+	assert.Equal(t, 3, downCalls)
+
+	client = NewClient(http.DefaultClient, nil, time.Second)
+	_, err = client.GetSegments(testCtx, "found", testQueryCategories)
+	assert.Error(t, err)
+}
@@ -0,0 +1,208 @@
+package sponsorblock
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// apiCategories maps SponsorBlock API category names to the config fields with their modes
+var apiCategories = []struct {
+	name string
+	mode func(*config.SponsorBlockCategories) string
+}{
+	{"sponsor", func(c *config.SponsorBlockCategories) string { return c.Sponsors }},
+	{"intro", func(c *config.SponsorBlockCategories) string { return c.Intermissions }},
+	{"outro", func(c *config.SponsorBlockCategories) string { return c.Endcards }},
+	{"interaction", func(c *config.SponsorBlockCategories) string { return c.InteractionReminders }},
+	{"selfpromo", func(c *config.SponsorBlockCategories) string { return c.SelfPromotions }},
+	{"music_offtopic", func(c *config.SponsorBlockCategories) string { return c.NonmusicSections }},
+	{"filler", func(c *config.SponsorBlockCategories) string { return c.Filler }},
+	{"preview", func(c *config.SponsorBlockCategories) string { return c.Preview }},
+}
+
+// categoryMode returns the configured action ("cut", "keep" or "mute") for a SponsorBlock category.
+// Categories without a config field (extra categories) are cut.
+func categoryMode(categories *config.SponsorBlockCategories, category string) string {
+	for _, c := range apiCategories {
+		if c.name == category {
+			return c.mode(categories)
+		}
+	}
+
+	return "cut"
+}
+
+// Categories returns the list of SponsorBlock API categories to query: configured categories which
+// are not kept, followed by extra categories. Segments of other categories would be ignored anyway.
+func Categories(categories *config.SponsorBlockCategories, extra []string) []string {
+	var (
+		result []string
+		seen   = map[string]bool{}
+	)
+
+	for _, c := range apiCategories {
+		seen[c.name] = true
+		if c.mode(categories) != "keep" {
+			result = append(result, c.name)
+		}
+	}
+
+	for _, name := range extra {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+// Ranges uses the list of segments to make a list of "keeps" (time ranges to keep) and
+// a list of "mutes" (time ranges to silence). The last keep range has -1 as its end, which means "till the end".
+// Segments don't have to be sorted and may overlap (as submitted by different users), keeps are sorted and disjoint.
+// cuts is the number of ranges removed after merging overlapping and adjacent segments.
+// Back-to-back cuts don't leave zero length keeps in between, as ffmpeg can't concat empty trims.
+// Only skip segments are cut, mute segments are muted and other action types are ignored.
+func Ranges(segments []Segment, categories *config.SponsorBlockCategories) (keeps [][2]float64, mutes [][2]float64, cuts int, err error) {
+	var skips [][2]float64
+	for _, segment := range segments {
+		if len(segment.Segment) != 2 {
+			return nil, nil, 0, errors.Errorf("invalid segment %q: expected 2 timestamps, got %d", segment.UUID, len(segment.Segment))
+		}
+
+		start, end := math.Max(segment.Segment[0], 0), segment.Segment[1]
+		if end <= start {
+			// Highlights (zero length) and broken submissions don't cover anything
+			continue
+		}
+
+		mode := categoryMode(categories, segment.Category)
+		switch segment.ActionType {
+		case actionSkip, "":
+			// Mirrors may omit action type, segments used to be skip only
+		case actionMute:
+			// Submitted to be muted only (e.g. a sponsor mention over the content), never cut
+			if mode != "keep" {
+				mode = "mute"
+			}
+		default:
+			// Points of interest and whole video labels don't mark a range to remove
+			continue
+		}
+
+		switch mode {
+		case "keep":
+			continue
+		case "mute":
+			mutes = append(mutes, [2]float64{start, end})
+		default:
+			skips = append(skips, [2]float64{start, end})
+		}
+	}
+
+	sort.Slice(skips, func(i, j int) bool { return skips[i][0] < skips[j][0] })
+	sort.Slice(mutes, func(i, j int) bool { return mutes[i][0] < mutes[j][0] })
+
+	// Overlapping cuts are merged, nextStart only moves forward
+	nextStart := 0.0
+	for i, skip := range skips {
+		if skip[0] > nextStart {
+			keeps = append(keeps, [2]float64{nextStart, skip[0]})
+		}
+
+		if i == 0 || skip[0] > nextStart {
+			cuts++
+		}
+
+		nextStart = math.Max(nextStart, skip[1])
+	}
+
+	keeps = append(keeps, [2]float64{nextStart, -1})
+	return keeps, mutes, cuts, nil
+}
+
+// KeptDuration returns the duration of a file of the given total duration after cutting it to keeps ranges
+func KeptDuration(keeps [][2]float64, total float64) float64 {
+	var result float64
+	for _, keep := range keeps {
+		start, end := keep[0], keep[1]
+		if end < 0 || end > total {
+			end = total
+		}
+		if end > start {
+			result += end - start
+		}
+	}
+
+	return result
+}
+
+// BuildFilterGraph returns ffmpeg's -filter_complex argument, that cuts out and mutes segments.
+// Resulting streams are labeled [outa] and [outv] (video format only).
+func BuildFilterGraph(segments []Segment, categories *config.SponsorBlockCategories, format model.Format) (string, error) {
+	keeps, mutes, _, err := Ranges(segments, categories)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		video       = format != model.FormatAudio
+		videoStream = 0
+		filter      strings.Builder
+		concat      strings.Builder
+	)
+
+	if video {
+		videoStream = 1
+	}
+
+	// Silence muted ranges before trimming, while timestamps still match the source
+	var mute string
+	if len(mutes) > 0 {
+		ranges := make([]string, 0, len(mutes))
+		for _, segment := range mutes {
+			ranges = append(ranges, fmt.Sprintf("between(t,%f,%f)", segment[0], segment[1]))
+		}
+		mute = fmt.Sprintf("volume=enable='%s':volume=0,", strings.Join(ranges, "+"))
+	}
+
+	for idx, keep := range keeps {
+		// [0:v]trim=start=0:end=30,setpts=PTS-STARTPTS[s0v];[0:a]atrim=start=0:end=30,asetpts=PTS-STARTPTS[s0a];
+		start, end := keep[0], keep[1]
+
+		fmt.Fprintf(&filter, "[0:a]%satrim=start=%f", mute, start)
+		if end >= 0 {
+			fmt.Fprintf(&filter, ":end=%f", end)
+		}
+		fmt.Fprintf(&filter, ",asetpts=PTS-STARTPTS[s%da];", idx)
+
+		if video {
+			fmt.Fprintf(&filter, "[0:v]trim=start=%f", start)
+			if end >= 0 {
+				fmt.Fprintf(&filter, ":end=%f", end)
+			}
+			fmt.Fprintf(&filter, ",setpts=PTS-STARTPTS[s%dv];", idx)
+
+			// concat expects streams of each segment grouped together: [s0v][s0a][s1v][s1a]...
+			fmt.Fprintf(&concat, "[s%dv]", idx)
+		}
+
+		fmt.Fprintf(&concat, "[s%da]", idx)
+	}
+
+	filter.WriteString(concat.String())
+	fmt.Fprintf(&filter, "concat=n=%d:v=%d:a=1", len(keeps), videoStream)
+	if video {
+		filter.WriteString("[outv]")
+	}
+	filter.WriteString("[outa]")
+
+	return filter.String(), nil
+}
@@ -0,0 +1,224 @@
+package sponsorblock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+var testCategories = config.SponsorBlockCategories{
+	Sponsors:             "cut",
+	Intermissions:        "keep",
+	Endcards:             "keep",
+	InteractionReminders: "keep",
+	SelfPromotions:       "mute",
+	NonmusicSections:     "cut",
+	Filler:               "keep",
+	Preview:              "cut",
+}
+
+func TestBuildFilterGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   model.Format
+		segments []Segment
+		expect   string
+	}{
+		{
+			name:   "Audio without segments",
+			format: model.FormatAudio,
+			expect: "[0:a]atrim=start=0.000000,asetpts=PTS-STARTPTS[s0a];[s0a]concat=n=1:v=0:a=1[outa]",
+		},
+		{
+			name:     "Audio with sponsor",
+			format:   model.FormatAudio,
+			segments: []Segment{{Segment: []float64{10, 20}, Category: "sponsor"}},
+			expect: "[0:a]atrim=start=0.000000:end=10.000000,asetpts=PTS-STARTPTS[s0a];" +
+				"[0:a]atrim=start=20.000000,asetpts=PTS-STARTPTS[s1a];" +
+				"[s0a][s1a]concat=n=2:v=0:a=1[outa]",
+		},
+		{
+			name:     "Audio with kept category",
+			format:   model.FormatAudio,
+			segments: []Segment{{Segment: []float64{5, 8}, Category: "intro"}},
+			expect:   "[0:a]atrim=start=0.000000,asetpts=PTS-STARTPTS[s0a];[s0a]concat=n=1:v=0:a=1[outa]",
+		},
+		{
+			name:     "Audio with muted category",
+			format:   model.FormatAudio,
+			segments: []Segment{{Segment: []float64{30, 40}, Category: "selfpromo"}},
+			expect: "[0:a]volume=enable='between(t,30.000000,40.000000)':volume=0,atrim=start=0.000000,asetpts=PTS-STARTPTS[s0a];" +
+				"[s0a]concat=n=1:v=0:a=1[outa]",
+		},
+		{
+			name:     "Video with sponsor",
+			format:   model.FormatVideo,
+			segments: []Segment{{Segment: []float64{10, 20}, Category: "sponsor"}},
+			expect: "[0:a]atrim=start=0.000000:end=10.000000,asetpts=PTS-STARTPTS[s0a];" +
+				"[0:v]trim=start=0.000000:end=10.000000,setpts=PTS-STARTPTS[s0v];" +
+				"[0:a]atrim=start=20.000000,asetpts=PTS-STARTPTS[s1a];" +
+				"[0:v]trim=start=20.000000,setpts=PTS-STARTPTS[s1v];" +
+				"[s0v][s0a][s1v][s1a]concat=n=2:v=1:a=1[outv][outa]",
+		},
+		{
+			name:   "Video with sponsor and music",
+			format: model.FormatVideo,
+			segments: []Segment{
+				{Segment: []float64{10, 20}, Category: "sponsor"},
+				{Segment: []float64{50, 60}, Category: "music_offtopic"},
+			},
+			expect: "[0:a]atrim=start=0.000000:end=10.000000,asetpts=PTS-STARTPTS[s0a];" +
+				"[0:v]trim=start=0.000000:end=10.000000,setpts=PTS-STARTPTS[s0v];" +
+				"[0:a]atrim=start=20.000000:end=50.000000,asetpts=PTS-STARTPTS[s1a];" +
+				"[0:v]trim=start=20.000000:end=50.000000,setpts=PTS-STARTPTS[s1v];" +
+				"[0:a]atrim=start=60.000000,asetpts=PTS-STARTPTS[s2a];" +
+				"[0:v]trim=start=60.000000,setpts=PTS-STARTPTS[s2v];" +
+				"[s0v][s0a][s1v][s1a][s2v][s2a]concat=n=3:v=1:a=1[outv][outa]",
+		},
+		{
+			name:   "Audio with overlapping unsorted segments",
+			format: model.FormatAudio,
+			segments: []Segment{
+				{Segment: []float64{50, 60}, Category: "sponsor"},
+				{Segment: []float64{10, 20}, Category: "sponsor"},
+				{Segment: []float64{15, 25}, Category: "music_offtopic"},
+			},
+			expect: "[0:a]atrim=start=0.000000:end=10.000000,asetpts=PTS-STARTPTS[s0a];" +
+				"[0:a]atrim=start=25.000000:end=50.000000,asetpts=PTS-STARTPTS[s1a];" +
+				"[0:a]atrim=start=60.000000,asetpts=PTS-STARTPTS[s2a];" +
+				"[s0a][s1a][s2a]concat=n=3:v=0:a=1[outa]",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			filter, err := BuildFilterGraph(tst.segments, &testCategories, tst.format)
+			assert.NoError(t, err)
+			assert.Equal(t, tst.expect, filter)
+		})
+	}
+}
+
+func TestRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments [][2]float64
+		keeps    [][2]float64
+		cuts     int
+	}{
+		{name: "No segments", keeps: [][2]float64{{0, -1}}},
+		{name: "Sorted", segments: [][2]float64{{10, 20}, {30, 40}}, keeps: [][2]float64{{0, 10}, {20, 30}, {40, -1}}, cuts: 2},
+		{name: "Unsorted", segments: [][2]float64{{30, 40}, {10, 20}}, keeps: [][2]float64{{0, 10}, {20, 30}, {40, -1}}, cuts: 2},
+		{name: "Overlapping", segments: [][2]float64{{10, 20}, {15, 30}}, keeps: [][2]float64{{0, 10}, {30, -1}}, cuts: 1},
+		{name: "Contained", segments: [][2]float64{{10, 40}, {15, 20}, {30, 35}}, keeps: [][2]float64{{0, 10}, {40, -1}}, cuts: 1},
+		{name: "Adjacent", segments: [][2]float64{{20, 30}, {10, 20}}, keeps: [][2]float64{{0, 10}, {30, -1}}, cuts: 1},
+		{name: "From start", segments: [][2]float64{{0, 10}, {-1, 5}}, keeps: [][2]float64{{10, -1}}, cuts: 1},
+		{name: "Back to back from start", segments: [][2]float64{{0, 10}, {10, 20}, {20, 30}}, keeps: [][2]float64{{30, -1}}, cuts: 1},
+		{name: "Zero length and reversed", segments: [][2]float64{{10, 10}, {30, 20}}, keeps: [][2]float64{{0, -1}}},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			var segments []Segment
+			for _, segment := range tst.segments {
+				segments = append(segments, Segment{Segment: []float64{segment[0], segment[1]}, Category: "sponsor"})
+			}
+
+			keeps, mutes, cuts, err := Ranges(segments, &testCategories)
+			assert.NoError(t, err)
+			assert.Empty(t, mutes)
+			assert.Equal(t, tst.keeps, keeps)
+			assert.Equal(t, tst.cuts, cuts)
+
+			// Keeps must be valid trims: sorted, disjoint and of positive length
+			for i, keep := range keeps[:len(keeps)-1] {
+				assert.Less(t, keep[0], keep[1])
+				assert.LessOrEqual(t, keep[1], keeps[i+1][0])
+			}
+		})
+	}
+}
+
+func TestRanges_Categories(t *testing.T) {
+	keeps, mutes, cuts, err := Ranges([]Segment{
+		{Segment: []float64{0, 5}, Category: "filler"},
+		{Segment: []float64{10, 20}, Category: "sponsor"},
+		// Kept segments don't affect cuts they overlap
+		{Segment: []float64{15, 35}, Category: "intro"},
+		{Segment: []float64{30, 40}, Category: "music_offtopic"},
+		{Segment: []float64{40, 50}, Category: "preview"},
+		// Extra categories are cut
+		{Segment: []float64{60, 70}, Category: "hook"},
+	}, &testCategories)
+	assert.NoError(t, err)
+	assert.Empty(t, mutes)
+	assert.Equal(t, [][2]float64{{0, 10}, {20, 30}, {50, 60}, {70, -1}}, keeps)
+	assert.Equal(t, 3, cuts)
+}
+
+func TestRanges_Mutes(t *testing.T) {
+	keeps, mutes, cuts, err := Ranges([]Segment{
+		{Segment: []float64{50, 60}, Category: "selfpromo"},
+		{Segment: []float64{10, 20}, Category: "selfpromo"},
+		{Segment: []float64{5, 5}, Category: "selfpromo"},
+	}, &testCategories)
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]float64{{0, -1}}, keeps)
+	assert.Equal(t, [][2]float64{{10, 20}, {50, 60}}, mutes)
+	assert.Equal(t, 0, cuts)
+}
+
+func TestRanges_ActionTypes(t *testing.T) {
+	keeps, mutes, cuts, err := Ranges([]Segment{
+		{Segment: []float64{10, 20}, Category: "sponsor", ActionType: "skip"},
+		{Segment: []float64{30, 40}, Category: "sponsor", ActionType: "mute"},
+		{Segment: []float64{50, 50}, Category: "poi_highlight", ActionType: "poi"},
+		{Segment: []float64{0, 100}, Category: "sponsor", ActionType: "full"},
+		{Segment: []float64{60, 70}, Category: "selfpromo", ActionType: "skip"},
+		{Segment: []float64{80, 90}, Category: "intro", ActionType: "mute"},
+		{Segment: []float64{110, 120}, Category: "sponsor"},
+	}, &testCategories)
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]float64{{0, 10}, {20, 110}, {120, -1}}, keeps)
+	assert.Equal(t, 2, cuts)
+	assert.Equal(t, [][2]float64{{30, 40}, {60, 70}}, mutes)
+}
+
+func TestBuildFilterGraph_InvalidSegment(t *testing.T) {
+	_, err := BuildFilterGraph([]Segment{{Segment: []float64{10}, Category: "sponsor"}}, &testCategories, model.FormatAudio)
+	assert.Error(t, err)
+}
+
+func TestKeptDuration(t *testing.T) {
+	assert.Equal(t, 100.0, KeptDuration([][2]float64{{0, -1}}, 100))
+	assert.Equal(t, 80.0, KeptDuration([][2]float64{{0, 10}, {20, 50}, {60, -1}}, 100))
+	// Segment past the end of the file
+	assert.Equal(t, 90.0, KeptDuration([][2]float64{{0, 90}, {110, -1}}, 100))
+}
+
+func TestCategories(t *testing.T) {
+	assert.Equal(t, []string{"sponsor", "selfpromo", "music_offtopic", "preview"}, Categories(&testCategories, nil))
+	assert.Equal(t, []string{"sponsor", "selfpromo", "music_offtopic", "preview", "hook", "chapter"},
+		Categories(&testCategories, []string{"hook", "sponsor", "chapter", "hook"}))
+
+	keepAll := config.SponsorBlockCategories{
+		Sponsors:             "keep",
+		Intermissions:        "keep",
+		Endcards:             "keep",
+		InteractionReminders: "keep",
+		SelfPromotions:       "keep",
+		NonmusicSections:     "keep",
+		Filler:               "keep",
+		Preview:              "keep",
+	}
+	assert.Empty(t, Categories(&keepAll, nil))
+	assert.Equal(t, []string{"hook"}, Categories(&keepAll, []string{"hook"}))
+
+	// Extra categories are cut
+	assert.Equal(t, "cut", categoryMode(&keepAll, "hook"))
+	assert.Equal(t, "keep", categoryMode(&keepAll, "filler"))
+	assert.Equal(t, "mute", categoryMode(&testCategories, "selfpromo"))
+}
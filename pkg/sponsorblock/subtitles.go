@@ -0,0 +1,89 @@
+package sponsorblock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const cueSeparator = " --> "
+
+// AdjustSubtitles shifts WebVTT cue timings to match a file where only keeps ranges are left (see Ranges).
+// Cues which were entirely cut out are dropped.
+func AdjustSubtitles(vtt string, keeps [][2]float64) (string, error) {
+	blocks := strings.Split(strings.ReplaceAll(vtt, "\r\n", "\n"), "\n\n")
+
+	var result []string
+	for _, block := range blocks {
+		lines := strings.Split(block, "\n")
+
+		idx := -1
+		for i, line := range lines {
+			if strings.Contains(line, cueSeparator) {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			// Header, NOTE or STYLE block
+			result = append(result, block)
+			continue
+		}
+
+		timing := strings.SplitN(lines[idx], cueSeparator, 2)
+		start, err := parseCueTime(timing[0])
+		if err != nil {
+			return "", err
+		}
+
+		// End time may be followed by cue settings
+		var (
+			rest     = strings.SplitN(timing[1], " ", 2)
+			settings string
+		)
+		end, err := parseCueTime(rest[0])
+		if err != nil {
+			return "", err
+		}
+		if len(rest) > 1 {
+			settings = " " + rest[1]
+		}
+
+		start, end = adjustTime(start, keeps), adjustTime(end, keeps)
+		if end <= start {
+			continue
+		}
+
+		lines[idx] = formatCueTime(start) + cueSeparator + formatCueTime(end) + settings
+		result = append(result, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(result, "\n\n"), nil
+}
+
+// parseCueTime parses WebVTT timestamp in either hh:mm:ss.ttt or mm:ss.ttt form
+func parseCueTime(value string) (float64, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, errors.Errorf("invalid cue timestamp %q", value)
+	}
+
+	var result float64
+	for _, part := range parts {
+		num, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid cue timestamp %q", value)
+		}
+		result = result*60 + num
+	}
+
+	return result, nil
+}
+
+func formatCueTime(t float64) string {
+	ms := int64(t*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,45 @@
+package sponsorblock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdjustSubtitles(t *testing.T) {
+	// 10-20 is cut out
+	keeps := [][2]float64{{0, 10}, {20, -1}}
+
+	const vtt = `WEBVTT
+Kind: captions
+Language: en
+
+00:00:01.000 --> 00:00:04.500 align:start position:0%
+Hello
+
+00:12.000 --> 00:15.000
+Sponsor
+
+2
+00:00:21.000 --> 00:01:05.250
+Bye`
+
+	actual, err := AdjustSubtitles(vtt, keeps)
+	require.NoError(t, err)
+	assert.Equal(t, `WEBVTT
+Kind: captions
+Language: en
+
+00:00:01.000 --> 00:00:04.500 align:start position:0%
+Hello
+
+2
+00:00:11.000 --> 00:00:55.250
+Bye`, actual)
+}
+
+func TestAdjustSubtitles_InvalidTimestamp(t *testing.T) {
+	_, err := AdjustSubtitles("WEBVTT\n\nabc --> 00:01.000\nHello", [][2]float64{{0, -1}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register decoders for image.DecodeConfig
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/feed"
+)
+
+const (
+	// Apple Podcasts requires square cover art of 1400-3000px
+	coverArtMinSize = 1400
+	coverArtMaxSize = 3000
+
+	coverArtMaxBytes = 20 * 1024 * 1024
+)
+
+// fetchCoverArt downloads the image
+func (u *Updater) fetchCoverArt(ctx context.Context, link string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download cover art")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("cover art server returned unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, coverArtMaxBytes+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cover art")
+	}
+	if len(data) > coverArtMaxBytes {
+		return nil, errors.Errorf("cover art is larger than %d bytes", coverArtMaxBytes)
+	}
+
+	return data, nil
+}
+
+// coverArtProblem describes why the image might be rejected by podcast directories, empty if it's compliant.
+// Formats other than JPEG and PNG aren't accepted either.
+func coverArtProblem(data []byte) string {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "not a JPEG or PNG image"
+	}
+
+	if cfg.Width != cfg.Height || cfg.Width < coverArtMinSize || cfg.Width > coverArtMaxSize {
+		return fmt.Sprintf("%s image is %dx%d, a square of %d-%dpx is expected", format, cfg.Width, cfg.Height, coverArtMinSize, coverArtMaxSize)
+	}
+
+	return ""
+}
+
+// resizeCoverArt scales the image to fit a compliant square, the rest is padded
+func (u *Updater) resizeCoverArt(ctx context.Context, data []byte) ([]byte, error) {
+	filter := fmt.Sprintf("scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2", coverArtMinSize)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, u.config.FFmpeg.Path, "-v", "error", "-i", "pipe:0", "-vf", filter, "-frames:v", "1", "-f", "mjpeg", "pipe:1")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to resize cover art: %s", lastLines(stderr.String(), 10))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// storeCoverArt publishes a resized copy of the custom (or provider's) cover art next to the episodes.
+// Returns the cover art URL to use in the feed, which is the source one if resizing failed.
+func (u *Updater) storeCoverArt(ctx context.Context, feedConfig *config.Feed, source string) string {
+	if feedConfig.Custom.CoverArt != "" {
+		source = feedConfig.Custom.CoverArt
+	}
+
+	if source == "" {
+		return ""
+	}
+
+	logger := log.WithField("cover_art", source)
+
+	// The image is fetched once per source
+	u.coverLock.Lock()
+	stored := u.coverArts[feedConfig.ID] == source
+	u.coverLock.Unlock()
+	if !stored {
+		if err := u.updateCoverArt(ctx, logger, feedConfig, source); err != nil {
+			logger.WithError(err).Warn("failed to resize cover art, linking it as is")
+			return source
+		}
+
+		u.coverLock.Lock()
+		u.coverArts[feedConfig.ID] = source
+		u.coverLock.Unlock()
+	}
+
+	local, err := u.fs.URL(ctx, feedConfig.ID, feed.CoverArtName)
+	if err != nil {
+		logger.WithError(err).Warn("failed to get cover art URL, linking it as is")
+		return source
+	}
+
+	return local
+}
+
+// updateCoverArt fetches the image and stores its resized copy
+func (u *Updater) updateCoverArt(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, source string) error {
+	data, err := u.fetchCoverArt(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	if problem := coverArtProblem(data); problem != "" {
+		logger.Infof("resizing cover art: %s", problem)
+	}
+
+	resized, err := u.resizeCoverArt(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.fs.Create(ctx, feedConfig.ID, feed.CoverArtName, bytes.NewReader(resized))
+	return err
+}
+
+// CheckCoverArts makes sure custom cover arts are reachable and warns about images podcast directories might reject
+func (u *Updater) CheckCoverArts(ctx context.Context) {
+	for _, feedConfig := range u.config.FeedList() {
+		link := feedConfig.Custom.CoverArt
+		if link == "" {
+			continue
+		}
+
+		logger := log.WithFields(log.Fields{"feed_id": feedConfig.ID, "cover_art": link})
+
+		data, err := u.fetchCoverArt(ctx, link)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.WithError(err).Warn("cover art is not reachable")
+			continue
+		}
+
+		if problem := coverArtProblem(data); problem != "" && !feedConfig.Custom.CoverArtResize {
+			logger.Warnf("cover art might be rejected by podcast directories (%s), consider enabling cover_art_resize", problem)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package updater
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// sameMedia returns true if both feeds produce identical files from the same video
+func sameMedia(a, b *config.Feed) bool {
+	return a.Format == b.Format &&
+		a.Quality == b.Quality &&
+		a.AudioCodec == b.AudioCodec &&
+		a.AudioBitrate == b.AudioBitrate &&
+		a.MaxHeight == b.MaxHeight &&
+		a.FormatSelector == b.FormatSelector &&
+		a.EmbedChapters == b.EmbedChapters &&
+		a.SplitByChapters == b.SplitByChapters &&
+		a.EpisodeArtwork == b.EpisodeArtwork &&
+		a.NormalizeAudio == b.NormalizeAudio &&
+		a.LoudnessTarget == b.LoudnessTarget &&
+		a.SponsorblockMode == b.SponsorblockMode &&
+		a.SponsorBlockCategories == b.SponsorBlockCategories
+}
+
+// linkDuplicate links the episode file already downloaded by another feed (matched by video ID).
+// Returns false if there is no such file or storage doesn't support links.
+func (u *Updater) linkDuplicate(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode) (bool, error) {
+	linker, ok := u.fs.(fs.Linker)
+	if !ok {
+		return false, nil
+	}
+
+	// Sorted to pick the same source on every run
+	for _, other := range u.config.FeedList() {
+		id := other.ID
+		if id == feedConfig.ID || !sameMedia(feedConfig, other) {
+			continue
+		}
+
+		source, err := u.db.GetEpisode(ctx, id, episode.ID)
+		if err != nil || source.Status != model.EpisodeDownloaded {
+			continue
+		}
+
+		size, err := linker.Link(ctx, id, feed.EpisodeName(other, source), feedConfig.ID, feed.EpisodeName(feedConfig, episode))
+		if err != nil {
+			logger.WithError(err).Warnf("failed to link episode from feed %q", id)
+			continue
+		}
+
+		enriched := linkSidecars(ctx, logger, linker, other, source, feedConfig, episode)
+
+		logger.Infof("linked episode %q from feed %q instead of downloading", episode.ID, id)
+		if err := u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(episode *model.Episode) error {
+			episode.Size = size
+			episode.ActualDuration = source.ActualDuration
+			episode.Status = model.EpisodeDownloaded
+			if enriched {
+				episode.Description = source.Description
+			}
+			return nil
+		}); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// linkSidecars links sidecar files (transcript, chapters, artwork and info JSON) of the source episode.
+// Returns true if the enriched description should be taken from the source episode.
+func linkSidecars(ctx context.Context, logger log.FieldLogger, linker fs.Linker, other *config.Feed, source *model.Episode, feedConfig *config.Feed, episode *model.Episode) bool {
+	// Sidecar files are optional, the episode is usable without them
+	if feedConfig.Transcripts && other.Transcripts {
+		if _, err := linker.Link(ctx, other.ID, feed.TranscriptName(other, source), feedConfig.ID, feed.TranscriptName(feedConfig, episode)); err != nil {
+			logger.WithError(err).Debug("transcript not linked")
+		}
+	}
+
+	if feedConfig.PublishChapters && other.PublishChapters {
+		if _, err := linker.Link(ctx, other.ID, feed.ChaptersName(other, source), feedConfig.ID, feed.ChaptersName(feedConfig, episode)); err != nil {
+			logger.WithError(err).Debug("chapters not linked")
+		}
+	}
+
+	if feedConfig.EpisodeArtwork {
+		if _, err := linker.Link(ctx, other.ID, feed.ArtworkName(other, source), feedConfig.ID, feed.ArtworkName(feedConfig, episode)); err != nil {
+			logger.WithError(err).Debug("artwork not linked")
+		}
+	}
+
+	// Enriched description is taken from the source, as there is no info JSON to read it from
+	enriched := feedConfig.EnrichMetadata && other.EnrichMetadata && feedConfig.AppendTags == other.AppendTags
+	if enriched {
+		if _, err := linker.Link(ctx, other.ID, feed.InfoName(other, source), feedConfig.ID, feed.InfoName(feedConfig, episode)); err != nil {
+			logger.WithError(err).Debug("info JSON not linked")
+		}
+	}
+
+	return enriched
+}
@@ -0,0 +1,84 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// runHook executes a hook command with episode details in its environment
+func (u *Updater) runHook(ctx context.Context, command []string, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, u.config.Hooks.Timeout.Duration)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("timed out after %s", u.config.Hooks.Timeout.Duration)
+	}
+	if err != nil && len(output) > 0 {
+		return errors.Wrap(err, lastLines(string(output), 10))
+	}
+
+	return err
+}
+
+// hookEnv returns environment variables describing the episode, file path is set only if the file is stored locally
+func (u *Updater) hookEnv(feedConfig *config.Feed, episode *model.Episode, stored bool) []string {
+	fileName := feed.EpisodeName(feedConfig, episode)
+
+	env := []string{
+		"PODSYNC_FEED_ID=" + feedConfig.ID,
+		"PODSYNC_EPISODE_ID=" + episode.ID,
+		"PODSYNC_EPISODE_TITLE=" + episode.Title,
+		"PODSYNC_VIDEO_URL=" + episode.VideoURL,
+		"PODSYNC_FILE_NAME=" + fileName,
+	}
+
+	if stored && u.config.Storage.Type == model.StorageLocal {
+		env = append(env, "PODSYNC_FILE_PATH="+filepath.Join(u.config.Server.DataDir, feedConfig.ID, fileName))
+	}
+
+	return env
+}
+
+// preDownload runs the pre_download hook, returns false if the episode shouldn't be downloaded
+func (u *Updater) preDownload(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode) (bool, error) {
+	command := u.config.Hooks.PreDownload
+	if len(command) == 0 {
+		return true, nil
+	}
+
+	if err := u.runHook(ctx, command, u.hookEnv(feedConfig, episode, false)); err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		logger.WithError(err).Info("pre_download hook failed, skipping episode until the next update")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// postDownload runs the post_download hook, failures don't affect the episode
+func (u *Updater) postDownload(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode) {
+	command := u.config.Hooks.PostDownload
+	if len(command) == 0 {
+		return
+	}
+
+	if err := u.runHook(ctx, command, u.hookEnv(feedConfig, episode, true)); err != nil {
+		logger.WithError(err).Error("post_download hook failed")
+	}
+}
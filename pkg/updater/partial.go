@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+// removePartial deletes partial downloads of the episode (see resume_downloads), they won't be continued
+func (u *Updater) removePartial(logger log.FieldLogger, feedID string, episodeID string) {
+	if !u.config.Downloader.ResumeDownloads {
+		return
+	}
+
+	if err := os.RemoveAll(ytdl.PartialPath(u.config.Downloader.PartialDir, feedID, episodeID)); err != nil {
+		logger.WithError(err).Warn("failed to remove partial download")
+	}
+}
+
+// prunePartials deletes partial downloads of episodes which won't be downloaded anymore
+// (e.g. removed from database, ignored or cleaned)
+func (u *Updater) prunePartials(ctx context.Context, feedConfig *config.Feed) error {
+	if !u.config.Downloader.ResumeDownloads {
+		return nil
+	}
+
+	dirs, err := ioutil.ReadDir(filepath.Join(u.config.Downloader.PartialDir, feedConfig.ID))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	pending := map[string]bool{}
+	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+		pending[episode.ID] = episode.Status == model.EpisodeNew || episode.Status == model.EpisodeError
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if pending[dir.Name()] {
+			continue
+		}
+
+		logger := log.WithFields(log.Fields{"feed_id": feedConfig.ID, "episode_id": dir.Name()})
+		if u.dryRun {
+			logger.Info("dry run: would remove partial download")
+			continue
+		}
+
+		logger.Info("removing partial download")
+		u.removePartial(logger, feedConfig.ID, dir.Name())
+	}
+
+	return nil
+}
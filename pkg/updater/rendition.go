@@ -0,0 +1,213 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/metrics"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+// sourceEpisodes returns episodes of the source feed from database, so renditions don't query the API.
+// Rendition feeds keep their own copies of episodes, as download status and file size differ between feeds.
+func (u *Updater) sourceEpisodes(ctx context.Context, feedConfig *config.Feed) (*model.Feed, error) {
+	source, err := u.db.GetFeed(ctx, feedConfig.SourceFeed)
+	if err == model.ErrNotFound {
+		return nil, errors.Errorf("source feed %q hasn't been updated yet", feedConfig.SourceFeed)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read source feed %q", feedConfig.SourceFeed)
+	}
+
+	result := *source
+	result.ID = feedConfig.ID
+	result.Format = feedConfig.Format
+	result.Quality = feedConfig.Quality
+	result.Episodes = nil
+
+	for _, episode := range source.Episodes {
+		// Files removed by the source feed's cleanup can't be transcoded anymore, split episodes have no file
+		if episode.Status == model.EpisodeCleaned || episode.Status == model.EpisodeSplit {
+			continue
+		}
+
+		rendition := *episode
+		rendition.Status = model.EpisodeNew
+		rendition.Size = 0
+		rendition.ActualDuration = 0
+		result.Episodes = append(result.Episodes, &rendition)
+	}
+
+	log.Debugf("received %d episode(s) from source feed %q", len(result.Episodes), feedConfig.SourceFeed)
+	return &result, nil
+}
+
+// transcodeEpisode makes a rendition of the episode file downloaded by the source feed.
+// Returns true if the episode has been transcoded, episodes not downloaded by the source feed yet are skipped.
+func (u *Updater) transcodeEpisode(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode) (bool, error) {
+	opener, ok := u.fs.(fs.Opener)
+	if !ok {
+		return false, errors.New("storage doesn't support reading files, can't transcode from source feed")
+	}
+
+	sourceConfig, ok := u.config.Feed(feedConfig.SourceFeed)
+	if !ok {
+		return false, errors.Errorf("source feed %q is not configured", feedConfig.SourceFeed)
+	}
+
+	source, err := u.db.GetEpisode(ctx, sourceConfig.ID, episode.ID)
+	if err == model.ErrNotFound || (err == nil && source.Status != model.EpisodeDownloaded) {
+		logger.Infof("episode is not downloaded by source feed %q yet, skipping", sourceConfig.ID)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	release, err := u.acquireDownloadSlot(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	tmpDir, err := ioutil.TempDir(u.config.Downloader.TempDir, "podsync-transcode-")
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get temp dir for ffmpeg")
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			logger.WithError(err).Errorf("could not remove temp dir %s", tmpDir)
+		}
+	}()
+
+	// Storage might be remote, so fetch a local copy for ffmpeg to seek in
+	sourcePath := filepath.Join(tmpDir, "source."+sourceConfig.Extension())
+	if err := u.fetchFile(ctx, opener, sourceConfig.ID, feed.EpisodeName(sourceConfig, source), sourcePath); err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		logger.WithError(err).Error("failed to read source file")
+		return false, u.markEpisodeError(feedConfig, episode.ID)
+	}
+
+	outputPath := filepath.Join(tmpDir, "output."+feedConfig.Extension())
+	args := transcodeArgs(u.config.FFmpeg.Args, feedConfig, sourcePath, outputPath)
+
+	logger.Infof("! transcoding episode from feed %q", sourceConfig.ID)
+	logger.Debugf("Calling ffmpeg with args %#v", args)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, u.config.FFmpeg.Path, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		// Don't abort the whole feed, just retry this episode during the next update
+		logger.WithError(errors.Wrap(err, lastLines(stderr.String(), 10))).Error("ffmpeg failed to transcode episode")
+		return false, u.markEpisodeError(feedConfig, episode.ID)
+	}
+
+	if feedConfig.VerifyDownloads {
+		expected := float64(source.ActualDuration)
+		if expected == 0 {
+			expected = float64(source.Duration)
+		}
+
+		if err := u.verifyDownload(ctx, outputPath, expected); err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+
+			logger.WithError(err).Error("transcoded file is broken")
+			return false, u.markEpisodeError(feedConfig, episode.ID)
+		}
+	}
+
+	fileSize, err := u.storeFile(feedConfig.ID, feed.EpisodeName(feedConfig, episode), outputPath)
+	if err != nil {
+		logger.WithError(err).Error("failed to copy file")
+		return false, err
+	}
+
+	var enriched bool
+	if linker, ok := u.fs.(fs.Linker); ok {
+		enriched = linkSidecars(ctx, logger, linker, sourceConfig, source, feedConfig, episode)
+	}
+
+	logger.Infof("successfully transcoded file %q", episode.ID)
+	metrics.EpisodeDownloaded(feedConfig.ID, providerName(feedConfig), fileSize)
+	if err := u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(episode *model.Episode) error {
+		episode.Size = fileSize
+		episode.ActualDuration = source.ActualDuration
+		episode.Status = model.EpisodeDownloaded
+		if enriched {
+			episode.Description = source.Description
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// fetchFile copies a file from storage to the local path
+func (u *Updater) fetchFile(ctx context.Context, opener fs.Opener, ns string, fileName string, path string) error {
+	reader, err := opener.Open(ctx, ns, fileName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// transcodeArgs returns ffmpeg arguments to make a rendition of the source file.
+// Audio is re-encoded with the feed's codec, video is re-encoded with H.264 and scaled down to max_height.
+func transcodeArgs(ffmpegArgs []string, feedConfig *config.Feed, input string, output string) []string {
+	args := append([]string{}, ffmpegArgs...)
+	args = append(args, "-i", input)
+
+	filter, _ := buildFilterGraph(nil, feedConfig)
+	if filter != "" {
+		args = append(args, "-filter_complex", filter, "-map", "[outa]")
+	} else {
+		args = append(args, "-map", "0:a")
+	}
+
+	if feedConfig.Format == model.FormatAudio {
+		args = append(args, "-c:a", audioEncoders[feedConfig.AudioCodec])
+		if feedConfig.AudioBitrate > 0 {
+			args = append(args, "-b:a", fmt.Sprintf("%dk", feedConfig.AudioBitrate))
+		}
+	} else {
+		args = append(args, "-map", "0:v", "-c:v", "libx264", "-c:a", "aac")
+		if feedConfig.MaxHeight > 0 {
+			args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(ih,%d)'", feedConfig.MaxHeight))
+		}
+	}
+
+	return append(args, output)
+}
@@ -0,0 +1,146 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/metrics"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/sponsorblock"
+)
+
+// partID returns the ID of the episode made of the n-th chapter (counting from 1)
+func partID(episodeID string, n int) string {
+	return fmt.Sprintf("%s-ch%d", episodeID, n)
+}
+
+// partTitle returns the title of the episode made of the n-th chapter (counting from 1)
+func partTitle(episode *model.Episode, chapter sponsorblock.Chapter, n int) string {
+	if chapter.Title == "" {
+		return fmt.Sprintf("%s (part %d)", episode.Title, n)
+	}
+
+	return fmt.Sprintf("%s - %s", episode.Title, chapter.Title)
+}
+
+// splitEpisode cuts the stored episode file into one episode per chapter and publishes them instead of the whole
+// episode. Returns false if the episode should be published as a whole: it has less than two chapters or ffmpeg failed.
+func (u *Updater) splitEpisode(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode, path string, chapters []sponsorblock.Chapter, artwork []byte) (bool, error) {
+	if len(chapters) < 2 {
+		logger.Info("no chapters to split episode by, publishing it as a whole")
+		return false, nil
+	}
+
+	tmpDir, err := ioutil.TempDir(u.config.Downloader.TempDir, "podsync-split-")
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get temp dir for ffmpeg")
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			logger.WithError(err).Errorf("could not remove temp dir %s", tmpDir)
+		}
+	}()
+
+	times := make([]string, 0, len(chapters)-1)
+	for _, chapter := range chapters[1:] {
+		times = append(times, fmt.Sprintf("%f", chapter.Start))
+	}
+
+	// Streams are copied, so parts start at the nearest keyframe
+	ext := feedConfig.Extension()
+	args := append([]string{}, u.config.FFmpeg.Args...)
+	args = append(args, ffmpegInput(path)...)
+	args = append(args, "-map", "0", "-c", "copy", "-map_chapters", "-1",
+		"-f", "segment", "-segment_times", strings.Join(times, ","), "-reset_timestamps", "1",
+		filepath.Join(tmpDir, "part-%03d."+ext))
+
+	logger.Debugf("Calling ffmpeg with args %#v", args)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, u.config.FFmpeg.Path, args...)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if err != nil {
+		logger.WithError(errors.Wrap(err, lastLines(stderr.String(), 10))).Warn("ffmpeg failed to split episode, publishing it as a whole")
+		return false, nil
+	}
+
+	// Chapters past the end of the file produce no parts, check all of them before publishing any
+	files := make([]string, len(chapters))
+	for i := range chapters {
+		files[i] = filepath.Join(tmpDir, fmt.Sprintf("part-%03d.%s", i, ext))
+		if _, err := os.Stat(files[i]); err != nil {
+			logger.WithError(err).Warn("ffmpeg didn't produce all parts, publishing episode as a whole")
+			return false, nil
+		}
+	}
+
+	var total int64
+	for i, chapter := range chapters {
+		part := &model.Episode{
+			ID:          partID(episode.ID, i+1),
+			Title:       partTitle(episode, chapter, i+1),
+			Description: episode.Description,
+			Thumbnail:   episode.Thumbnail,
+			VideoURL:    episode.VideoURL,
+			// Podcast apps sort by publication date, so keep the chapter order
+			PubDate: episode.PubDate.Add(time.Duration(i) * time.Second),
+			Order:   episode.Order,
+			Status:  model.EpisodeDownloaded,
+			Parent:  episode.ID,
+		}
+		if chapter.End > chapter.Start {
+			part.Duration = int64(math.Round(chapter.End - chapter.Start))
+		}
+
+		part.Size, err = u.storeFile(feedConfig.ID, feed.EpisodeName(feedConfig, part), files[i])
+		if err != nil {
+			logger.WithError(err).Error("failed to copy part")
+			return false, err
+		}
+
+		if len(artwork) > 0 {
+			if _, err := u.fs.Create(ctx, feedConfig.ID, feed.ArtworkName(feedConfig, part), bytes.NewReader(artwork)); err != nil {
+				logger.WithError(err).Warn("failed to store artwork")
+			}
+		}
+
+		if err := u.db.AddEpisode(feedConfig.ID, part); err != nil {
+			return false, err
+		}
+
+		total += part.Size
+	}
+
+	// The whole file was kept until now to fall back to
+	if err := u.fs.Delete(ctx, feedConfig.ID, feed.EpisodeName(feedConfig, episode)); err != nil {
+		logger.WithError(err).Warn("failed to delete split file")
+	}
+
+	logger.Infof("successfully downloaded file %q, split into %d episodes", episode.ID, len(chapters))
+	metrics.EpisodeDownloaded(feedConfig.ID, providerName(feedConfig), total)
+	if err := u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(episode *model.Episode) error {
+		episode.Status = model.EpisodeSplit
+		episode.Size = 0
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,1680 @@
+// Package updater queries feeds, downloads new episodes and publishes feed XMLs. Scheduling is left to the caller,
+// database, storage and the downloader are passed as interfaces, so custom implementations can be plugged in.
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mxpv/podsync/pkg/builder"
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/metrics"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/network"
+	"github.com/mxpv/podsync/pkg/notify"
+	"github.com/mxpv/podsync/pkg/sponsorblock"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+// backfillPageSize lifts the page size limit, builders query pages until the end of the feed
+const backfillPageSize = math.MaxInt32
+
+// notifyTimeout limits webhook notifications sent on shutdown, when the update context is already cancelled
+const notifyTimeout = 10 * time.Second
+
+// normalizedSampleRate is the sample rate of normalized audio (see normalize_audio), supported by all output codecs
+const normalizedSampleRate = 48000
+
+// Downloader fetches episode media into a temporary file, sidecar files (subtitles, info JSON, thumbnail)
+// are expected next to it. ytdl.YoutubeDl is the built-in implementation, it can hand off downloads to
+// an external downloader (see downloader.external)
+type Downloader interface {
+	Download(ctx context.Context, feedConfig *config.Feed, episode *model.Episode) (*ytdl.TempFile, error)
+	Metadata(ctx context.Context, videoURL string) (*ytdl.Metadata, error)
+}
+
+// Updater keeps feeds in storage up to date, it doesn't schedule updates on its own
+type Updater struct {
+	config       *config.Config
+	downloader   Downloader
+	db           db.Storage
+	fs           fs.Storage
+	keys         map[model.Provider]feed.KeyProvider
+	slots        chan struct{} // Limits the total number of concurrent downloads across all feeds
+	querySlots   chan struct{} // Limits the total number of concurrent SponsorBlock queries across all feeds
+	webhook      *notify.Webhook
+	sponsorblock *sponsorblock.Client
+	client       *http.Client // Shared client for outbound API requests
+	coverLock    sync.Mutex
+	coverArts    map[string]string // Source URLs of resized cover arts by feed ID
+	dryRun       bool              // Only log what would be done, without downloading or writing anything
+}
+
+// New creates an updater. With dryRun set it only logs what would be downloaded, without writing anything
+func New(config *config.Config, downloader Downloader, db db.Storage, fs fs.Storage, dryRun bool) (*Updater, error) {
+	keys := map[model.Provider]feed.KeyProvider{}
+
+	for name, list := range config.Tokens {
+		provider, err := feed.NewKeyProvider(list)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create key provider for %q", name)
+		}
+		keys[name] = provider
+	}
+
+	client, err := network.NewClient(&config.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := notify.NewWebhook(&config.Notifications, client)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots, querySlots chan struct{}
+	if max := config.Downloader.MaxConcurrentDownloads; max > 0 {
+		slots = make(chan struct{}, max)
+	}
+	if max := config.SponsorBlock.MaxConcurrentQueries; max > 0 {
+		querySlots = make(chan struct{}, max)
+	}
+
+	return &Updater{
+		config:       config,
+		downloader:   downloader,
+		db:           db,
+		fs:           fs,
+		keys:         keys,
+		slots:        slots,
+		querySlots:   querySlots,
+		webhook:      webhook,
+		sponsorblock: sponsorblock.NewClient(client, config.SponsorBlock.ApiUrls, config.SponsorBlock.Timeout.Duration),
+		client:       client,
+		coverArts:    map[string]string{},
+		dryRun:       dryRun,
+	}, nil
+}
+
+// acquireDownloadSlot blocks until a global download slot is available (if limited via
+// `max_concurrent_downloads`) and returns a func to release it.
+func (u *Updater) acquireDownloadSlot(ctx context.Context) (func(), error) {
+	return acquireSlot(ctx, u.slots)
+}
+
+// acquireQuerySlot blocks until a global SponsorBlock query slot is available (if limited via
+// `sponsorblock.max_concurrent_queries`) and returns a func to release it.
+func (u *Updater) acquireQuerySlot(ctx context.Context) (func(), error) {
+	return acquireSlot(ctx, u.querySlots)
+}
+
+func acquireSlot(ctx context.Context, slots chan struct{}) (func(), error) {
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Update queries the feed, downloads new episodes and rebuilds the feed's XML and the OPML.
+// The outcome is saved as the feed status.
+func (u *Updater) Update(ctx context.Context, feedConfig *config.Feed) error {
+	err := u.update(ctx, feedConfig)
+
+	// Interrupted updates and dry runs are not recorded
+	if ctx.Err() != nil || u.dryRun {
+		return err
+	}
+
+	if statusErr := u.db.UpdateFeedStatus(feedConfig.ID, func(status *model.FeedStatus) error {
+		if err != nil {
+			status.LastError = err.Error()
+			status.LastErrorAt = time.Now()
+			status.Failures++
+		} else {
+			status.LastSuccess = time.Now()
+			status.Failures = 0
+		}
+		return nil
+	}); statusErr != nil {
+		log.WithError(statusErr).Error("failed to save feed status")
+	}
+
+	return err
+}
+
+func (u *Updater) update(ctx context.Context, feedConfig *config.Feed) error {
+	log.WithFields(log.Fields{
+		"feed_id": feedConfig.ID,
+		"format":  feedConfig.Format,
+		"quality": feedConfig.Quality,
+	}).Infof("-> updating %s", feedConfig.URL)
+
+	started := time.Now()
+
+	feedConfig, backfill, err := u.backfillConfig(ctx, feedConfig)
+	if err != nil {
+		return errors.Wrap(err, "update failed")
+	}
+
+	result, err := u.updateFeed(ctx, feedConfig, backfill)
+	if err != nil {
+		return errors.Wrap(err, "update failed")
+	}
+
+	if u.dryRun {
+		// New episodes are not saved to database during dry run, so pass them explicitly
+		if err := u.rehearseDownloads(ctx, feedConfig, result.Episodes); err != nil {
+			return errors.Wrap(err, "download failed")
+		}
+
+		log.Info("dry run: skipping XML and OPML")
+	} else {
+		if err := u.downloadEpisodes(ctx, feedConfig); err != nil {
+			return errors.Wrap(err, "download failed")
+		}
+
+		if backfill {
+			if err := u.db.UpdateFeed(feedConfig.ID, func(feed *model.Feed) error {
+				feed.Seeded = true
+				return nil
+			}); err != nil {
+				return errors.Wrap(err, "failed to mark feed as seeded")
+			}
+			log.Info("backfill completed, switching to regular updates")
+		}
+
+		if err := u.buildXML(ctx, feedConfig); err != nil {
+			return errors.Wrap(err, "xml build failed")
+		}
+
+		if err := u.buildOPML(ctx); err != nil {
+			return errors.Wrap(err, "opml build failed")
+		}
+	}
+
+	if err := u.cleanup(ctx, feedConfig); err != nil {
+		log.WithError(err).Error("cleanup failed")
+	}
+
+	elapsed := time.Since(started)
+	metrics.UpdateCompleted(feedConfig.ID, providerName(feedConfig), elapsed)
+	log.Infof("successfully updated feed in %s", elapsed)
+	return nil
+}
+
+// backfillConfig returns the feed configuration to use for this update. Until a feed with backfill option
+// is seeded, page size is lifted, so the whole feed is fetched and downloaded. Returns true if backfilling.
+func (u *Updater) backfillConfig(ctx context.Context, feedConfig *config.Feed) (*config.Feed, bool, error) {
+	if !feedConfig.Backfill {
+		return feedConfig, false, nil
+	}
+
+	stored, err := u.db.GetFeed(ctx, feedConfig.ID)
+	if err != nil && err != model.ErrNotFound {
+		return nil, false, errors.Wrap(err, "failed to query feed")
+	}
+
+	if stored != nil && stored.Seeded {
+		return feedConfig, false, nil
+	}
+
+	log.Info("backfilling the whole feed, page_size is ignored for this update")
+
+	backfill := *feedConfig
+	backfill.PageSize = backfillPageSize
+	return &backfill, true, nil
+}
+
+// providerName returns feed's provider name to be used as metrics label
+func providerName(feedConfig *config.Feed) string {
+	info, err := builder.ParseURL(feedConfig.URL)
+	if err != nil {
+		return ""
+	}
+
+	return string(info.Provider)
+}
+
+// keepEpisode returns true for episodes that are kept in database once removed from the feed
+func keepEpisode(episode *model.Episode) bool {
+	if episode.Redownload {
+		return true
+	}
+
+	switch episode.Status {
+	case model.EpisodeDownloaded, model.EpisodeCleaned, model.EpisodeSplit, model.EpisodeIgnored, model.EpisodeTooLarge:
+		return true
+	default:
+		return false
+	}
+}
+
+// updateFeed pulls API for new episodes and saves them to database, the whole feed is queried when backfilling
+func (u *Updater) updateFeed(ctx context.Context, feedConfig *config.Feed, backfill bool) (*model.Feed, error) {
+	var latest time.Time
+	episodeSet := make(map[string]struct{})
+	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+		// Ignored episodes are kept, so they aren't queued again once listed
+		if !keepEpisode(episode) {
+			episodeSet[episode.ID] = struct{}{}
+		}
+		if episode.PubDate.After(latest) {
+			latest = episode.PubDate
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var (
+		result      *model.Feed
+		incremental bool
+		err         error
+	)
+	if feedConfig.SourceFeed != "" {
+		result, err = u.sourceEpisodes(ctx, feedConfig)
+	} else {
+		if backfill {
+			// Known episodes don't matter, older ones are queried too
+			latest = time.Time{}
+		}
+		result, incremental, err = u.queryFeed(ctx, feedConfig, latest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Feed info is overwritten by each update
+	result.Seeded = feedConfig.Backfill && !backfill
+
+	log.Debugf("received %d episode(s) for %q", len(result.Episodes), result.Title)
+
+	// Don't store episodes outside of the date window, they'll never be downloaded
+	filters := &feedConfig.Filters
+	if !filters.MinDate.IsZero() || !filters.MaxDate.IsZero() {
+		episodes := result.Episodes[:0]
+		for _, episode := range result.Episodes {
+			if u.matchDateFilter(filters.MinDate, filters.MaxDate, episode.PubDate, log.WithField("episode_id", episode.ID)) {
+				episodes = append(episodes, episode)
+			}
+		}
+		result.Episodes = episodes
+	}
+
+	if u.dryRun {
+		log.Infof("dry run: would save %d episode(s) to database", len(result.Episodes))
+	} else if err := u.db.AddFeed(ctx, feedConfig.ID, result); err != nil {
+		return nil, err
+	}
+
+	// Incremental update doesn't include the known episodes, so there is nothing to compare against
+	if incremental {
+		log.Debug("successfully saved updates to storage")
+		return result, nil
+	}
+
+	for _, episode := range result.Episodes {
+		delete(episodeSet, episode.ID)
+	}
+
+	// removing episodes that are no longer available in the feed and not downloaded or cleaned
+	for id := range episodeSet {
+		if u.dryRun {
+			log.Infof("dry run: would remove episode %q", id)
+			continue
+		}
+
+		log.Infof("removing episode %q", id)
+		err := u.db.DeleteEpisode(feedConfig.ID, id)
+		if err != nil {
+			return nil, err
+		}
+
+		u.removePartial(log.WithField("episode_id", id), feedConfig.ID, id)
+	}
+
+	log.Debug("successfully saved updates to storage")
+	return result, nil
+}
+
+// queryFeed queries API to get episodes, only the new ones (published since latest) if the feed
+// was queried before and provider supports it. Returns true if the update is incremental.
+func (u *Updater) queryFeed(ctx context.Context, feedConfig *config.Feed, latest time.Time) (*model.Feed, bool, error) {
+	info, err := builder.ParseURL(feedConfig.URL)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to parse URL: %s", feedConfig.URL)
+	}
+
+	// Providers queried via youtube-dl don't need an API key
+	var key string
+	if keyProvider, ok := u.keys[info.Provider]; ok {
+		key = keyProvider.Get()
+	} else if builder.RequiresKey(info.Provider) {
+		return nil, false, errors.Errorf("key provider %q not loaded", info.Provider)
+	}
+
+	// Create an updater for this feed type
+	provider, err := builder.New(ctx, info.Provider, key, u.client, &u.config.Downloader, &u.config.Network)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if incrementalBuilder, ok := provider.(builder.IncrementalBuilder); ok && !latest.IsZero() {
+		log.Debugf("building feed incrementally since %s", latest)
+		result, err := incrementalBuilder.BuildSince(ctx, feedConfig, latest)
+		return result, true, err
+	}
+
+	log.Debug("building feed")
+	result, err := provider.Build(ctx, feedConfig)
+	return result, false, err
+}
+
+func (u *Updater) matchRegexpFilter(pattern *regexp.Regexp, str string, negative bool, logger log.FieldLogger) bool {
+	if pattern != nil && pattern.MatchString(str) == negative {
+		logger.Infof("skipping due to regexp %q mismatch", pattern)
+		return false
+	}
+	return true
+}
+
+func (u *Updater) matchDurationFilter(min, max config.Duration, seconds int64, logger log.FieldLogger) bool {
+	duration := time.Duration(seconds) * time.Second
+
+	if min.Duration > 0 && duration < min.Duration {
+		logger.Infof("skipping due to duration %s being less than %s", duration, min)
+		return false
+	}
+
+	if max.Duration > 0 && duration > max.Duration {
+		logger.Infof("skipping due to duration %s being greater than %s", duration, max)
+		return false
+	}
+
+	return true
+}
+
+func (u *Updater) matchDateFilter(min, max config.Date, pubDate time.Time, logger log.FieldLogger) bool {
+	if !min.IsZero() && pubDate.Before(min.Time) {
+		logger.Infof("skipping due to publication date %s being before %s", pubDate, min)
+		return false
+	}
+
+	if !max.IsZero() && pubDate.After(max.Time) {
+		logger.Infof("skipping due to publication date %s being after %s", pubDate, max)
+		return false
+	}
+
+	return true
+}
+
+func (u *Updater) matchFilters(episode *model.Episode, filters *config.Filters) bool {
+	logger := log.WithFields(log.Fields{"episode_id": episode.ID})
+	if !u.matchRegexpFilter(filters.TitleRegexp, episode.Title, false, logger.WithField("filter", "title")) {
+		return false
+	}
+	if !u.matchRegexpFilter(filters.NotTitleRegexp, episode.Title, true, logger.WithField("filter", "not_title")) {
+		return false
+	}
+
+	if !u.matchRegexpFilter(filters.DescriptionRegexp, episode.Description, false, logger.WithField("filter", "description")) {
+		return false
+	}
+	if !u.matchRegexpFilter(filters.NotDescriptionRegexp, episode.Description, true, logger.WithField("filter", "not_description")) {
+		return false
+	}
+
+	if !u.matchDurationFilter(filters.MinDuration, filters.MaxDuration, episode.Duration, logger.WithField("filter", "duration")) {
+		return false
+	}
+
+	if !u.matchDateFilter(filters.MinDate, filters.MaxDate, episode.PubDate, logger.WithField("filter", "date")) {
+		return false
+	}
+
+	return true
+}
+
+// matchIDFilter checks the episode against include_ids and exclude_ids of the feed, exclude_ids takes precedence.
+// Listed episodes still have to pass other filters.
+func (u *Updater) matchIDFilter(episode *model.Episode, feedConfig *config.Feed) bool {
+	logger := log.WithFields(log.Fields{"episode_id": episode.ID})
+
+	for _, id := range feedConfig.ExcludeIDs {
+		if id == episode.ID {
+			logger.WithField("filter", "exclude_ids").Info("skipping due to episode ID being excluded")
+			return false
+		}
+	}
+
+	if len(feedConfig.IncludeIDs) == 0 {
+		return true
+	}
+
+	for _, id := range feedConfig.IncludeIDs {
+		if id == episode.ID {
+			return true
+		}
+	}
+
+	logger.WithField("filter", "include_ids").Info("skipping due to episode ID not being included")
+	return false
+}
+
+// liveEnded checks whether the live stream has ended, so its recording can be downloaded.
+// Episodes are saved to database once, so the live flag is cleared here rather than by the next listing.
+func (u *Updater) liveEnded(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode) (bool, error) {
+	metadata, err := u.downloader.Metadata(ctx, episode.VideoURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		// Cancelled streams might disappear or become private, just check again during the next update
+		logger.WithError(err).Warn("failed to query live stream status, skipping")
+		return false, nil
+	}
+
+	if metadata.Live() {
+		logger.Info("live stream hasn't ended yet, skipping")
+		return false, nil
+	}
+
+	logger.Info("live stream has ended, downloading recording")
+	if err := u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(stored *model.Episode) error {
+		stored.Live = false
+		// Streams are listed without duration
+		if metadata.Duration > 0 {
+			stored.Duration = int64(metadata.Duration)
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	episode.Live = false
+	if metadata.Duration > 0 {
+		episode.Duration = int64(metadata.Duration)
+	}
+
+	return true, nil
+}
+
+// buildDownloadList returns episodes to download in this update, pending episodes are
+// the ones not saved to database yet (during dry run)
+func (u *Updater) buildDownloadList(ctx context.Context, feedConfig *config.Feed, pending []*model.Episode) ([]*model.Episode, error) {
+	var (
+		episodes     []*model.Episode
+		candidates   []*model.Episode
+		downloadList []*model.Episode
+		pageSize     = feedConfig.PageSize
+		known        = make(map[string]struct{})
+	)
+
+	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+		known[episode.ID] = struct{}{}
+		// Parts are made of another episode (see split_by_chapters)
+		if episode.Parent == "" {
+			episodes = append(episodes, episode)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to build update list")
+	}
+
+	for _, episode := range pending {
+		if _, ok := known[episode.ID]; !ok {
+			episodes = append(episodes, episode)
+		}
+	}
+
+	// Only the newest episodes are considered, whatever their status
+	if feedConfig.PageSizeMode == model.PageSizeScanned && len(episodes) > pageSize {
+		sortEpisodes(episodes, model.DownloadOrderNewestFirst)
+		episodes = episodes[:pageSize]
+	}
+
+	var newest time.Time // Publication date of the newest downloaded episode
+	for _, episode := range episodes {
+		if episode.Status != model.EpisodeNew && episode.Status != model.EpisodeError {
+			// File already downloaded
+			if feedConfig.LatestOnly && episode.Status != model.EpisodeIgnored && episode.PubDate.After(newest) {
+				newest = episode.PubDate
+			}
+			continue
+		}
+
+		if !u.matchIDFilter(episode, feedConfig) || !u.matchFilters(episode, &feedConfig.Filters) {
+			continue
+		}
+
+		candidates = append(candidates, episode)
+	}
+
+	if feedConfig.LatestOnly {
+		return u.latestOnly(candidates, feedConfig, newest)
+	}
+
+	sortEpisodes(candidates, feedConfig.DownloadOrder)
+
+	for _, episode := range candidates {
+		// Limit the number of episodes downloaded at once
+		if len(downloadList) >= pageSize {
+			break
+		}
+
+		log.Debugf("adding %s (%q) to queue", episode.ID, episode.Title)
+		downloadList = append(downloadList, episode)
+	}
+
+	return downloadList, nil
+}
+
+// latestOnly returns the newest of candidates, if it's newer than the last downloaded episode.
+// Other candidates are marked as ignored, so they are never downloaded.
+func (u *Updater) latestOnly(candidates []*model.Episode, feedConfig *config.Feed, newest time.Time) ([]*model.Episode, error) {
+	var downloadList []*model.Episode
+
+	sortEpisodes(candidates, model.DownloadOrderNewestFirst)
+	if len(candidates) > 0 && candidates[0].PubDate.After(newest) {
+		log.Debugf("adding %s (%q) to queue", candidates[0].ID, candidates[0].Title)
+		downloadList = append(downloadList, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	for _, episode := range candidates {
+		logger := log.WithField("episode_id", episode.ID)
+		if u.dryRun {
+			logger.Infof("dry run: would ignore %q", episode.Title)
+			continue
+		}
+
+		logger.Infof("ignoring %q, only the latest episode is downloaded", episode.Title)
+		if err := u.db.UpdateEpisode(feedConfig.ID, episode.ID, func(episode *model.Episode) error {
+			episode.Status = model.EpisodeIgnored
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to ignore episode %q", episode.ID)
+		}
+	}
+
+	return downloadList, nil
+}
+
+// rehearseDownloads logs episodes that would be downloaded, without touching downloader or storage
+func (u *Updater) rehearseDownloads(ctx context.Context, feedConfig *config.Feed, pending []*model.Episode) error {
+	downloadList, err := u.buildDownloadList(ctx, feedConfig, pending)
+	if err != nil {
+		return err
+	}
+
+	if len(downloadList) == 0 {
+		log.Info("dry run: no episodes to download")
+		return nil
+	}
+
+	for _, episode := range downloadList {
+		log.WithField("episode_id", episode.ID).Infof("dry run: would download %q", episode.Title)
+	}
+
+	return nil
+}
+
+func (u *Updater) downloadEpisodes(ctx context.Context, feedConfig *config.Feed) error {
+	log.WithField("page_size", feedConfig.PageSize).Info("downloading episodes")
+
+	downloadList, err := u.buildDownloadList(ctx, feedConfig, nil)
+	if err != nil {
+		return err
+	}
+
+	var (
+		downloadCount = len(downloadList)
+		downloaded    int64
+	)
+
+	if downloadCount > 0 {
+		log.Infof("download count: %d", downloadCount)
+	} else {
+		log.Info("no episodes to download")
+		return nil
+	}
+
+	// Downloads would fail anyway, so don't mark episodes as failed and try again during the next update
+	if minFree := uint64(u.config.Downloader.MinFreeSpace); minFree > 0 && u.config.Storage.Type == model.StorageLocal {
+		free, err := fs.FreeSpace(u.config.Server.DataDir)
+		if err != nil {
+			log.WithError(err).Warn("failed to check free disk space")
+		} else if free < minFree {
+			log.Warnf("only %d bytes of disk space left (min_free_space is %d), skipping downloads", free, minFree)
+			return nil
+		}
+	}
+
+	// Episodes go through two stages, each with its own pool of workers: the checks preceding a download
+	// (including SponsorBlock queries) and the download itself. So queries of the next episodes don't wait
+	// for running downloads. Any worker may cancel the shared context to stop its siblings.
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		workers  = feedConfig.Concurrency
+		queue    = make(chan int, downloadCount)
+		jobs     = make(chan *downloadJob, downloadCount)
+		prepared sync.WaitGroup
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		result   error
+		batch    []notify.Episode
+	)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers > downloadCount {
+		workers = downloadCount
+	}
+
+	for idx := range downloadList {
+		queue <- idx
+	}
+	close(queue)
+
+	fail := func(logger log.FieldLogger, err error) {
+		// YouTube might block host with HTTP Error 429: Too Many Requests
+		// We still need to generate XML, so just stop sending download requests and
+		// retry next time
+		if err == ytdl.ErrTooManyRequests {
+			logger.Warn("server responded with a 'Too Many Requests' error")
+		} else if workerCtx.Err() == nil {
+			lock.Lock()
+			if result == nil {
+				result = err
+			}
+			lock.Unlock()
+		}
+
+		cancel()
+	}
+
+	done := func(logger log.FieldLogger, episode *model.Episode) {
+		atomic.AddInt64(&downloaded, 1)
+		u.postDownload(ctx, logger, feedConfig, episode)
+
+		message := notify.Episode{FeedID: feedConfig.ID, ID: episode.ID, Title: episode.Title, VideoURL: episode.VideoURL}
+		if u.webhook.Batch() {
+			lock.Lock()
+			batch = append(batch, message)
+			lock.Unlock()
+		} else {
+			u.notify(message)
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		prepared.Add(1)
+		go func() {
+			defer prepared.Done()
+
+			for idx := range queue {
+				if workerCtx.Err() != nil {
+					return
+				}
+
+				var (
+					episode = downloadList[idx]
+					logger  = log.WithFields(log.Fields{"index": idx, "episode_id": episode.ID})
+				)
+
+				job, linked, err := u.prepareEpisode(workerCtx, logger, feedConfig, episode)
+				if err != nil {
+					fail(logger, err)
+					return
+				}
+
+				if linked {
+					done(logger, episode)
+				} else if job != nil {
+					jobs <- job
+				}
+			}
+		}()
+	}
+
+	go func() {
+		prepared.Wait()
+		close(jobs)
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				if workerCtx.Err() != nil {
+					return
+				}
+
+				ok, err := u.downloadEpisode(workerCtx, job.logger, feedConfig, job.episode, job.segments)
+				if err != nil {
+					fail(job.logger, err)
+					return
+				}
+
+				if ok {
+					done(job.logger, job.episode)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	prepared.Wait()
+
+	log.Infof("downloaded %d episode(s)", downloaded)
+	u.notify(batch...)
+
+	if result != nil {
+		return result
+	}
+
+	return ctx.Err()
+}
+
+// sortEpisodes orders episodes by publication date according to the feed's download order
+func sortEpisodes(episodes []*model.Episode, order model.DownloadOrder) {
+	sort.SliceStable(episodes, func(i, j int) bool {
+		if order == model.DownloadOrderOldestFirst {
+			return episodes[i].PubDate.Before(episodes[j].PubDate)
+		}
+		return episodes[i].PubDate.After(episodes[j].PubDate)
+	})
+}
+
+// downloadJob is an episode which passed the checks preceding its download
+type downloadJob struct {
+	episode  *model.Episode
+	logger   log.FieldLogger
+	segments []sponsorblock.Segment // SponsorBlock segments to cut
+}
+
+// prepareEpisode runs the checks preceding a download and queries SponsorBlock segments.
+// Returns a job if the episode should be downloaded, linked is set if the episode has been
+// linked to an identical one of another feed instead.
+func (u *Updater) prepareEpisode(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode) (job *downloadJob, linked bool, err error) {
+	var (
+		feedID      = feedConfig.ID
+		episodeName = feed.EpisodeName(feedConfig, episode)
+	)
+
+	// Check whether episode already exists
+	size, err := u.fs.Size(ctx, feedID, episodeName)
+	if err == nil {
+		logger.Infof("episode %q already exists on disk", episode.ID)
+
+		// File already exists, update file status and disk size
+		if err := u.db.UpdateEpisode(feedID, episode.ID, func(episode *model.Episode) error {
+			episode.Size = size
+			episode.Status = model.EpisodeDownloaded
+			return nil
+		}); err != nil {
+			logger.WithError(err).Error("failed to update file info")
+			return nil, false, err
+		}
+
+		return nil, false, nil
+	} else if os.IsNotExist(err) {
+		// Will download, do nothing here
+	} else {
+		logger.WithError(err).Error("failed to stat file")
+		return nil, false, err
+	}
+
+	// Transcoded from the source feed's file, which has been cut already
+	if feedConfig.SourceFeed != "" {
+		return &downloadJob{episode: episode, logger: logger}, false, nil
+	}
+
+	if u.config.Storage.Dedupe {
+		linked, err := u.linkDuplicate(ctx, logger, feedConfig, episode)
+		if err != nil || linked {
+			return nil, linked, err
+		}
+	}
+
+	if episode.Live && u.config.Downloader.SkipLive {
+		ended, err := u.liveEnded(ctx, logger, feedConfig, episode)
+		if err != nil || !ended {
+			return nil, false, err
+		}
+	}
+
+	var segments []sponsorblock.Segment
+
+	// Do sponsorblock stuffs
+	timeSincePosted := time.Since(episode.PubDate)
+	delayPassed := timeSincePosted.Microseconds() > feedConfig.SponsorblockDelay.Microseconds()
+
+	logger.Debugf("SponsorblockMode is %s", feedConfig.SponsorblockMode)
+	if feedConfig.SponsorblockMode == "delay" && !delayPassed {
+		logger.Info("Sponsorblock mode is delay and configured delay has not passed yet: Skipping download of this episode and segments query for now")
+		return nil, false, nil
+	}
+
+	if feedConfig.SponsorblockMode != "off" {
+		release, err := u.acquireQuerySlot(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+
+		categories := sponsorblock.Categories(&feedConfig.SponsorBlockCategories, u.config.SponsorBlock.ExtraCategories)
+		segments, err = u.sponsorblock.GetSegments(ctx, episode.ID, categories)
+		release()
+		if err != nil {
+			logger.WithError(err).Warn("failed to retrieve sponsor segments from sponsorblock server")
+		} else if len(segments) == 0 {
+			logger.Info("No sponsor segments available yet")
+		}
+	}
+
+	if feedConfig.SponsorblockMode == "require" && len(segments) == 0 {
+		logger.Info("Sponsorblock mode is require and zero segments have been found: Skipping download of this episode for now")
+		return nil, false, nil
+	}
+	if feedConfig.SponsorblockMode == "requiredelay" && len(segments) == 0 && !delayPassed {
+		logger.Info("Sponsorblock mode is requiredelay, zero segments have been found, and configured delay has not passed yet: Skipping download of this episode for now")
+		return nil, false, nil
+	}
+
+	return &downloadJob{episode: episode, logger: logger, segments: segments}, false, nil
+}
+
+// downloadEpisode downloads a single episode, optionally cuts out SponsorBlock segments and
+// copies the result to storage. Returns true if the episode has been downloaded.
+func (u *Updater) downloadEpisode(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode, segments []sponsorblock.Segment) (bool, error) {
+	if ok, err := u.preDownload(ctx, logger, feedConfig, episode); !ok {
+		return false, err
+	}
+
+	if feedConfig.SourceFeed != "" {
+		return u.transcodeEpisode(ctx, logger, feedConfig, episode)
+	}
+
+	var (
+		feedID      = feedConfig.ID
+		episodeName = feed.EpisodeName(feedConfig, episode)
+	)
+
+	// Download episode to disk
+	// We download the episode to a temp directory first to avoid clients downloading this file
+	// while still being processed by youtube-dl (e.g. a file is being downloaded from YT or encoding in progress)
+
+	release, err := u.acquireDownloadSlot(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	logger.Infof("! downloading episode %s", episode.VideoURL)
+	tempFile, err := u.download(ctx, logger, feedConfig, episode)
+	if err != nil {
+		// YouTube might block host with HTTP Error 429: Too Many Requests
+		// We still need to generate XML, so just stop sending download requests and
+		// retry next time
+		if err == ytdl.ErrTooManyRequests {
+			return false, err
+		}
+
+		// Download was interrupted (either by shutdown or by a sibling worker), retry next time
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		// Retrying won't help, the episode is skipped until redownloaded manually
+		if err == ytdl.ErrTooLarge {
+			logger.Warnf("episode is larger than max_filesize (%d bytes), skipping", feedConfig.MaxFilesize)
+			return false, u.db.UpdateEpisode(feedID, episode.ID, func(episode *model.Episode) error {
+				episode.Status = model.EpisodeTooLarge
+				return nil
+			})
+		}
+
+		return false, u.markEpisodeError(feedConfig, episode.ID)
+	}
+
+	// Subtitles live in the download temp dir, which is removed when the temp file is closed
+	var subtitles []byte
+	if feedConfig.Transcripts {
+		if path := tempFile.Subtitles(); path != "" {
+			if subtitles, err = ioutil.ReadFile(path); err != nil {
+				logger.WithError(err).Warn("failed to read subtitles")
+			}
+		} else {
+			logger.Info("no subtitles available for episode")
+		}
+	}
+
+	var chapters []sponsorblock.Chapter
+	if feedConfig.PublishChapters || feedConfig.SplitByChapters {
+		if path := tempFile.InfoJSON(); path != "" {
+			if chapters, err = readInfoChapters(path); err != nil {
+				logger.WithError(err).Warn("failed to read chapters")
+			}
+		}
+	}
+
+	var artwork []byte
+	if feedConfig.EpisodeArtwork {
+		if path := tempFile.Thumbnail(); path == "" {
+			logger.Info("no thumbnail available for episode")
+		} else if artwork, err = u.readArtwork(ctx, path); err != nil {
+			logger.WithError(err).Warn("failed to read thumbnail")
+		}
+	}
+
+	// Raw info JSON is published, so the metadata doesn't need to be queried again
+	var (
+		info     []byte
+		metadata *ytdl.Metadata
+	)
+	if feedConfig.EnrichMetadata {
+		if path := tempFile.InfoJSON(); path == "" {
+			logger.Info("no info JSON available for episode")
+		} else if info, err = ioutil.ReadFile(path); err != nil {
+			logger.WithError(err).Warn("failed to read info JSON")
+		} else if metadata, err = ytdl.ParseMetadata(info); err != nil {
+			logger.WithError(err).Warn("failed to parse info JSON")
+			info = nil
+		}
+	}
+
+	var (
+		fileSize       int64
+		keeps          [][2]float64
+		cuts           int    // Number of ranges cut out of the file
+		storedPath     string // Local copy of the file copied to storage
+		actualDuration int64  // Duration of the cut file, 0 if the file wasn't cut
+	)
+	logger.Debugf("Segments from sponsorblock: %#v", segments)
+	if len(segments) == 0 && !feedConfig.NormalizeAudio {
+		// Temp file is kept until the stored copy is verified
+		defer tempFile.Close()
+
+		storedPath = tempFile.Fullpath()
+
+		// Served and enclosed with the feed's content type, so the file must match it
+		if ext := filepath.Ext(storedPath); ext != "" && ext != "."+feedConfig.Extension() {
+			tmpDir, err := ioutil.TempDir(u.config.Downloader.TempDir, "podsync-remux-")
+			if err != nil {
+				return false, errors.Wrap(err, "failed to get temp dir for ffmpeg")
+			}
+			defer os.RemoveAll(tmpDir)
+
+			logger.Infof("remuxing %s file to %s", ext, feedConfig.Extension())
+			remuxed, err := u.remux(ctx, storedPath, tmpDir, feedConfig.Extension())
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			if err != nil {
+				// Streams might not fit the feed's container (e.g. opus audio in mp3), retry during the next update
+				logger.WithError(err).Error("ffmpeg failed to remux episode")
+				return false, u.markEpisodeError(feedConfig, episode.ID)
+			}
+
+			storedPath = remuxed
+		}
+
+		logger.Debug("copying file")
+		var err error
+		fileSize, err = u.storeFile(feedID, episodeName, storedPath)
+		if err != nil {
+			logger.WithError(err).Error("failed to copy file")
+			return false, err
+		}
+	} else {
+		logger.Debugf("in file is %#v", tempFile)
+		// time.Sleep(time.Duration(10) * time.Minute)
+		// Time to get trimmin'
+
+		// Use the list of segments (time ranges to drop) to make a list of "keeps" (time ranges to keep)
+		if len(segments) > 0 {
+			var mutes [][2]float64
+			keeps, mutes, cuts, err = sponsorblock.Ranges(segments, &feedConfig.SponsorBlockCategories)
+			if err == nil {
+				metrics.SegmentsCut(feedID, providerName(feedConfig), cuts)
+				logger.Debugf("'Keep' segments are %#v", keeps)
+				logger.Debugf("'Mute' segments are %#v", mutes)
+			}
+		}
+
+		filter, err := buildFilterGraph(segments, feedConfig)
+		if err != nil {
+			tempFile.Close()
+			return false, errors.Wrap(err, "failed to build ffmpeg filter graph")
+		}
+
+		tmpDir, err := ioutil.TempDir(u.config.Downloader.TempDir, "podsync-ffmpeg-")
+		if err != nil {
+			tempFile.Close()
+			return false, errors.Wrap(err, "failed to get temp dir for ffmpeg")
+		}
+		// Processed file is copied to storage before returning, so it's safe to remove the directory afterwards
+		defer func() {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				logger.WithError(err).Errorf("could not remove temp dir %s", tmpDir)
+			}
+		}()
+
+		ext := feedConfig.Extension()
+
+		// Chapters are lost when cutting, so shift the source chapters and pass them as a separate input
+		var chaptersPath string
+		if feedConfig.EmbedChapters && keeps != nil {
+			chaptersPath, err = u.cutChapters(ctx, tempFile.Fullpath(), keeps, tmpDir)
+			if err != nil {
+				logger.WithError(err).Warn("failed to preserve chapters")
+			}
+		}
+
+		// The uncut file is stored first, so it's recoverable even if ffmpeg fails.
+		// Nothing is lost when segments are only muted or all kept, so there is no original to keep.
+		if feedConfig.KeepOriginal && cuts > 0 {
+			if err := u.storeOriginal(feedConfig, episode, tempFile.Fullpath()); err != nil {
+				logger.WithError(err).Warn("failed to store original file")
+			}
+		}
+
+		processedPath := filepath.Join(tmpDir, fmt.Sprintf("processed-%s.%s", episode.ID, ext))
+		args := append([]string{}, u.config.FFmpeg.Args...)
+		args = append(args, ffmpegInput(tempFile.Fullpath())...)
+		if chaptersPath != "" {
+			args = append(args, "-f", "ffmetadata", "-i", chaptersPath)
+		}
+		args = append(args, "-filter_complex", filter, "-map", "[outa]")
+		if encoder, ok := audioEncoders[feedConfig.AudioCodec]; ok && feedConfig.Format == model.FormatAudio {
+			args = append(args, "-c:a", encoder)
+			if feedConfig.AudioBitrate > 0 {
+				args = append(args, "-b:a", fmt.Sprintf("%dk", feedConfig.AudioBitrate))
+			}
+		}
+		if feedConfig.Format == model.FormatAudio && feedConfig.EpisodeArtwork && ext == "mp3" {
+			// Keep the embedded thumbnail (if any), mp3 stores it as a video stream
+			args = append(args, "-map", "0:v?", "-c:v", "copy")
+		} else if feedConfig.Format != model.FormatAudio {
+			if len(segments) > 0 {
+				args = append(args, "-map", "[outv]")
+			} else {
+				// Only audio is normalized, so don't re-encode video
+				args = append(args, "-map", "0:v", "-c:v", "copy")
+			}
+		}
+		if chaptersPath != "" {
+			args = append(args, "-map_chapters", "1")
+		}
+		args = append(args, processedPath)
+		logger.Debugf("Calling ffmpeg with args %#v", args)
+		var stderr bytes.Buffer
+		// ffmpeg is killed when the context is cancelled (e.g. on shutdown)
+		cmd := exec.CommandContext(ctx, u.config.FFmpeg.Path, args...)
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		tempFile.Close()
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if err != nil {
+			// Don't abort the whole feed, just retry this episode during the next update
+			logger.WithError(errors.Wrap(err, lastLines(stderr.String(), 10))).Error("ffmpeg failed to process episode")
+			return false, u.markEpisodeError(feedConfig, episode.ID)
+		}
+
+		logger.Debugf("copying processed file %s", processedPath)
+		fileSize, err = u.storeFile(feedID, episodeName, processedPath)
+		if err != nil {
+			logger.WithError(err).Error("failed to copy file")
+			return false, err
+		}
+
+		storedPath = processedPath
+
+		// Source duration is no longer valid after cutting, players rely on it for scrubbing
+		if len(segments) > 0 {
+			if duration, err := u.probeDuration(ctx, processedPath); err != nil {
+				logger.WithError(err).Warn("failed to get duration of cut file")
+			} else {
+				actualDuration = int64(math.Round(duration))
+			}
+		}
+	}
+
+	if feedConfig.VerifyDownloads {
+		expected := float64(episode.Duration)
+		if keeps != nil && expected > 0 {
+			expected = sponsorblock.KeptDuration(keeps, expected)
+		}
+
+		if err := u.verifyDownload(ctx, storedPath, expected); err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+
+			// Don't serve a broken file, it'll be downloaded again during the next update
+			logger.WithError(err).Error("downloaded file is broken")
+			if err := u.fs.Delete(ctx, feedID, episodeName); err != nil {
+				logger.WithError(err).Error("failed to delete broken file")
+			}
+
+			return false, u.markEpisodeError(feedConfig, episode.ID)
+		}
+	}
+
+	if feedConfig.SplitByChapters {
+		parts := chapters
+		if keeps != nil {
+			parts = sponsorblock.AdjustChapters(chapters, keeps)
+		}
+
+		split, err := u.splitEpisode(ctx, logger, feedConfig, episode, storedPath, parts, artwork)
+		if err != nil || split {
+			return split, err
+		}
+	}
+
+	if len(subtitles) > 0 {
+		// Missing transcript is not critical, the episode is still usable without it
+		if err := u.storeTranscript(ctx, feedConfig, episode, string(subtitles), keeps); err != nil {
+			logger.WithError(err).Warn("failed to store transcript")
+		}
+	}
+
+	if feedConfig.PublishChapters && len(chapters) > 0 {
+		if err := u.storeChapters(ctx, feedConfig, episode, chapters, keeps); err != nil {
+			logger.WithError(err).Warn("failed to store chapters")
+		}
+	}
+
+	if len(artwork) > 0 {
+		if _, err := u.fs.Create(ctx, feedID, feed.ArtworkName(feedConfig, episode), bytes.NewReader(artwork)); err != nil {
+			logger.WithError(err).Warn("failed to store artwork")
+		}
+	}
+
+	if len(info) > 0 {
+		if _, err := u.fs.Create(ctx, feedID, feed.InfoName(feedConfig, episode), bytes.NewReader(info)); err != nil {
+			logger.WithError(err).Warn("failed to store info JSON")
+		}
+	}
+
+	// Update file status in database
+
+	logger.Infof("successfully downloaded file %q", episode.ID)
+	metrics.EpisodeDownloaded(feedID, providerName(feedConfig), fileSize)
+	if err := u.db.UpdateEpisode(feedID, episode.ID, func(episode *model.Episode) error {
+		episode.Size = fileSize
+		episode.ActualDuration = actualDuration
+		episode.Status = model.EpisodeDownloaded
+		if metadata != nil {
+			episode.Description = enrichDescription(episode.Description, metadata, feedConfig.AppendTags)
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// enrichDescription returns the full description from video metadata, optionally followed by its tags.
+// The builder's description is kept if metadata has none.
+func enrichDescription(description string, metadata *ytdl.Metadata, appendTags bool) string {
+	if metadata.Description != "" {
+		description = metadata.Description
+	}
+
+	if appendTags && len(metadata.Tags) > 0 {
+		description = strings.TrimSpace(fmt.Sprintf("%s\n\nTags: %s", description, strings.Join(metadata.Tags, ", ")))
+	}
+
+	return description
+}
+
+// ffmpegDemuxers are names of ffmpeg input formats by file extension
+var ffmpegDemuxers = map[string]string{
+	"mp3":  "mp3",
+	"mp4":  "mp4",
+	"m4a":  "mp4",
+	"opus": "ogg",
+	"mkv":  "matroska",
+	"webm": "matroska",
+}
+
+// ffmpegInput returns ffmpeg arguments to read the file. The demuxer is picked by the actual extension of the file,
+// which might differ from the feed's one. ffmpeg probes files with unknown extensions.
+func ffmpegInput(path string) []string {
+	if demuxer, ok := ffmpegDemuxers[strings.TrimPrefix(filepath.Ext(path), ".")]; ok {
+		return []string{"-f", demuxer, "-i", path}
+	}
+
+	return []string{"-i", path}
+}
+
+// remux copies streams of the file into a container with the given extension, as post-processors might leave
+// the download in another one (see ytdl.findDownloadedFile). Returns the path of the remuxed file in tmpDir.
+func (u *Updater) remux(ctx context.Context, path string, tmpDir string, ext string) (string, error) {
+	output := filepath.Join(tmpDir, "remuxed."+ext)
+
+	args := append([]string{}, u.config.FFmpeg.Args...)
+	args = append(args, ffmpegInput(path)...)
+	args = append(args, "-map", "0", "-c", "copy", output)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, u.config.FFmpeg.Path, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, lastLines(stderr.String(), 10))
+	}
+
+	return output, nil
+}
+
+// audioEncoders are ffmpeg encoders of audio codecs
+var audioEncoders = map[model.AudioCodec]string{
+	model.AudioCodecMP3:  "libmp3lame",
+	model.AudioCodecAAC:  "aac",
+	model.AudioCodecOpus: "libopus",
+}
+
+// buildFilterGraph returns ffmpeg's -filter_complex argument, that cuts out SponsorBlock segments
+// and normalizes loudness in a single pass, so the episode is encoded only once.
+// Resulting audio is labeled [outa], video is labeled [outv] only if segments are cut.
+func buildFilterGraph(segments []sponsorblock.Segment, feedConfig *config.Feed) (string, error) {
+	var filter string
+	if len(segments) > 0 {
+		var err error
+		filter, err = sponsorblock.BuildFilterGraph(segments, &feedConfig.SponsorBlockCategories, feedConfig.Format)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !feedConfig.NormalizeAudio {
+		return filter, nil
+	}
+
+	// loudnorm upsamples to 192 kHz internally, resample back or encoders pick the highest rate they support
+	loudnorm := fmt.Sprintf("loudnorm=I=%d:TP=-1.5:LRA=11,aresample=%d", feedConfig.LoudnessTarget, normalizedSampleRate)
+	if filter == "" {
+		return fmt.Sprintf("[0:a]%s[outa]", loudnorm), nil
+	}
+
+	// Normalize the cut audio
+	return fmt.Sprintf("%s[cuta];[cuta]%s[outa]", strings.TrimSuffix(filter, "[outa]"), loudnorm), nil
+}
+
+// storeFile copies a local file to storage and returns its size. The copy is finished even on shutdown,
+// as episode status is updated only after a complete copy.
+func (u *Updater) storeFile(feedID, name, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return u.fs.Create(context.Background(), feedID, name, f)
+}
+
+// storeOriginal saves the downloaded file before cutting next to the episode
+func (u *Updater) storeOriginal(feedConfig *config.Feed, episode *model.Episode, path string) error {
+	_, err := u.storeFile(feedConfig.ID, feed.OriginalName(feedConfig, episode), path)
+	return err
+}
+
+// storeTranscript saves episode subtitles next to the media file, shifting cue timings if segments were cut out
+func (u *Updater) storeTranscript(ctx context.Context, feedConfig *config.Feed, episode *model.Episode, subtitles string, keeps [][2]float64) error {
+	if keeps != nil {
+		adjusted, err := sponsorblock.AdjustSubtitles(subtitles, keeps)
+		if err != nil {
+			return err
+		}
+		subtitles = adjusted
+	}
+
+	_, err := u.fs.Create(ctx, feedConfig.ID, feed.TranscriptName(feedConfig, episode), strings.NewReader(subtitles))
+	return err
+}
+
+// storeChapters publishes episode chapters JSON next to the media file, shifting chapters if segments were cut out
+func (u *Updater) storeChapters(ctx context.Context, feedConfig *config.Feed, episode *model.Episode, chapters []sponsorblock.Chapter, keeps [][2]float64) error {
+	if keeps != nil {
+		chapters = sponsorblock.AdjustChapters(chapters, keeps)
+	}
+
+	var buf bytes.Buffer
+	if err := feed.EncodeChapters(&buf, chapters); err != nil {
+		return err
+	}
+
+	_, err := u.fs.Create(ctx, feedConfig.ID, feed.ChaptersName(feedConfig, episode), &buf)
+	return err
+}
+
+// readArtwork returns the thumbnail as JPEG, other formats (e.g. WebP) aren't supported by podcast apps
+func (u *Updater) readArtwork(ctx context.Context, path string) ([]byte, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".jpg" {
+		return ioutil.ReadFile(path)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, u.config.FFmpeg.Path, "-v", "error", "-i", path, "-frames:v", "1", "-f", "mjpeg", "pipe:1")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to convert thumbnail: %s", lastLines(stderr.String(), 10))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func readInfoChapters(path string) ([]sponsorblock.Chapter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return feed.ReadInfoChapters(f)
+}
+
+// cutChapters reads chapters from the source file, adjusts them to the keeps ranges and
+// writes them to an ffmetadata file in dir. Returns an empty path if the source has no chapters.
+func (u *Updater) cutChapters(ctx context.Context, source string, keeps [][2]float64, dir string) (string, error) {
+	sourcePath := filepath.Join(dir, "source.ffmetadata")
+	args := append([]string{}, u.config.FFmpeg.Args...)
+	args = append(args, ffmpegInput(source)...)
+	args = append(args, "-f", "ffmetadata", sourcePath)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, u.config.FFmpeg.Path, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, lastLines(stderr.String(), 10))
+	}
+
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open source metadata")
+	}
+	defer file.Close()
+
+	chapters, err := sponsorblock.ReadChapters(file)
+	if err != nil {
+		return "", err
+	}
+
+	chapters = sponsorblock.AdjustChapters(chapters, keeps)
+	if len(chapters) == 0 {
+		return "", nil
+	}
+
+	chaptersPath := filepath.Join(dir, "chapters.ffmetadata")
+	out, err := os.Create(chaptersPath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create chapters file")
+	}
+	defer out.Close()
+
+	if err := sponsorblock.WriteChapters(out, chapters); err != nil {
+		return "", errors.Wrap(err, "failed to write chapters file")
+	}
+
+	return chaptersPath, nil
+}
+
+// notify announces downloaded episodes. Episodes are stored by now, so they're announced even on shutdown.
+func (u *Updater) notify(episodes ...notify.Episode) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	u.webhook.Notify(ctx, episodes...)
+}
+
+// markEpisodeError sets episode status to error, so the download will be retried during the next update
+func (u *Updater) markEpisodeError(feedConfig *config.Feed, episodeID string) error {
+	metrics.DownloadFailed(feedConfig.ID, providerName(feedConfig))
+	return u.db.UpdateEpisode(feedConfig.ID, episodeID, func(episode *model.Episode) error {
+		episode.Status = model.EpisodeError
+		return nil
+	})
+}
+
+// lastLines returns up to n last lines of the output (e.g. to include the reason of ffmpeg failure into logs)
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// download invokes the downloader and retries transient failures with exponential backoff
+func (u *Updater) download(ctx context.Context, logger log.FieldLogger, feedConfig *config.Feed, episode *model.Episode) (*ytdl.TempFile, error) {
+	var (
+		retries = u.config.Downloader.DownloadRetries
+		backoff = u.config.Downloader.RetryBackoff.Duration
+	)
+
+	for attempt := 1; ; attempt++ {
+		tempFile, err := u.downloader.Download(ctx, feedConfig, episode)
+		if err == nil || err == ytdl.ErrTooManyRequests || err == ytdl.ErrTooLarge || attempt > retries || ctx.Err() != nil {
+			return tempFile, err
+		}
+
+		delay := backoff * time.Duration(1<<uint(attempt-1))
+		logger.WithError(err).Warnf("download attempt %d of %d failed, retrying in %s", attempt, retries+1, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (u *Updater) buildXML(ctx context.Context, feedConfig *config.Feed) error {
+	f, err := u.db.GetFeed(ctx, feedConfig.ID)
+	if err != nil {
+		return err
+	}
+
+	if feedConfig.Custom.CoverArtResize {
+		f.CoverArt = u.storeCoverArt(ctx, feedConfig, f.CoverArt)
+	}
+
+	// Build iTunes XML feed with data received from builder
+	log.Debug("building iTunes podcast feed")
+	podcast, err := feed.Build(ctx, f, feedConfig, u.fs)
+	if err != nil {
+		return err
+	}
+
+	var (
+		reader  = bytes.NewReader([]byte(podcast.String()))
+		xmlName = fmt.Sprintf("%s.xml", feedConfig.ID)
+	)
+
+	if _, err := u.fs.Create(ctx, "", xmlName, reader); err != nil {
+		return errors.Wrap(err, "failed to upload new XML feed")
+	}
+
+	return nil
+}
+
+func (u *Updater) buildOPML(ctx context.Context) error {
+	// Build OPML with data received from builder
+	log.Debug("building podcast OPML")
+	opml, err := feed.BuildOPML(ctx, u.config, u.db, u.fs)
+	if err != nil {
+		return err
+	}
+
+	var (
+		reader  = bytes.NewReader([]byte(opml))
+		xmlName = fmt.Sprintf("%s.opml", "podsync")
+	)
+
+	if _, err := u.fs.Create(ctx, "", xmlName, reader); err != nil {
+		return errors.Wrap(err, "failed to upload OPML")
+	}
+
+	return nil
+}
+
+func (u *Updater) cleanup(ctx context.Context, feedConfig *config.Feed) error {
+	var (
+		feedID  = feedConfig.ID
+		logger  = log.WithField("feed_id", feedID)
+		count   = feedConfig.Clean.KeepLast
+		maxSize = int64(feedConfig.Clean.MaxSize)
+		maxAge  = feedConfig.Clean.MaxAge.Duration
+		list    []*model.Episode
+		result  *multierror.Error
+	)
+
+	if err := u.prunePartials(ctx, feedConfig); err != nil {
+		logger.WithError(err).Warn("failed to prune partial downloads")
+	}
+
+	if count < 1 && maxSize < 1 && maxAge <= 0 {
+		logger.Info("nothing to clean")
+		return nil
+	}
+
+	logger.WithFields(log.Fields{"count": count, "max_size": maxSize, "max_age": maxAge}).Info("running cleaner")
+	if err := u.db.WalkEpisodes(ctx, feedConfig.ID, func(episode *model.Episode) error {
+		if episode.Status == model.EpisodeDownloaded {
+			list = append(list, episode)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].PubDate.After(list[j].PubDate)
+	})
+
+	keep := len(list)
+	if count > 0 && count < keep {
+		keep = count
+	}
+
+	// Keep episodes within the retention window
+	if maxAge > 0 {
+		since := time.Now().Add(-maxAge)
+		for i, episode := range list[:keep] {
+			if episode.PubDate.Before(since) {
+				keep = i
+				break
+			}
+		}
+	}
+
+	// Keep the newest episodes that fit into the size budget
+	if maxSize > 0 {
+		var total int64
+		for i, episode := range list[:keep] {
+			total += episode.Size
+			if total > maxSize {
+				keep = i
+				break
+			}
+		}
+	}
+
+	for _, episode := range list[keep:] {
+		if u.dryRun {
+			logger.WithField("episode_id", episode.ID).Infof("dry run: would delete %q", episode.Title)
+			continue
+		}
+
+		logger.WithField("episode_id", episode.ID).Infof("deleting %q", episode.Title)
+
+		if err := u.fs.Delete(ctx, feedConfig.ID, feed.EpisodeName(feedConfig, episode)); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to delete episode: %s", episode.ID))
+			continue
+		}
+
+		if feedConfig.Transcripts {
+			if err := u.fs.Delete(ctx, feedConfig.ID, feed.TranscriptName(feedConfig, episode)); err != nil && !os.IsNotExist(err) {
+				logger.WithError(err).Warnf("failed to delete transcript of %q", episode.ID)
+			}
+		}
+
+		if feedConfig.PublishChapters {
+			if err := u.fs.Delete(ctx, feedConfig.ID, feed.ChaptersName(feedConfig, episode)); err != nil && !os.IsNotExist(err) {
+				logger.WithError(err).Warnf("failed to delete chapters of %q", episode.ID)
+			}
+		}
+
+		if feedConfig.EpisodeArtwork {
+			if err := u.fs.Delete(ctx, feedConfig.ID, feed.ArtworkName(feedConfig, episode)); err != nil && !os.IsNotExist(err) {
+				logger.WithError(err).Warnf("failed to delete artwork of %q", episode.ID)
+			}
+		}
+
+		if feedConfig.EnrichMetadata {
+			if err := u.fs.Delete(ctx, feedConfig.ID, feed.InfoName(feedConfig, episode)); err != nil && !os.IsNotExist(err) {
+				logger.WithError(err).Warnf("failed to delete info JSON of %q", episode.ID)
+			}
+		}
+
+		// Not every episode has segments to cut
+		if feedConfig.KeepOriginal {
+			if err := u.fs.Delete(ctx, feedConfig.ID, feed.OriginalName(feedConfig, episode)); err != nil && !os.IsNotExist(err) {
+				logger.WithError(err).Warnf("failed to delete original file of %q", episode.ID)
+			}
+		}
+
+		if err := u.db.UpdateEpisode(feedID, episode.ID, func(episode *model.Episode) error {
+			episode.Status = model.EpisodeCleaned
+			episode.Title = ""
+			episode.Description = ""
+			return nil
+		}); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to set state for cleaned episode: %s", episode.ID))
+			continue
+		}
+	}
+
+	return result.ErrorOrNil()
+}
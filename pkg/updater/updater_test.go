@@ -0,0 +1,2124 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/db"
+	"github.com/mxpv/podsync/pkg/feed"
+	"github.com/mxpv/podsync/pkg/fs"
+	"github.com/mxpv/podsync/pkg/metrics"
+	"github.com/mxpv/podsync/pkg/model"
+	"github.com/mxpv/podsync/pkg/notify"
+	"github.com/mxpv/podsync/pkg/sponsorblock"
+	"github.com/mxpv/podsync/pkg/ytdl"
+)
+
+var testCtx = context.Background()
+
+type fakeMetadata struct {
+	metadata *ytdl.Metadata
+	err      error
+	calls    int
+}
+
+func (f *fakeMetadata) Metadata(_ context.Context, _ string) (*ytdl.Metadata, error) {
+	f.calls++
+	return f.metadata, f.err
+}
+
+// fakeDownloader writes a dummy media file instead of invoking youtube-dl
+type fakeDownloader struct {
+	fakeMetadata
+	lock      sync.Mutex
+	dir       string
+	calls     int
+	subtitles string
+	info      string
+	thumbnail string
+	ext       string        // Extension of downloaded files, none by default
+	delay     time.Duration // Duration of each download, downloads may overlap while waiting
+	running   int32
+	peak      int32 // Maximum number of overlapping downloads
+	failures  int   // Number of calls failing with a transient error before downloads succeed
+	err       error
+}
+
+func (d *fakeDownloader) Download(_ context.Context, _ *config.Feed, episode *model.Episode) (*ytdl.TempFile, error) {
+	if d.delay > 0 {
+		n := atomic.AddInt32(&d.running, 1)
+		for {
+			peak := atomic.LoadInt32(&d.peak)
+			if n <= peak || atomic.CompareAndSwapInt32(&d.peak, peak, n) {
+				break
+			}
+		}
+
+		time.Sleep(d.delay)
+		atomic.AddInt32(&d.running, -1)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.calls++
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.calls <= d.failures {
+		return nil, errors.New("connection reset by peer")
+	}
+
+	path := filepath.Join(d.dir, fmt.Sprintf("%s-%d", episode.ID, d.calls))
+	if d.ext != "" {
+		path += "." + d.ext
+	}
+	if err := ioutil.WriteFile(path, []byte("media"), 0644); err != nil {
+		return nil, err
+	}
+
+	if d.subtitles != "" {
+		if err := ioutil.WriteFile(path+".en.vtt", []byte(d.subtitles), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.info != "" {
+		if err := ioutil.WriteFile(path+".info.json", []byte(d.info), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.thumbnail != "" {
+		if err := ioutil.WriteFile(path+".jpg", []byte(d.thumbnail), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ytdl.TempFile{File: f}, nil
+}
+
+type testEnv struct {
+	updater    *Updater
+	downloader *fakeDownloader
+	db         *db.Badger
+	fs         *fs.Local
+	tmpDir     string
+}
+
+// setupUpdater creates an updater backed by real storage in a temporary directory,
+// a fake downloader and a fake SponsorBlock server responding with the given segments.
+func setupUpdater(t *testing.T, segments string) (*testEnv, func()) {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "podsync-updater-")
+	require.NoError(t, err)
+
+	dirs := map[string]string{}
+	for _, name := range []string{"db", "data", "download", "tmp"} {
+		dirs[name] = filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(dirs[name], 0755))
+	}
+
+	// Redirect system temp dir, so we can check for leftovers
+	oldTmp := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", dirs["tmp"])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if segments == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, segments)
+	}))
+
+	database, err := db.NewBadger(&config.Database{Dir: dirs["db"]})
+	require.NoError(t, err)
+
+	storage, err := fs.NewLocal(dirs["data"], "localhost")
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Server:       config.Server{DataDir: dirs["data"]},
+		Storage:      config.Storage{Type: model.StorageLocal},
+		SponsorBlock: config.SponsorBlock{ApiUrls: config.StringSlice{server.URL}},
+		FFmpeg:       config.FFmpeg{Path: fakeFFmpeg(t, root)},
+	}
+
+	downloader := &fakeDownloader{dir: dirs["download"]}
+
+	updater, err := New(cfg, downloader, database, storage, false)
+	require.NoError(t, err)
+
+	env := &testEnv{
+		updater:    updater,
+		downloader: downloader,
+		db:         database,
+		fs:         storage,
+		tmpDir:     dirs["tmp"],
+	}
+
+	return env, func() {
+		database.Close()
+		server.Close()
+		os.Setenv("TMPDIR", oldTmp)
+		os.RemoveAll(root)
+	}
+}
+
+// fakeFFmpeg creates a script that mimics ffmpeg by writing a file to the output path (the last argument)
+func fakeFFmpeg(t *testing.T, dir string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "ffmpeg")
+	script := "#!/bin/sh\nfor last; do :; done\necho processed > \"$last\"\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	return path
+}
+
+func testFeed(id string) *config.Feed {
+	return &config.Feed{
+		ID:               id,
+		URL:              "https://youtube.com/channel/test",
+		Format:           model.FormatAudio,
+		PageSize:         10,
+		Concurrency:      1,
+		SponsorblockMode: "require",
+		SponsorBlockCategories: config.SponsorBlockCategories{
+			Sponsors:             "cut",
+			Intermissions:        "keep",
+			Endcards:             "keep",
+			InteractionReminders: "keep",
+			SelfPromotions:       "keep",
+			NonmusicSections:     "cut",
+			Filler:               "keep",
+			Preview:              "keep",
+		},
+	}
+}
+
+func addEpisode(t *testing.T, env *testEnv, feedID string, episode *model.Episode) {
+	t.Helper()
+
+	err := env.db.AddFeed(testCtx, feedID, &model.Feed{ID: feedID, Episodes: []*model.Episode{episode}})
+	require.NoError(t, err)
+}
+
+func TestUpdater_CutRemovesTempDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	feedConfig := testFeed("1")
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+	leftovers, err := filepath.Glob(filepath.Join(env.tmpDir, "podsync-ffmpeg-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestUpdater_TempDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	// Record the output path of ffmpeg
+	scratch := filepath.Join(env.tmpDir, "..", "scratch")
+	require.NoError(t, os.MkdirAll(scratch, 0755))
+	outputs := filepath.Join(env.tmpDir, "..", "outputs")
+	script := "#!/bin/sh\nfor last; do :; done\necho \"$last\" >> " + outputs + "\necho processed > \"$last\"\n"
+	require.NoError(t, ioutil.WriteFile(env.updater.config.FFmpeg.Path, []byte(script), 0755))
+	env.updater.config.Downloader.TempDir = scratch
+
+	feedConfig := testFeed("1")
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	data, err := ioutil.ReadFile(outputs)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), filepath.Join(scratch, "podsync-ffmpeg-")), string(data))
+
+	// Nothing is left behind in either of temp dirs
+	leftovers, err := filepath.Glob(filepath.Join(scratch, "*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+	leftovers, err = filepath.Glob(filepath.Join(env.tmpDir, "podsync-ffmpeg-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestUpdater_KeepOriginal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	feedConfig := testFeed("1")
+	feedConfig.KeepOriginal = true
+	feedConfig.Clean = config.Cleanup{KeepLast: 1}
+
+	now := time.Now()
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: now})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "b", Status: model.EpisodeNew, PubDate: now.Add(-time.Hour)})
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	dataDir := filepath.Join(env.tmpDir, "..", "data", feedConfig.ID)
+	for _, id := range []string{"a", "b"} {
+		data, err := ioutil.ReadFile(filepath.Join(dataDir, id+".mp3"))
+		require.NoError(t, err)
+		assert.Equal(t, "processed\n", string(data))
+
+		data, err = ioutil.ReadFile(filepath.Join(dataDir, id+".original.mp3"))
+		require.NoError(t, err)
+		assert.Equal(t, "media", string(data))
+	}
+
+	// Originals are pruned along with episodes
+	require.NoError(t, env.updater.cleanup(testCtx, feedConfig))
+	_, err := os.Stat(filepath.Join(dataDir, "a.original.mp3"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dataDir, "b.original.mp3"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUpdater_KeepOriginalNotCut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	tests := []struct {
+		name     string
+		segments string
+	}{
+		{name: "Muted", segments: `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor", "actionType": "mute"}]`},
+		{name: "Kept", segments: `[{"segment": [10.0, 20.0], "UUID": "1", "category": "intro"}]`},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			env, teardown := setupUpdater(t, tst.segments)
+			defer teardown()
+
+			feedConfig := testFeed("1")
+			feedConfig.KeepOriginal = true
+			addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+			require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+			dataDir := filepath.Join(env.tmpDir, "..", "data", feedConfig.ID)
+			assert.FileExists(t, filepath.Join(dataDir, "a.mp3"))
+			_, err := os.Stat(filepath.Join(dataDir, "a.original.mp3"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestUpdater_FFmpegFailureMarksEpisodeError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	failing := filepath.Join(env.tmpDir, "ffmpeg-fail")
+	require.NoError(t, ioutil.WriteFile(failing, []byte("#!/bin/sh\necho 'Invalid data found' >&2\nexit 1\n"), 0755))
+	env.updater.config.FFmpeg.Path = failing
+
+	feedConfig := testFeed("1")
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "b", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	// Must not abort the feed update
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, env.downloader.calls)
+
+	for _, id := range []string{"a", "b"} {
+		episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, id)
+		require.NoError(t, err)
+		assert.Equal(t, model.EpisodeError, episode.Status)
+	}
+}
+
+func TestUpdater_Redownload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	// The channel lists only the newest episode
+	listing := filepath.Join(env.tmpDir, "yt-dlp")
+	require.NoError(t, ioutil.WriteFile(listing, []byte("#!/bin/sh\n"+
+		"echo '{\"title\": \"Channel\", \"entries\": [{\"id\": \"new\", \"title\": \"New\", \"timestamp\": 1600000000}]}'\n"), 0755))
+	env.updater.config.Downloader.Path = listing
+
+	feedConfig := testFeed("1")
+	feedConfig.URL = "https://www.bitchute.com/channel/name/"
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "old", Title: "Old", Status: model.EpisodeCleaned, PubDate: time.Unix(1500000000, 0)})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "gone", Title: "Gone", Status: model.EpisodeError, PubDate: time.Unix(1500000000, 0)})
+
+	env.updater.config.Downloader.ResumeDownloads = true
+	env.updater.config.Downloader.PartialDir = filepath.Join(env.tmpDir, "..", "partial")
+	gonePartial := ytdl.PartialPath(env.updater.config.Downloader.PartialDir, feedConfig.ID, "gone")
+	require.NoError(t, os.MkdirAll(gonePartial, 0755))
+
+	// As reset by the redownload command
+	require.NoError(t, env.db.UpdateEpisode(feedConfig.ID, "old", func(episode *model.Episode) error {
+		episode.Status = model.EpisodeNew
+		episode.Redownload = true
+		return nil
+	}))
+
+	_, err := env.updater.updateFeed(testCtx, feedConfig, false)
+	require.NoError(t, err)
+
+	// Episodes no longer listed are removed along with partial downloads, unless requested to be downloaded again
+	_, err = env.db.GetEpisode(testCtx, feedConfig.ID, "gone")
+	assert.Equal(t, model.ErrNotFound, err)
+	_, err = os.Stat(gonePartial)
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	for _, id := range []string{"old", "new"} {
+		episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, id)
+		require.NoError(t, err)
+		assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+	}
+}
+
+func TestUpdater_PrunePartials(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	env.updater.config.Downloader.ResumeDownloads = true
+	env.updater.config.Downloader.PartialDir = filepath.Join(env.tmpDir, "..", "partial")
+
+	feedConfig := testFeed("1")
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "new", Status: model.EpisodeNew, PubDate: time.Now()})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "failed", Status: model.EpisodeError, PubDate: time.Now()})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "ignored", Status: model.EpisodeIgnored, PubDate: time.Now()})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "cleaned", Status: model.EpisodeCleaned, PubDate: time.Now()})
+
+	partial := func(id string) string {
+		return ytdl.PartialPath(env.updater.config.Downloader.PartialDir, feedConfig.ID, id)
+	}
+	for _, id := range []string{"new", "failed", "ignored", "cleaned", "removed"} {
+		require.NoError(t, os.MkdirAll(partial(id), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(partial(id), id+".mp3.part"), []byte("media"), 0644))
+	}
+
+	// Runs even if there is nothing to clean
+	require.NoError(t, env.updater.cleanup(testCtx, feedConfig))
+
+	for _, id := range []string{"new", "failed"} {
+		assert.DirExists(t, partial(id))
+	}
+	for _, id := range []string{"ignored", "cleaned", "removed"} {
+		_, err := os.Stat(partial(id))
+		assert.True(t, os.IsNotExist(err), id)
+	}
+}
+
+func TestUpdater_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		calls    int
+		status   model.EpisodeStatus
+	}{
+		{name: "No failures", calls: 1, status: model.EpisodeDownloaded},
+		{name: "Recovered", failures: 2, calls: 3, status: model.EpisodeDownloaded},
+		{name: "Exhausted", failures: 5, calls: 3, status: model.EpisodeError},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			env, teardown := setupUpdater(t, "")
+			defer teardown()
+
+			env.updater.config.Downloader.DownloadRetries = 2
+			env.updater.config.Downloader.RetryBackoff = config.Duration{Duration: 10 * time.Millisecond}
+			env.downloader.failures = tst.failures
+
+			feedConfig := testFeed("1")
+			feedConfig.SponsorblockMode = "off"
+			addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+			start := time.Now()
+			require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+			assert.Equal(t, tst.calls, env.downloader.calls)
+
+			// Backoff doubles after each failed attempt: 10ms, 20ms
+			var backoff time.Duration
+			for i := 1; i < tst.calls; i++ {
+				backoff += 10 * time.Millisecond << uint(i-1)
+			}
+			assert.True(t, time.Since(start) >= backoff, time.Since(start))
+
+			episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+			require.NoError(t, err)
+			assert.Equal(t, tst.status, episode.Status)
+		})
+	}
+}
+
+func TestUpdater_RetriesShutdown(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	env.updater.config.Downloader.DownloadRetries = 2
+	env.updater.config.Downloader.RetryBackoff = config.Duration{Duration: time.Hour}
+	env.downloader.failures = 1
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	// Shutdown interrupts the backoff, the episode is retried during the next update
+	ctx, cancel := context.WithTimeout(testCtx, 50*time.Millisecond)
+	defer cancel()
+
+	_ = env.updater.downloadEpisodes(ctx, feedConfig)
+	assert.Equal(t, 1, env.downloader.calls)
+
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, episode.Status)
+}
+
+func TestUpdater_MaxFilesize(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	env.updater.config.Downloader.DownloadRetries = 2
+	env.downloader.err = ytdl.ErrTooLarge
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	feedConfig.MaxFilesize = 1024
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	// Not retried, neither now nor during the next update
+	assert.Equal(t, 1, env.downloader.calls)
+
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeTooLarge, episode.Status)
+
+	list, err := env.updater.buildDownloadList(testCtx, feedConfig, nil)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestUpdater_SkipLive(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	env.updater.config.Downloader.SkipLive = true
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "live", Status: model.EpisodeNew, Live: true, PubDate: time.Now()})
+
+	// Still streaming
+	env.downloader.metadata = &ytdl.Metadata{LiveStatus: "is_live"}
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.Equal(t, 0, env.downloader.calls)
+
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "live")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, episode.Status)
+	assert.True(t, episode.Live)
+
+	// Ended
+	env.downloader.metadata = &ytdl.Metadata{LiveStatus: "was_live", Duration: 3600}
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.Equal(t, 1, env.downloader.calls)
+	assert.Equal(t, 2, env.downloader.fakeMetadata.calls)
+
+	episode, err = env.db.GetEpisode(testCtx, feedConfig.ID, "live")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+	assert.False(t, episode.Live)
+	assert.EqualValues(t, 3600, episode.Duration)
+}
+
+func TestUpdater_DownloadLive(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "live", Status: model.EpisodeNew, Live: true, PubDate: time.Now()})
+
+	// skip_live is disabled, stream is recorded as is
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.Equal(t, 1, env.downloader.calls)
+	assert.Equal(t, 0, env.downloader.fakeMetadata.calls)
+}
+
+func TestUpdater_MatchFilters(t *testing.T) {
+	updater := &Updater{}
+	episode := &model.Episode{ID: "a", Title: "NEWS Update", Description: "Sponsored"}
+
+	tests := []struct {
+		name    string
+		filters config.Filters
+		expect  bool
+	}{
+		{name: "No filters", expect: true},
+		{name: "Title match", filters: config.Filters{TitleRegexp: regexp.MustCompile("(?i)news")}, expect: true},
+		{name: "Title mismatch", filters: config.Filters{TitleRegexp: regexp.MustCompile("news")}, expect: false},
+		{name: "Negative title", filters: config.Filters{NotTitleRegexp: regexp.MustCompile("Update")}, expect: false},
+		{name: "Description match", filters: config.Filters{DescriptionRegexp: regexp.MustCompile("^Spons")}, expect: true},
+		{name: "Negative description", filters: config.Filters{NotDescriptionRegexp: regexp.MustCompile("Sponsored")}, expect: false},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert.Equal(t, tst.expect, updater.matchFilters(episode, &tst.filters))
+		})
+	}
+}
+
+func TestUpdater_MatchIDFilter(t *testing.T) {
+	updater := &Updater{}
+	episode := &model.Episode{ID: "a"}
+
+	tests := []struct {
+		name    string
+		include config.StringSlice
+		exclude config.StringSlice
+		expect  bool
+	}{
+		{name: "No lists", expect: true},
+		{name: "Included", include: config.StringSlice{"b", "a"}, expect: true},
+		{name: "Not included", include: config.StringSlice{"b"}, expect: false},
+		{name: "Excluded", exclude: config.StringSlice{"a"}, expect: false},
+		{name: "Not excluded", exclude: config.StringSlice{"b"}, expect: true},
+		{name: "Exclude wins", include: config.StringSlice{"a"}, exclude: config.StringSlice{"a"}, expect: false},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			feedConfig := &config.Feed{IncludeIDs: tst.include, ExcludeIDs: tst.exclude}
+			assert.Equal(t, tst.expect, updater.matchIDFilter(episode, feedConfig))
+		})
+	}
+}
+
+func TestUpdater_BuildDownloadList(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	now := time.Now()
+	statuses := []model.EpisodeStatus{
+		model.EpisodeDownloaded, // Newest
+		model.EpisodeNew,
+		model.EpisodeCleaned,
+		model.EpisodeError,
+		model.EpisodeNew,
+		model.EpisodeNew, // Oldest
+	}
+	for i, status := range statuses {
+		id := fmt.Sprintf("%d", i)
+		addEpisode(t, env, "1", &model.Episode{ID: id, Title: id, Status: status, PubDate: now.Add(-time.Duration(i) * time.Hour)})
+	}
+
+	tests := []struct {
+		name     string
+		pageSize int
+		mode     model.PageSizeMode
+		order    model.DownloadOrder
+		expected []string
+	}{
+		{name: "Queued", pageSize: 2, mode: model.PageSizeQueued, expected: []string{"1", "3"}},
+		{name: "Queued exact", pageSize: 4, mode: model.PageSizeQueued, expected: []string{"1", "3", "4", "5"}},
+		{name: "Queued oldest first", pageSize: 2, mode: model.PageSizeQueued, order: model.DownloadOrderOldestFirst, expected: []string{"5", "4"}},
+		{name: "Scanned", pageSize: 4, mode: model.PageSizeScanned, expected: []string{"1", "3"}},
+		{name: "Scanned oldest first", pageSize: 4, mode: model.PageSizeScanned, order: model.DownloadOrderOldestFirst, expected: []string{"3", "1"}},
+		{name: "Scanned all", pageSize: 10, mode: model.PageSizeScanned, expected: []string{"1", "3", "4", "5"}},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			feedConfig := testFeed("1")
+			feedConfig.PageSize = tst.pageSize
+			feedConfig.PageSizeMode = tst.mode
+			feedConfig.DownloadOrder = tst.order
+
+			list, err := env.updater.buildDownloadList(testCtx, feedConfig, nil)
+			require.NoError(t, err)
+
+			var ids []string
+			for _, episode := range list {
+				ids = append(ids, episode.ID)
+			}
+			assert.Equal(t, tst.expected, ids)
+		})
+	}
+}
+
+func TestUpdater_LatestOnly(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	feedConfig := testFeed("1")
+	feedConfig.LatestOnly = true
+	feedConfig.ExcludeIDs = config.StringSlice{"excluded"}
+
+	now := time.Now()
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "downloaded", Status: model.EpisodeDownloaded, PubDate: now.Add(-3 * time.Hour)})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "old", Status: model.EpisodeNew, PubDate: now.Add(-2 * time.Hour)})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "mid", Status: model.EpisodeError, PubDate: now.Add(-time.Hour)})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "new", Status: model.EpisodeNew, PubDate: now})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "excluded", Status: model.EpisodeNew, PubDate: now.Add(time.Hour)})
+
+	status := func(id string) model.EpisodeStatus {
+		episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, id)
+		require.NoError(t, err)
+		return episode.Status
+	}
+
+	list, err := env.updater.buildDownloadList(testCtx, feedConfig, nil)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "new", list[0].ID)
+
+	// The rest is never downloaded, episodes not matching filters are left as is
+	assert.Equal(t, model.EpisodeIgnored, status("old"))
+	assert.Equal(t, model.EpisodeIgnored, status("mid"))
+	assert.Equal(t, model.EpisodeNew, status("new"))
+	assert.Equal(t, model.EpisodeNew, status("excluded"))
+
+	// Episodes older than the downloaded one are ignored too
+	require.NoError(t, env.db.UpdateEpisode(feedConfig.ID, "new", func(episode *model.Episode) error {
+		episode.Status = model.EpisodeDownloaded
+		return nil
+	}))
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "late", Status: model.EpisodeNew, PubDate: now.Add(-30 * time.Minute)})
+
+	list, err = env.updater.buildDownloadList(testCtx, feedConfig, nil)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Equal(t, model.EpisodeIgnored, status("late"))
+}
+
+func TestSortEpisodes(t *testing.T) {
+	now := time.Now()
+	episodes := func() []*model.Episode {
+		return []*model.Episode{
+			{ID: "mid", PubDate: now.Add(-time.Hour)},
+			{ID: "new", PubDate: now},
+			{ID: "old", PubDate: now.Add(-2 * time.Hour)},
+		}
+	}
+
+	ids := func(list []*model.Episode) []string {
+		var out []string
+		for _, episode := range list {
+			out = append(out, episode.ID)
+		}
+		return out
+	}
+
+	newest := episodes()
+	sortEpisodes(newest, model.DownloadOrderNewestFirst)
+	assert.Equal(t, []string{"new", "mid", "old"}, ids(newest))
+
+	oldest := episodes()
+	sortEpisodes(oldest, model.DownloadOrderOldestFirst)
+	assert.Equal(t, []string{"old", "mid", "new"}, ids(oldest))
+}
+
+func TestUpdater_CutPreservesChapters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	// Dumps source chapters on the first call, keeps adjusted chapters passed on the second one
+	saved := filepath.Join(env.tmpDir, "..", "chapters.txt")
+	script := "#!/bin/sh\n" +
+		"for last; do :; done\n" +
+		"case \"$last\" in\n" +
+		"*source.ffmetadata) printf ';FFMETADATA1\\n[CHAPTER]\\nTIMEBASE=1/1000\\nSTART=0\\nEND=30000\\ntitle=Intro\\n' > \"$last\" ;;\n" +
+		"*) for a; do case \"$a\" in *chapters.ffmetadata) cp \"$a\" \"" + saved + "\" ;; esac; done; echo processed > \"$last\" ;;\n" +
+		"esac\n"
+	ffmpeg := filepath.Join(env.tmpDir, "..", "ffmpeg-chapters")
+	require.NoError(t, ioutil.WriteFile(ffmpeg, []byte(script), 0755))
+	env.updater.config.FFmpeg.Path = ffmpeg
+
+	feedConfig := testFeed("1")
+	feedConfig.EmbedChapters = true
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(saved)
+	require.NoError(t, err)
+	assert.Equal(t, ";FFMETADATA1\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=20000\ntitle=Intro\n", string(data))
+}
+
+func TestUpdater_CleanupLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		keepLast int
+		maxSize  config.Size
+		maxAge   time.Duration
+		expect   []string
+	}{
+		{name: "Size budget", maxSize: 250, expect: []string{"c", "d"}},
+		{name: "Keep last and size budget", keepLast: 1, maxSize: 250, expect: []string{"d"}},
+		{name: "Budget not exceeded", maxSize: 1000, expect: []string{"a", "b", "c", "d"}},
+		{name: "Max age", maxAge: 90 * time.Minute, expect: []string{"c", "d"}},
+		{name: "Keep last and max age", keepLast: 3, maxAge: 150 * time.Minute, expect: []string{"b", "c", "d"}},
+		{name: "Max age and size budget", maxSize: 150, maxAge: 150 * time.Minute, expect: []string{"d"}},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			env, teardown := setupUpdater(t, "")
+			defer teardown()
+
+			feedConfig := testFeed("1")
+			feedConfig.Clean = config.Cleanup{KeepLast: tst.keepLast, MaxSize: tst.maxSize, MaxAge: config.Duration{Duration: tst.maxAge}}
+
+			// Published hourly, "d" is the newest one
+			now := time.Now()
+			for i, id := range []string{"a", "b", "c", "d"} {
+				episode := &model.Episode{ID: id, Status: model.EpisodeDownloaded, Size: 100, PubDate: now.Add(time.Duration(i-3) * time.Hour)}
+				addEpisode(t, env, feedConfig.ID, episode)
+				_, err := env.fs.Create(testCtx, feedConfig.ID, feed.EpisodeName(feedConfig, episode), strings.NewReader("media"))
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, env.updater.cleanup(testCtx, feedConfig))
+
+			var kept []string
+			err := env.db.WalkEpisodes(testCtx, feedConfig.ID, func(episode *model.Episode) error {
+				if episode.Status == model.EpisodeDownloaded {
+					kept = append(kept, episode.ID)
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tst.expect, kept)
+		})
+	}
+}
+
+func TestUpdater_DryRun(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	env.updater.dryRun = true
+
+	feedConfig := testFeed("1")
+	feedConfig.Clean = config.Cleanup{KeepLast: 1}
+
+	now := time.Now()
+	for i, id := range []string{"a", "b"} {
+		episode := &model.Episode{ID: id, Status: model.EpisodeDownloaded, PubDate: now.Add(time.Duration(i) * time.Hour)}
+		addEpisode(t, env, feedConfig.ID, episode)
+		_, err := env.fs.Create(testCtx, feedConfig.ID, feed.EpisodeName(feedConfig, episode), strings.NewReader("media"))
+		require.NoError(t, err)
+	}
+
+	// Episodes which are not saved to database yet
+	pending := []*model.Episode{{ID: "c", Status: model.EpisodeNew, PubDate: now}}
+	require.NoError(t, env.updater.rehearseDownloads(testCtx, feedConfig, pending))
+	assert.Equal(t, 0, env.downloader.calls)
+
+	list, err := env.updater.buildDownloadList(testCtx, feedConfig, pending)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "c", list[0].ID)
+
+	require.NoError(t, env.updater.cleanup(testCtx, feedConfig))
+
+	for _, id := range []string{"a", "b"} {
+		episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, id)
+		require.NoError(t, err)
+		assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+		_, err = env.fs.Size(testCtx, feedConfig.ID, feed.EpisodeName(feedConfig, episode))
+		assert.NoError(t, err)
+	}
+}
+
+func TestUpdater_CancelKillsFFmpeg(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	// Replace the shell with sleep, so killing the process doesn't leave orphans behind
+	hanging := filepath.Join(env.tmpDir, "..", "ffmpeg-hang")
+	require.NoError(t, ioutil.WriteFile(hanging, []byte("#!/bin/sh\nexec sleep 30\n"), 0755))
+	env.updater.config.FFmpeg.Path = hanging
+
+	feedConfig := testFeed("1")
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	ctx, cancel := context.WithTimeout(testCtx, 200*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := env.updater.downloadEpisodes(ctx, feedConfig)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	assert.True(t, time.Since(started) < 10*time.Second, "ffmpeg was not killed")
+
+	// Interrupted episode must be retried next time instead of being marked as failed
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, episode.Status)
+}
+
+func TestUpdater_Transcripts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	env.downloader.subtitles = "WEBVTT\n\n00:00:21.000 --> 00:00:25.000\nHello"
+
+	feedConfig := testFeed("1")
+	feedConfig.Transcripts = true
+	episode := &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()}
+	addEpisode(t, env, feedConfig.ID, episode)
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	// Cue timings are shifted by the cut sponsor segment
+	data, err := ioutil.ReadFile(filepath.Join(env.tmpDir, "..", "data", feedConfig.ID, "a.vtt"))
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:11.000 --> 00:00:15.000\nHello", string(data))
+
+	// Transcript is removed along with the episode
+	feedConfig.Clean = config.Cleanup{KeepLast: 1}
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "b", Status: model.EpisodeDownloaded, PubDate: time.Now().Add(time.Hour)})
+	require.NoError(t, env.updater.cleanup(testCtx, feedConfig))
+
+	_, err = env.fs.Size(testCtx, feedConfig.ID, feed.TranscriptName(feedConfig, episode))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUpdater_TranscriptsMissing(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	feedConfig.Transcripts = true
+	episode := &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()}
+	addEpisode(t, env, feedConfig.ID, episode)
+
+	// Episode without captions is still downloaded
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+
+	_, err = env.fs.Size(testCtx, feedConfig.ID, feed.TranscriptName(feedConfig, episode))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUpdater_PublishChapters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	env.downloader.info = `{"chapters": [{"start_time": 0, "end_time": 30, "title": "Intro"}, {"start_time": 30, "end_time": 60, "title": "Outro"}]}`
+
+	feedConfig := testFeed("1")
+	feedConfig.PublishChapters = true
+	episode := &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()}
+	addEpisode(t, env, feedConfig.ID, episode)
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	// Chapters are shifted by the cut sponsor segment
+	data, err := ioutil.ReadFile(filepath.Join(env.tmpDir, "..", "data", feedConfig.ID, "a.chapters.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": "1.2.0", "chapters": [
+		{"startTime": 0, "endTime": 20, "title": "Intro"},
+		{"startTime": 20, "endTime": 50, "title": "Outro"}
+	]}`, string(data))
+
+	url, err := env.fs.URL(testCtx, feedConfig.ID, feed.ChaptersName(feedConfig, episode))
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/1/a.chapters.json", url)
+}
+
+func TestUpdater_SplitByChapters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	// Mimics the segment muxer by writing a part per split point
+	dir := filepath.Join(env.tmpDir, "..")
+	script := `#!/bin/sh
+prev=""
+for arg; do
+  if [ "$prev" = "-segment_times" ]; then times="$arg"; fi
+  prev="$arg"
+done
+case "$prev" in
+*%03d*)
+  echo "$times" > "` + filepath.Join(dir, "times.txt") + `"
+  n=0
+  for t in 0 $(echo "$times" | tr , ' '); do
+    printf "part$n" > "$(echo "$prev" | sed "s/%03d/$(printf %03d $n)/")"
+    n=$((n+1))
+  done;;
+*) echo processed > "$prev";;
+esac
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755))
+
+	env.downloader.info = `{"chapters": [
+		{"start_time": 0, "end_time": 30, "title": "Intro"},
+		{"start_time": 30, "end_time": 60, "title": "Main"},
+		{"start_time": 60, "end_time": 90, "title": ""}
+	]}`
+
+	feedConfig := testFeed("1")
+	feedConfig.SplitByChapters = true
+	pubDate := time.Now().UTC()
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Title: "A", Status: model.EpisodeNew, PubDate: pubDate})
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	// Split points are shifted by the cut sponsor segment
+	times, err := ioutil.ReadFile(filepath.Join(dir, "times.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "20.000000,50.000000\n", string(times))
+
+	parent, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeSplit, parent.Status)
+
+	_, err = os.Stat(filepath.Join(dir, "data", feedConfig.ID, "a.mp3"))
+	assert.True(t, os.IsNotExist(err))
+
+	expected := []struct {
+		id       string
+		title    string
+		duration int64
+	}{
+		{"a-ch1", "A - Intro", 20},
+		{"a-ch2", "A - Main", 30},
+		{"a-ch3", "A (part 3)", 30},
+	}
+
+	for i, tst := range expected {
+		part, err := env.db.GetEpisode(testCtx, feedConfig.ID, tst.id)
+		require.NoError(t, err)
+		assert.Equal(t, tst.title, part.Title)
+		assert.Equal(t, tst.duration, part.Duration)
+		assert.Equal(t, "a", part.Parent)
+		assert.Equal(t, model.EpisodeDownloaded, part.Status)
+		assert.True(t, part.PubDate.Equal(pubDate.Add(time.Duration(i)*time.Second)))
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "data", feedConfig.ID, tst.id+".mp3"))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("part%d", i), string(data))
+		assert.EqualValues(t, len(data), part.Size)
+	}
+
+	files, err := ioutil.ReadDir(env.tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestUpdater_SplitWithoutChapters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	env.downloader.info = `{"chapters": [{"start_time": 0, "end_time": 30, "title": "Intro"}]}`
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	feedConfig.SplitByChapters = true
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Title: "A", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	// Published as a single episode
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+	_, err = env.db.GetEpisode(testCtx, feedConfig.ID, "a-ch1")
+	assert.Equal(t, model.ErrNotFound, err)
+}
+
+func TestUpdater_EnrichMetadata(t *testing.T) {
+	env, teardown := setupUpdater(t, `[]`)
+	defer teardown()
+
+	env.downloader.info = `{"description": "Full description", "tags": ["music", "live"]}`
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	feedConfig.EnrichMetadata = true
+	feedConfig.AppendTags = true
+	episode := &model.Episode{ID: "a", Description: "Short", Status: model.EpisodeNew, PubDate: time.Now()}
+	addEpisode(t, env, feedConfig.ID, episode)
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "Full description\n\nTags: music, live", stored.Description)
+
+	// Raw info JSON is published next to the episode
+	data, err := ioutil.ReadFile(filepath.Join(env.tmpDir, "..", "data", feedConfig.ID, "a.info.json"))
+	require.NoError(t, err)
+	assert.Equal(t, env.downloader.info, string(data))
+}
+
+func TestUpdater_EpisodeArtwork(t *testing.T) {
+	env, teardown := setupUpdater(t, `[]`)
+	defer teardown()
+
+	env.downloader.thumbnail = "jpeg"
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	feedConfig.EpisodeArtwork = true
+	episode := &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()}
+	addEpisode(t, env, feedConfig.ID, episode)
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(env.tmpDir, "..", "data", feedConfig.ID, "a.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", string(data))
+
+	url, err := env.fs.URL(testCtx, feedConfig.ID, feed.ArtworkName(feedConfig, episode))
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/1/a.jpg", url)
+}
+
+func TestEnrichDescription(t *testing.T) {
+	tests := []struct {
+		name       string
+		metadata   ytdl.Metadata
+		appendTags bool
+		expect     string
+	}{
+		{name: "Full description", metadata: ytdl.Metadata{Description: "Full", Tags: []string{"a"}}, expect: "Full"},
+		{name: "No description", metadata: ytdl.Metadata{}, expect: "Short"},
+		{name: "Tags", metadata: ytdl.Metadata{Description: "Full", Tags: []string{"a", "b"}}, appendTags: true, expect: "Full\n\nTags: a, b"},
+		{name: "No tags", metadata: ytdl.Metadata{Description: "Full"}, appendTags: true, expect: "Full"},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert.Equal(t, tst.expect, enrichDescription("Short", &tst.metadata, tst.appendTags))
+		})
+	}
+}
+
+func TestUpdater_VerifyDownloads(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffprobe requires a POSIX shell")
+	}
+
+	tests := []struct {
+		name     string
+		segments string
+		probe    string
+		expect   model.EpisodeStatus
+	}{
+		{
+			name:   "Valid",
+			probe:  `{"streams": [{"codec_type": "audio"}], "format": {"duration": "99.5"}}`,
+			expect: model.EpisodeDownloaded,
+		},
+		{
+			name:     "Valid after cut",
+			segments: `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`,
+			probe:    `{"streams": [{"codec_type": "audio"}], "format": {"duration": "90.0"}}`,
+			expect:   model.EpisodeDownloaded,
+		},
+		{
+			name:   "Truncated",
+			probe:  `{"streams": [{"codec_type": "audio"}], "format": {"duration": "42.0"}}`,
+			expect: model.EpisodeError,
+		},
+		{
+			name:   "No streams",
+			probe:  `{"streams": [], "format": {"duration": "100.0"}}`,
+			expect: model.EpisodeError,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			env, teardown := setupUpdater(t, tst.segments)
+			defer teardown()
+
+			probe := filepath.Join(env.tmpDir, "..", "ffprobe")
+			require.NoError(t, ioutil.WriteFile(probe, []byte("#!/bin/sh\necho '"+tst.probe+"'\n"), 0755))
+			env.updater.config.FFmpeg.ProbePath = probe
+
+			feedConfig := testFeed("1")
+			feedConfig.SponsorblockMode = "requiredelay"
+			feedConfig.VerifyDownloads = true
+			episode := &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now().Add(-time.Hour), Duration: 100}
+			addEpisode(t, env, feedConfig.ID, episode)
+
+			err := env.updater.downloadEpisodes(testCtx, feedConfig)
+			require.NoError(t, err)
+
+			stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+			require.NoError(t, err)
+			assert.Equal(t, tst.expect, stored.Status)
+
+			_, err = env.fs.Size(testCtx, feedConfig.ID, feed.EpisodeName(feedConfig, episode))
+			assert.Equal(t, tst.expect == model.EpisodeError, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestUpdater_MinFreeSpace(t *testing.T) {
+	env, teardown := setupUpdater(t, `[]`)
+	defer teardown()
+
+	free, err := fs.FreeSpace(env.updater.config.Server.DataDir)
+	require.NoError(t, err)
+	require.NotZero(t, free)
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	// Not enough space, episode is left for the next update
+	env.updater.config.Downloader.MinFreeSpace = config.Size(free * 2)
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.Equal(t, 0, env.downloader.calls)
+
+	stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, stored.Status)
+
+	env.updater.config.Downloader.MinFreeSpace = 1
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.Equal(t, 1, env.downloader.calls)
+}
+
+func TestUpdater_DelayMode(t *testing.T) {
+	env, teardown := setupUpdater(t, `[]`)
+	defer teardown()
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "delay"
+	feedConfig.SponsorblockDelay = config.Duration{Duration: time.Hour}
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	// Recently published episode is deferred
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 0, env.downloader.calls)
+
+	stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, stored.Status)
+
+	// Downloaded once the delay has passed
+	require.NoError(t, env.db.UpdateEpisode(feedConfig.ID, "a", func(episode *model.Episode) error {
+		episode.PubDate = time.Now().Add(-2 * time.Hour)
+		return nil
+	}))
+
+	err = env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 1, env.downloader.calls)
+
+	stored, err = env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+}
+
+func TestUpdater_Concurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		slots       int
+		peak        int32
+	}{
+		{name: "Sequential", concurrency: 1, peak: 1},
+		{name: "Workers", concurrency: 2, peak: 2},
+		{name: "Global limit", concurrency: 3, slots: 1, peak: 1},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			env, teardown := setupUpdater(t, "")
+			defer teardown()
+
+			env.downloader.delay = 20 * time.Millisecond
+			if tst.slots > 0 {
+				env.updater.slots = make(chan struct{}, tst.slots)
+			}
+
+			feedConfig := testFeed("1")
+			feedConfig.SponsorblockMode = "off"
+			feedConfig.Concurrency = tst.concurrency
+			for _, id := range []string{"a", "b", "c", "d"} {
+				addEpisode(t, env, feedConfig.ID, &model.Episode{ID: id, Status: model.EpisodeNew, PubDate: time.Now()})
+			}
+
+			require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+			assert.Equal(t, 4, env.downloader.calls)
+			assert.EqualValues(t, tst.peak, env.downloader.peak)
+
+			for _, id := range []string{"a", "b", "c", "d"} {
+				episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, id)
+				require.NoError(t, err)
+				assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+			}
+		})
+	}
+}
+
+func TestUpdater_QueryConcurrency(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	var running, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			max := atomic.LoadInt32(&peak)
+			if n <= max || atomic.CompareAndSwapInt32(&peak, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	env.updater.sponsorblock = sponsorblock.NewClient(http.DefaultClient, []string{server.URL}, time.Second)
+	env.updater.querySlots = make(chan struct{}, 1)
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "delay"
+	feedConfig.Concurrency = 3
+	for _, id := range []string{"a", "b", "c"} {
+		addEpisode(t, env, feedConfig.ID, &model.Episode{ID: id, Status: model.EpisodeNew, PubDate: time.Now().Add(-time.Hour)})
+	}
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.Equal(t, 3, env.downloader.calls)
+	assert.EqualValues(t, 1, peak)
+}
+
+func TestUpdater_ActualDuration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffprobe requires a POSIX shell")
+	}
+
+	tests := []struct {
+		name     string
+		segments string
+		expect   int64
+	}{
+		{name: "Cut", segments: `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`, expect: 90},
+		{name: "Not cut", expect: 0},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			env, teardown := setupUpdater(t, tst.segments)
+			defer teardown()
+
+			probe := filepath.Join(env.tmpDir, "..", "ffprobe")
+			output := `{"streams": [{"codec_type": "audio"}], "format": {"duration": "89.6"}}`
+			require.NoError(t, ioutil.WriteFile(probe, []byte("#!/bin/sh\necho '"+output+"'\n"), 0755))
+			env.updater.config.FFmpeg.ProbePath = probe
+
+			feedConfig := testFeed("1")
+			feedConfig.SponsorblockMode = "requiredelay"
+			addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now().Add(-time.Hour), Duration: 100})
+
+			err := env.updater.downloadEpisodes(testCtx, feedConfig)
+			require.NoError(t, err)
+
+			stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+			require.NoError(t, err)
+			assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+			assert.Equal(t, int64(100), stored.Duration)
+			assert.Equal(t, tst.expect, stored.ActualDuration)
+		})
+	}
+}
+
+func TestBuildFilterGraph(t *testing.T) {
+	segments := []sponsorblock.Segment{{Segment: []float64{10, 20}, UUID: "1", Category: "sponsor"}}
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorBlockCategories.Sponsors = "cut"
+	feedConfig.LoudnessTarget = -16
+
+	// Cut only
+	filter, err := buildFilterGraph(segments, feedConfig)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(filter, "concat=n=2:v=0:a=1[outa]"), filter)
+
+	// Normalize only
+	feedConfig.NormalizeAudio = true
+	filter, err = buildFilterGraph(nil, feedConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "[0:a]loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000[outa]", filter)
+
+	// Cut and normalize in the same graph
+	filter, err = buildFilterGraph(segments, feedConfig)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(filter, "concat=n=2:v=0:a=1[cuta];[cuta]loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000[outa]"), filter)
+	assert.Equal(t, 1, strings.Count(filter, "[outa]"))
+}
+
+func TestUpdater_NormalizeAudio(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	// Saves arguments to check that ffmpeg is called even though there are no segments to cut
+	saved := filepath.Join(env.tmpDir, "..", "args.txt")
+	script := "#!/bin/sh\necho \"$@\" > \"" + saved + "\"\nfor last; do :; done\necho normalized > \"$last\"\n"
+	ffmpeg := filepath.Join(env.tmpDir, "..", "ffmpeg-loudnorm")
+	require.NoError(t, ioutil.WriteFile(ffmpeg, []byte(script), 0755))
+	env.updater.config.FFmpeg.Path = ffmpeg
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	feedConfig.NormalizeAudio = true
+	feedConfig.LoudnessTarget = -14
+	episode := &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()}
+	addEpisode(t, env, feedConfig.ID, episode)
+
+	err := env.updater.downloadEpisodes(testCtx, feedConfig)
+	require.NoError(t, err)
+
+	args, err := ioutil.ReadFile(saved)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "-filter_complex [0:a]loudnorm=I=-14:TP=-1.5:LRA=11,aresample=48000[outa] -map [outa]")
+
+	stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+
+	size, err := env.fs.Size(testCtx, feedConfig.ID, feed.EpisodeName(feedConfig, episode))
+	require.NoError(t, err)
+	assert.EqualValues(t, len("normalized\n"), size)
+}
+
+func TestUpdater_Remux(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	env.downloader.ext = "mkv"
+
+	saved := filepath.Join(env.tmpDir, "..", "args.txt")
+	script := "#!/bin/sh\necho \"$@\" > \"" + saved + "\"\nfor last; do :; done\necho remuxed > \"$last\"\n"
+	ffmpeg := filepath.Join(env.tmpDir, "..", "ffmpeg-remux")
+	require.NoError(t, ioutil.WriteFile(ffmpeg, []byte(script), 0755))
+	env.updater.config.FFmpeg.Path = ffmpeg
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	feedConfig.Format = model.FormatVideo
+	episode := &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()}
+	addEpisode(t, env, feedConfig.ID, episode)
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	args, err := ioutil.ReadFile(saved)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "-f matroska -i ")
+	assert.Contains(t, string(args), "-map 0 -c copy ")
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(string(args)), "remuxed.mp4"), string(args))
+
+	data, err := ioutil.ReadFile(filepath.Join(env.tmpDir, "..", "data", feedConfig.ID, feed.EpisodeName(feedConfig, episode)))
+	require.NoError(t, err)
+	assert.Equal(t, "remuxed\n", string(data))
+
+	// Streams which don't fit the container are not served with a wrong content type
+	require.NoError(t, ioutil.WriteFile(ffmpeg, []byte("#!/bin/sh\nexit 1\n"), 0755))
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "b", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "b")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeError, stored.Status)
+
+	_, err = env.fs.Size(testCtx, feedConfig.ID, "b.mp4")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUpdater_CutAudio(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, `[{"segment": [10.0, 20.0], "UUID": "1", "category": "sponsor"}]`)
+	defer teardown()
+
+	saved := filepath.Join(env.tmpDir, "..", "args.txt")
+	script := "#!/bin/sh\necho \"$@\" > \"" + saved + "\"\nfor last; do :; done\necho cut > \"$last\"\n"
+	ffmpeg := filepath.Join(env.tmpDir, "..", "ffmpeg-cut")
+	require.NoError(t, ioutil.WriteFile(ffmpeg, []byte(script), 0755))
+	env.updater.config.FFmpeg.Path = ffmpeg
+
+	feedConfig := testFeed("1")
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	args, err := ioutil.ReadFile(saved)
+	require.NoError(t, err)
+
+	// Audio feeds are downloaded without video, so the graph must not reference video streams
+	assert.Contains(t, string(args), "concat=n=2:v=0:a=1[outa] -map [outa]")
+	assert.NotContains(t, string(args), "[0:v]")
+	assert.NotContains(t, string(args), "[outv]")
+
+	stored, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+}
+
+func TestUpdater_Hooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks require a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	dir := filepath.Join(env.tmpDir, "..")
+	saved := filepath.Join(dir, "post.txt")
+
+	pre := filepath.Join(dir, "pre.sh")
+	require.NoError(t, ioutil.WriteFile(pre, []byte("#!/bin/sh\ntest \"$PODSYNC_EPISODE_ID\" != skip\n"), 0755))
+
+	post := filepath.Join(dir, "post.sh")
+	script := "#!/bin/sh\necho \"$1 $PODSYNC_FEED_ID $PODSYNC_EPISODE_ID $PODSYNC_EPISODE_TITLE $PODSYNC_FILE_PATH\" >> \"" + saved + "\"\nexit 1\n"
+	require.NoError(t, ioutil.WriteFile(post, []byte(script), 0755))
+
+	env.updater.config.Hooks = config.Hooks{
+		PreDownload:  config.StringSlice{pre},
+		PostDownload: config.StringSlice{post, "arg"},
+		Timeout:      config.Duration{Duration: time.Minute},
+	}
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Title: "Title", Status: model.EpisodeNew, PubDate: time.Now()})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "skip", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.Equal(t, 1, env.downloader.calls)
+
+	// Failed post_download hook doesn't affect the episode
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+	skipped, err := env.db.GetEpisode(testCtx, feedConfig.ID, "skip")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, skipped.Status)
+
+	output, err := ioutil.ReadFile(saved)
+	require.NoError(t, err)
+	expected := fmt.Sprintf("arg 1 a Title %s\n", filepath.Join(env.updater.config.Server.DataDir, "1", feed.EpisodeName(feedConfig, episode)))
+	assert.Equal(t, expected, string(output))
+}
+
+func TestUpdater_HookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks require a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	pre := filepath.Join(env.tmpDir, "..", "pre.sh")
+	require.NoError(t, ioutil.WriteFile(pre, []byte("#!/bin/sh\nexec sleep 10\n"), 0755))
+
+	env.updater.config.Hooks = config.Hooks{
+		PreDownload: config.StringSlice{pre},
+		Timeout:     config.Duration{Duration: 50 * time.Millisecond},
+	}
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+
+	started := time.Now()
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+	assert.True(t, time.Since(started) < 5*time.Second)
+	assert.Equal(t, 0, env.downloader.calls)
+}
+
+func TestUpdater_Dedupe(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	first := testFeed("1")
+	first.SponsorblockMode = "off"
+	second := testFeed("2")
+	second.SponsorblockMode = "off"
+	video := testFeed("3")
+	video.SponsorblockMode = "off"
+	video.Format = model.FormatVideo
+
+	env.updater.config.Storage.Dedupe = true
+	env.updater.config.Feeds = map[string]*config.Feed{"1": first, "2": second, "3": video}
+
+	for _, feedConfig := range []*config.Feed{first, second, video} {
+		addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+	}
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, first))
+	assert.Equal(t, 1, env.downloader.calls)
+
+	// Same video and format, linked instead of downloading
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, second))
+	assert.Equal(t, 1, env.downloader.calls)
+
+	stored, err := env.db.GetEpisode(testCtx, second.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+	assert.EqualValues(t, len("media"), stored.Size)
+
+	// Different format has to be downloaded
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, video))
+	assert.Equal(t, 2, env.downloader.calls)
+}
+
+func TestUpdater_DedupeFiltered(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	// A channel split into clips and full episodes, plus a feed of everything
+	clips := testFeed("clips")
+	clips.SponsorblockMode = "off"
+	clips.Filters.MaxDuration = config.Duration{Duration: 2 * time.Minute}
+	full := testFeed("full")
+	full.SponsorblockMode = "off"
+	full.Filters.MinDuration = config.Duration{Duration: 2 * time.Minute}
+	all := testFeed("all")
+	all.SponsorblockMode = "off"
+
+	env.updater.config.Storage.Dedupe = true
+	env.updater.config.Feeds = map[string]*config.Feed{"clips": clips, "full": full, "all": all}
+
+	now := time.Now()
+	for _, feedConfig := range []*config.Feed{clips, full, all} {
+		addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "short", Duration: 60, Status: model.EpisodeNew, PubDate: now})
+		addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "long", Duration: 3600, Status: model.EpisodeNew, PubDate: now.Add(-time.Hour)})
+	}
+
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, clips))
+	assert.Equal(t, 1, env.downloader.calls)
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, full))
+	assert.Equal(t, 2, env.downloader.calls)
+
+	// Each feed keeps its own state
+	for _, tst := range []struct {
+		feedID    string
+		episodeID string
+		status    model.EpisodeStatus
+	}{
+		{"clips", "short", model.EpisodeDownloaded},
+		{"clips", "long", model.EpisodeNew},
+		{"full", "short", model.EpisodeNew},
+		{"full", "long", model.EpisodeDownloaded},
+	} {
+		stored, err := env.db.GetEpisode(testCtx, tst.feedID, tst.episodeID)
+		require.NoError(t, err)
+		assert.Equal(t, tst.status, stored.Status, "%s/%s", tst.feedID, tst.episodeID)
+	}
+
+	// Episodes overlapping with both feeds are linked
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, all))
+	assert.Equal(t, 2, env.downloader.calls)
+
+	for _, id := range []string{"short", "long"} {
+		stored, err := env.db.GetEpisode(testCtx, all.ID, id)
+		require.NoError(t, err)
+		assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+	}
+}
+
+func TestUpdater_Rendition(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	source := testFeed("1")
+	source.Format = model.FormatVideo
+	rendition := testFeed("2")
+	rendition.SourceFeed = source.ID
+
+	env.updater.config.Feeds = map[string]*config.Feed{"1": source, "2": rendition}
+
+	now := time.Now()
+	addEpisode(t, env, source.ID, &model.Episode{ID: "a", Title: "A", Status: model.EpisodeDownloaded, Size: 5, PubDate: now})
+	addEpisode(t, env, source.ID, &model.Episode{ID: "b", Title: "B", Status: model.EpisodeNew, PubDate: now.Add(-time.Hour)})
+	addEpisode(t, env, source.ID, &model.Episode{ID: "c", Title: "C", Status: model.EpisodeCleaned, PubDate: now.Add(-2 * time.Hour)})
+	_, err := env.fs.Create(testCtx, source.ID, "a.mp4", strings.NewReader("media"))
+	require.NoError(t, err)
+
+	// Episodes are taken from the source feed with their own status
+	result, err := env.updater.updateFeed(testCtx, rendition, false)
+	require.NoError(t, err)
+	assert.Len(t, result.Episodes, 2)
+
+	stored, err := env.db.GetEpisode(testCtx, rendition.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "A", stored.Title)
+	assert.Equal(t, model.EpisodeNew, stored.Status)
+
+	_, err = env.db.GetEpisode(testCtx, rendition.ID, "c")
+	assert.Equal(t, model.ErrNotFound, err)
+
+	// Transcoded from the source file, episodes not downloaded by the source feed are skipped
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, rendition))
+	assert.Equal(t, 0, env.downloader.calls)
+
+	stored, err = env.db.GetEpisode(testCtx, rendition.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, stored.Status)
+	assert.EqualValues(t, len("processed\n"), stored.Size)
+
+	stored, err = env.db.GetEpisode(testCtx, rendition.ID, "b")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeNew, stored.Status)
+
+	// Source episode is kept intact
+	stored, err = env.db.GetEpisode(testCtx, source.ID, "a")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, stored.Size)
+
+	files, err := ioutil.ReadDir(env.tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestUpdater_Backfill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	source := testFeed("1")
+	source.Format = model.FormatVideo
+	rendition := testFeed("2")
+	rendition.SourceFeed = source.ID
+	rendition.PageSize = 2
+	rendition.Backfill = true
+
+	env.updater.config.Feeds = map[string]*config.Feed{"1": source, "2": rendition}
+
+	addSource := func(ids ...string) {
+		for _, id := range ids {
+			addEpisode(t, env, source.ID, &model.Episode{ID: id, Title: id, Status: model.EpisodeDownloaded, PubDate: time.Now()})
+			_, err := env.fs.Create(testCtx, source.ID, id+".mp4", strings.NewReader("media"))
+			require.NoError(t, err)
+		}
+	}
+
+	downloaded := func(ids ...string) int {
+		count := 0
+		for _, id := range ids {
+			stored, err := env.db.GetEpisode(testCtx, rendition.ID, id)
+			require.NoError(t, err)
+			if stored.Status == model.EpisodeDownloaded {
+				count++
+			}
+		}
+		return count
+	}
+
+	// The first update ignores page size
+	addSource("a", "b", "c", "d")
+	require.NoError(t, env.updater.Update(testCtx, rendition))
+	assert.Equal(t, 4, downloaded("a", "b", "c", "d"))
+
+	stored, err := env.db.GetFeed(testCtx, rendition.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Seeded)
+
+	// Seeded feeds are limited by page size again
+	addSource("e", "f", "g", "h")
+	require.NoError(t, env.updater.Update(testCtx, rendition))
+	assert.Less(t, downloaded("e", "f", "g", "h"), 4)
+
+	stored, err = env.db.GetFeed(testCtx, rendition.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Seeded)
+
+	// Feeds without backfill are never seeded
+	rendition.Backfill = false
+	require.NoError(t, env.updater.Update(testCtx, rendition))
+	stored, err = env.db.GetFeed(testCtx, rendition.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.Seeded)
+}
+
+func TestUpdater_Status(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	source := testFeed("1")
+	source.Format = model.FormatVideo
+	rendition := testFeed("2")
+	rendition.SourceFeed = source.ID
+
+	env.updater.config.Feeds = map[string]*config.Feed{"1": source, "2": rendition}
+
+	// Source feed hasn't been updated yet
+	for i := 0; i < 2; i++ {
+		require.Error(t, env.updater.Update(testCtx, rendition))
+	}
+
+	status, err := env.db.GetFeedStatus(testCtx, rendition.ID)
+	require.NoError(t, err)
+	assert.Contains(t, status.LastError, `source feed "1" hasn't been updated yet`)
+	assert.False(t, status.LastErrorAt.IsZero())
+	assert.True(t, status.LastSuccess.IsZero())
+	assert.Equal(t, 2, status.Failures)
+
+	// The last error is kept after recovering
+	addEpisode(t, env, source.ID, &model.Episode{ID: "a", Title: "A", Status: model.EpisodeDownloaded, PubDate: time.Now()})
+	_, err = env.fs.Create(testCtx, source.ID, "a.mp4", strings.NewReader("media"))
+	require.NoError(t, err)
+	require.NoError(t, env.updater.Update(testCtx, rendition))
+
+	status, err = env.db.GetFeedStatus(testCtx, rendition.ID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, status.LastError)
+	assert.False(t, status.LastSuccess.Before(status.LastErrorAt))
+	assert.Equal(t, 0, status.Failures)
+}
+
+func TestTranscodeArgs(t *testing.T) {
+	audio := &config.Feed{Format: model.FormatAudio, AudioCodec: model.AudioCodecOpus, AudioBitrate: 48}
+	assert.Equal(t,
+		[]string{"-i", "in.mp4", "-map", "0:a", "-c:a", "libopus", "-b:a", "48k", "out.opus"},
+		transcodeArgs(nil, audio, "in.mp4", "out.opus"))
+
+	video := &config.Feed{Format: model.FormatVideo, MaxHeight: 360, NormalizeAudio: true, LoudnessTarget: -16}
+	assert.Equal(t,
+		[]string{"-y", "-i", "in.mp4", "-filter_complex", "[0:a]loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000[outa]", "-map", "[outa]",
+			"-map", "0:v", "-c:v", "libx264", "-c:a", "aac", "-vf", "scale=-2:'min(ih,360)'", "out.mp4"},
+		transcodeArgs([]string{"-y"}, video, "in.mp4", "out.mp4"))
+}
+
+func TestFFmpegInput(t *testing.T) {
+	assert.Equal(t, []string{"-f", "mp4", "-i", "/tmp/a.m4a"}, ffmpegInput("/tmp/a.m4a"))
+	assert.Equal(t, []string{"-f", "matroska", "-i", "/tmp/a.mkv"}, ffmpegInput("/tmp/a.mkv"))
+	assert.Equal(t, []string{"-i", "/tmp/a-1"}, ffmpegInput("/tmp/a-1"))
+}
+
+func testImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestCoverArtProblem(t *testing.T) {
+	assert.Empty(t, coverArtProblem(testImage(t, 1400, 1400)))
+	assert.Equal(t, "png image is 100x50, a square of 1400-3000px is expected", coverArtProblem(testImage(t, 100, 50)))
+	assert.NotEmpty(t, coverArtProblem(testImage(t, 4000, 4000)))
+	assert.Equal(t, "not a JPEG or PNG image", coverArtProblem([]byte("<svg/>")))
+}
+
+func TestUpdater_CoverArt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	var requests int32
+	small := testImage(t, 100, 50)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/cover.png" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(small)
+	}))
+	defer server.Close()
+
+	// Resized image is written to stdout
+	dir := filepath.Join(env.tmpDir, "..")
+	script := "#!/bin/sh\necho \"$@\" > \"" + filepath.Join(dir, "args.txt") + "\"\ncat > /dev/null\nprintf resized\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755))
+
+	resized := testFeed("1")
+	resized.Custom.CoverArt = server.URL + "/cover.png"
+	resized.Custom.CoverArtResize = true
+	addEpisode(t, env, resized.ID, &model.Episode{ID: "a", Status: model.EpisodeNew})
+
+	missing := testFeed("2")
+	missing.Custom.CoverArt = server.URL + "/missing.png"
+	missing.Custom.CoverArtResize = true
+	addEpisode(t, env, missing.ID, &model.Episode{ID: "a", Status: model.EpisodeNew})
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, env.updater.buildXML(testCtx, resized))
+	}
+
+	// Fetched once
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "data", "1.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "http://localhost/1/podsync-cover.jpg")
+	assert.NotContains(t, string(data), server.URL)
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "data", resized.ID, feed.CoverArtName))
+	require.NoError(t, err)
+	assert.Equal(t, "resized", string(data))
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "scale=1400:1400:force_original_aspect_ratio=decrease,pad=1400:1400")
+
+	// Source is linked if it can't be fetched
+	require.NoError(t, env.updater.buildXML(testCtx, missing))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "data", "2.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), server.URL+"/missing.png")
+
+	// Problems are reported at startup
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	resized.Custom.CoverArtResize = false
+	env.updater.config.Feeds = map[string]*config.Feed{"1": resized, "2": missing}
+	env.updater.CheckCoverArts(testCtx)
+
+	var warnings []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "png image is 100x50")
+	assert.Equal(t, "cover art is not reachable", warnings[1])
+}
+
+// metricValue scrapes the metrics handler and returns the value of the given metric for the feed
+func metricValue(t *testing.T, name, feedID string) float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	prefix := name + `{feed_id="` + feedID + `",`
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			var value float64
+			_, err := fmt.Sscanf(line[strings.LastIndex(line, " ")+1:], "%g", &value)
+			require.NoError(t, err)
+			return value
+		}
+	}
+
+	return 0
+}
+
+func TestUpdater_SegmentsCutMetric(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	// Back-to-back segments from the start are a single cut, the last one is another
+	env, teardown := setupUpdater(t, `[
+		{"segment": [0.0, 10.0], "UUID": "1", "category": "sponsor"},
+		{"segment": [10.0, 20.0], "UUID": "2", "category": "sponsor"},
+		{"segment": [30.0, 40.0], "UUID": "3", "category": "sponsor"}
+	]`)
+	defer teardown()
+
+	feedConfig := testFeed("segments-cut-metric")
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+	require.NoError(t, env.updater.downloadEpisodes(testCtx, feedConfig))
+
+	assert.Equal(t, 2.0, metricValue(t, "podsync_sponsorblock_segments_cut_total", feedConfig.ID))
+}
+
+func TestUpdater_Metrics(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	listing := filepath.Join(env.tmpDir, "yt-dlp")
+	require.NoError(t, ioutil.WriteFile(listing, []byte("#!/bin/sh\n"+
+		"echo '{\"title\": \"Channel\", \"entries\": ["+
+		"{\"id\": \"a\", \"title\": \"A\", \"timestamp\": 1600000000}, "+
+		"{\"id\": \"b\", \"title\": \"B\", \"timestamp\": 1500000000}]}'\n"), 0755))
+	env.updater.config.Downloader.Path = listing
+
+	// The first download fails and isn't retried
+	env.downloader.failures = 1
+
+	feedConfig := testFeed("metrics")
+	feedConfig.URL = "https://www.bitchute.com/channel/name/"
+	feedConfig.SponsorblockMode = "off"
+
+	require.NoError(t, env.updater.Update(testCtx, feedConfig))
+	assert.Equal(t, 2, env.downloader.calls)
+
+	assert.Equal(t, 1.0, metricValue(t, "podsync_episodes_downloaded_total", feedConfig.ID))
+	assert.Equal(t, 1.0, metricValue(t, "podsync_download_failures_total", feedConfig.ID))
+	assert.Equal(t, float64(len("media")), metricValue(t, "podsync_downloaded_bytes_total", feedConfig.ID))
+	assert.Equal(t, 1.0, metricValue(t, "podsync_update_duration_seconds_count", feedConfig.ID))
+}
+
+func TestUpdater_NotifyOnShutdown(t *testing.T) {
+	env, teardown := setupUpdater(t, "")
+	defer teardown()
+
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+
+	webhook, err := notify.NewWebhook(&config.Notifications{Webhooks: []string{server.URL}, Batch: true}, http.DefaultClient)
+	require.NoError(t, err)
+	env.updater.webhook = webhook
+
+	feedConfig := testFeed("1")
+	feedConfig.SponsorblockMode = "off"
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "a", Status: model.EpisodeNew, PubDate: time.Now()})
+	addEpisode(t, env, feedConfig.ID, &model.Episode{ID: "b", Status: model.EpisodeNew, PubDate: time.Now().Add(-time.Hour)})
+
+	// Shutdown happens while the second episode is being downloaded
+	env.downloader.delay = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(testCtx, 75*time.Millisecond)
+	defer cancel()
+
+	_ = env.updater.downloadEpisodes(ctx, feedConfig)
+	require.Error(t, ctx.Err())
+
+	episode, err := env.db.GetEpisode(testCtx, feedConfig.ID, "a")
+	require.NoError(t, err)
+	assert.Equal(t, model.EpisodeDownloaded, episode.Status)
+
+	// The batch of stored episodes is still announced
+	assert.EqualValues(t, 1, atomic.LoadInt32(&received))
+}
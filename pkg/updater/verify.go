@@ -0,0 +1,82 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"os/exec"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Downloaded file duration may differ from the one reported by API, e.g. due to encoding
+	verifyMinTolerance      = 5.0  // seconds
+	verifyRelativeTolerance = 0.05 // of expected duration
+)
+
+type probeResult struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// verifyDownload runs ffprobe to make sure the file has a media stream and its duration matches
+// the expected one (in seconds, 0 if unknown)
+func (u *Updater) verifyDownload(ctx context.Context, path string, expected float64) error {
+	duration, err := u.probeDuration(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if expected > 0 {
+		tolerance := math.Max(verifyMinTolerance, expected*verifyRelativeTolerance)
+		if math.Abs(duration-expected) > tolerance {
+			return errors.Errorf("duration %.1fs doesn't match expected %.1fs", duration, expected)
+		}
+	}
+
+	return nil
+}
+
+// probeDuration runs ffprobe to get the duration of a media file (in seconds)
+func (u *Updater) probeDuration(ctx context.Context, path string) (float64, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, u.config.FFmpeg.ProbePath,
+		"-v", "error", "-show_entries", "stream=codec_type:format=duration", "-of", "json", path)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, errors.Wrapf(err, "ffprobe failed: %s", lastLines(stderr.String(), 10))
+	}
+
+	var result probeResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return 0, errors.Wrap(err, "failed to parse ffprobe output")
+	}
+
+	hasMedia := false
+	for _, stream := range result.Streams {
+		if stream.CodecType == "audio" || stream.CodecType == "video" {
+			hasMedia = true
+			break
+		}
+	}
+
+	if !hasMedia {
+		return 0, errors.New("no audio or video streams found")
+	}
+
+	duration, err := strconv.ParseFloat(result.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return 0, errors.Errorf("invalid duration %q", result.Format.Duration)
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,104 @@
+package ytdl
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// ProgressSink receives download progress of episodes
+type ProgressSink interface {
+	// Progress reports download percentage (0-100) of an episode
+	Progress(feedID, episodeID string, percent float64)
+	// Done is called when the download completes or fails
+	Done(feedID, episodeID string)
+}
+
+// ProgressRegistry keeps the latest progress of running downloads
+type ProgressRegistry struct {
+	lock  sync.RWMutex
+	feeds map[string]map[string]float64
+}
+
+func NewProgressRegistry() *ProgressRegistry {
+	return &ProgressRegistry{feeds: make(map[string]map[string]float64)}
+}
+
+func (r *ProgressRegistry) Progress(feedID, episodeID string, percent float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	episodes, ok := r.feeds[feedID]
+	if !ok {
+		episodes = make(map[string]float64)
+		r.feeds[feedID] = episodes
+	}
+
+	episodes[episodeID] = percent
+}
+
+func (r *ProgressRegistry) Done(feedID, episodeID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.feeds[feedID], episodeID)
+	if len(r.feeds[feedID]) == 0 {
+		delete(r.feeds, feedID)
+	}
+}
+
+// Get returns progress of the feed's running downloads keyed by episode ID
+func (r *ProgressRegistry) Get(feedID string) map[string]float64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	result := make(map[string]float64, len(r.feeds[feedID]))
+	for id, percent := range r.feeds[feedID] {
+		result[id] = percent
+	}
+
+	return result
+}
+
+// Matches youtube-dl progress lines, e.g. "[download]  45.2% of 10.00MiB at 1.00MiB/s ETA 00:05"
+var progressRegexp = regexp.MustCompile(`^\[download\]\s+([0-9.]+)%`)
+
+func parseProgress(line string) (float64, bool) {
+	match := progressRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return 0, false
+	}
+
+	percent, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return percent, true
+}
+
+// progressWriter splits youtube-dl output into lines and reports the progress found in them
+type progressWriter struct {
+	report func(percent float64)
+	buf    []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		idx := bytes.IndexAny(w.buf, "\r\n")
+		if idx < 0 {
+			break
+		}
+
+		if percent, ok := parseProgress(string(w.buf[:idx])); ok {
+			w.report(percent)
+		}
+
+		w.buf = w.buf[idx+1:]
+	}
+
+	return len(p), nil
+}
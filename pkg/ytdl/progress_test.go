@@ -0,0 +1,90 @@
+package ytdl
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpv/podsync/pkg/config"
+	"github.com/mxpv/podsync/pkg/model"
+)
+
+func TestProgressWriter(t *testing.T) {
+	var reported []float64
+	w := &progressWriter{report: func(percent float64) {
+		reported = append(reported, percent)
+	}}
+
+	// Lines may be split between writes and separated with carriage returns
+	_, _ = w.Write([]byte("[youtube] abc: Downloading webpage\n[download]   0.0% of 10.00MiB"))
+	_, _ = w.Write([]byte(" at 1.00MiB/s ETA 00:10\r[download]  45.2% of 10.00MiB\n[down"))
+	_, _ = w.Write([]byte("load] 100% of 10.00MiB in 00:10\n[download] Destination: /tmp/abc.mp4\n"))
+
+	assert.Equal(t, []float64{0, 45.2, 100}, reported)
+}
+
+func TestProgressRegistry(t *testing.T) {
+	registry := NewProgressRegistry()
+
+	registry.Progress("feed", "a", 10)
+	registry.Progress("feed", "a", 20)
+	registry.Progress("feed", "b", 5)
+	assert.Equal(t, map[string]float64{"a": 20, "b": 5}, registry.Get("feed"))
+	assert.Empty(t, registry.Get("other"))
+
+	registry.Done("feed", "a")
+	assert.Equal(t, map[string]float64{"b": 5}, registry.Get("feed"))
+
+	registry.Done("feed", "b")
+	assert.Empty(t, registry.Get("feed"))
+}
+
+type recordingSink struct {
+	progress []float64
+	done     bool
+}
+
+func (s *recordingSink) Progress(_, _ string, percent float64) {
+	s.progress = append(s.progress, percent)
+}
+
+func (s *recordingSink) Done(_, _ string) {
+	s.done = true
+}
+
+func TestDownloadReportsProgress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Prints progress and writes the file to the --output path
+	script := "#!/bin/sh\n" +
+		"out=\"\"\n" +
+		"while [ $# -gt 0 ]; do [ \"$1\" = \"--output\" ] && out=\"$2\"; shift; done\n" +
+		"echo '[download]  50.0% of 1.00KiB'\n" +
+		"echo '[download] 100% of 1.00KiB'\n" +
+		"echo media > \"$(echo \"$out\" | sed 's/%(ext)s/mp3/')\"\n"
+	path := filepath.Join(dir, "youtube-dl")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	sink := &recordingSink{}
+	dl := &YoutubeDl{path: path}
+	dl.SetProgressSink(sink)
+
+	tempFile, err := dl.Download(context.Background(), &config.Feed{ID: "feed", Format: model.FormatAudio}, &model.Episode{ID: "abc", VideoURL: "http://url"})
+	require.NoError(t, err)
+	tempFile.Close()
+
+	assert.Equal(t, []float64{50, 100}, sink.progress)
+	assert.True(t, sink.done)
+}
@@ -2,6 +2,7 @@ package ytdl
 
 import (
 	"os"
+	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -15,6 +16,38 @@ func (f *TempFile) Close() error {
 	return err
 }
 
+// Fullpath returns the path of the file actually produced by youtube-dl, its extension might differ
+// from the feed's one (see findDownloadedFile)
 func (f *TempFile) Fullpath() string {
 	return f.File.Name()
 }
+
+// Subtitles returns the path of subtitles downloaded along with the episode or empty string if there are none
+func (f *TempFile) Subtitles() string {
+	return f.sidecar("*.vtt")
+}
+
+// InfoJSON returns the path of the info JSON written along with the episode or empty string if there is none
+func (f *TempFile) InfoJSON() string {
+	return f.sidecar("*.info.json")
+}
+
+// Thumbnail returns the path of the thumbnail written along with the episode or empty string if there is none
+func (f *TempFile) Thumbnail() string {
+	for _, pattern := range []string{"*.jpg", "*.png", "*.webp"} {
+		if path := f.sidecar(pattern); path != "" {
+			return path
+		}
+	}
+
+	return ""
+}
+
+func (f *TempFile) sidecar(pattern string) string {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(f.Fullpath()), pattern))
+	if err != nil || len(matches) == 0 {
+		return ""
+	}
+
+	return matches[0]
+}
@@ -1,13 +1,18 @@
 package ytdl
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,47 +27,108 @@ import (
 const (
 	DownloadTimeout = 10 * time.Minute
 	UpdatePeriod    = 24 * time.Hour
+	// MinVersion is the oldest supported youtube-dl/yt-dlp release, older ones can't download from YouTube anymore
+	MinVersion = "2021.12.17"
 )
 
 var (
 	ErrTooManyRequests = errors.New(http.StatusText(http.StatusTooManyRequests))
+	ErrUnavailable     = errors.New("video is no longer available")
+	ErrTooLarge        = errors.New("file is larger than max_filesize")
 )
 
+// Metadata is the information about a video reported by youtube-dl
+type Metadata struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Duration    float64  `json:"duration"` // Fractional for some extractors
+	Tags        []string `json:"tags"`
+	IsLive      bool     `json:"is_live"`
+	LiveStatus  string   `json:"live_status"` // Reported by yt-dlp only
+}
+
+// Live returns true if the video is a live stream or premiere which hasn't ended yet
+func (m *Metadata) Live() bool {
+	return IsLive(m.IsLive, m.LiveStatus)
+}
+
+// IsLive returns true if youtube-dl's is_live or live_status fields denote a stream which hasn't ended yet.
+// Recently ended streams ("post_live") are included, as they are still being processed.
+func IsLive(isLive bool, liveStatus string) bool {
+	switch liveStatus {
+	case "is_live", "is_upcoming", "post_live":
+		return true
+	default:
+		return isLive
+	}
+}
+
+// ParseMetadata decodes video information from youtube-dl info JSON (as produced by --write-info-json)
+func ParseMetadata(data []byte) (*Metadata, error) {
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to parse youtube-dl metadata")
+	}
+
+	return &metadata, nil
+}
+
 type TempFile struct {
 	*os.File
 	dir string
 }
 
 type YoutubeDl struct {
-	path       string
-	updateLock sync.Mutex // Don't call youtube-dl while self updating
+	path         string
+	updateLock   sync.RWMutex // Don't call youtube-dl while self updating, other calls may run in parallel
+	progress     ProgressSink
+	networkArgs  []string // Proxy and User-Agent arguments passed to every call
+	externalArgs []string // External downloader arguments passed to downloads
+	partialDir   string   // Directory to keep partial downloads in between attempts (empty - resume disabled)
+	tempDir      string   // Directory to download to (empty - system temp dir)
 }
 
-func New(ctx context.Context, update bool) (*YoutubeDl, error) {
-	path, err := exec.LookPath("youtube-dl")
+func New(ctx context.Context, cfg config.Downloader, ffmpeg config.FFmpeg, network config.Network) (*YoutubeDl, error) {
+	path, err := FindBinary(cfg.Path)
 	if err != nil {
-		return nil, errors.Wrap(err, "youtube-dl binary not found")
+		return nil, err
 	}
 
-	log.Debugf("found youtube-dl binary at %q", path)
+	log.Debugf("found downloader binary at %q", path)
 
 	ytdl := &YoutubeDl{
-		path: path,
+		path:         path,
+		networkArgs:  NetworkArgs(network),
+		externalArgs: buildExternalArgs(cfg),
+		tempDir:      cfg.TempDir,
+	}
+
+	if cfg.ResumeDownloads {
+		ytdl.partialDir = cfg.PartialDir
 	}
 
 	// Make sure youtube-dl exists
-	version, err := ytdl.exec(ctx, "--version")
+	output, err := ytdl.exec(ctx, "--version")
 	if err != nil {
-		return nil, errors.Wrap(err, "could not find youtube-dl")
+		return nil, errors.Wrapf(err, "could not run %q", path)
+	}
+
+	version := strings.TrimSpace(output)
+	log.Infof("using %s %s", filepath.Base(path), version)
+
+	if err := checkVersion(version); err != nil {
+		return nil, err
 	}
 
-	log.Infof("using youtube-dl %s", version)
+	if strings.HasPrefix(filepath.Base(path), "youtube-dl") {
+		log.Warn("youtube-dl is not actively maintained anymore, consider switching to yt-dlp")
+	}
 
-	if err := ytdl.ensureDependencies(ctx); err != nil {
+	if err := ytdl.ensureDependencies(ctx, ffmpeg.Path); err != nil {
 		return nil, err
 	}
 
-	if update {
+	if cfg.SelfUpdate {
 		// Do initial blocking update at launch
 		if err := ytdl.Update(ctx); err != nil {
 			log.WithError(err).Error("failed to update youtube-dl")
@@ -82,7 +148,89 @@ func New(ctx context.Context, update bool) (*YoutubeDl, error) {
 	return ytdl, nil
 }
 
-func (dl *YoutubeDl) ensureDependencies(ctx context.Context) error {
+// SetProgressSink sets the receiver of download progress
+func (dl *YoutubeDl) SetProgressSink(sink ProgressSink) {
+	dl.progress = sink
+}
+
+// FindBinary returns the path to the downloader binary, yt-dlp is preferred when no path is configured
+func FindBinary(configured string) (string, error) {
+	if configured != "" {
+		path, err := exec.LookPath(configured)
+		if err != nil {
+			return "", errors.Wrapf(err, "downloader binary %q not found", configured)
+		}
+		return path, nil
+	}
+
+	for _, name := range []string{"yt-dlp", "youtube-dl"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", errors.New("neither yt-dlp nor youtube-dl binary found")
+}
+
+// checkVersion makes sure the downloader is not older than MinVersion.
+// Versions are release dates (e.g. "2021.12.17"), unknown formats are let through.
+func checkVersion(version string) error {
+	current, ok := parseVersion(version)
+	if !ok {
+		log.Warnf("could not parse downloader version %q, skipping version check", version)
+		return nil
+	}
+
+	min, _ := parseVersion(MinVersion)
+	for i := 0; i < len(min); i++ {
+		if i >= len(current) || current[i] < min[i] {
+			return errors.Errorf("downloader version %s is too old, at least %s is required", version, MinVersion)
+		}
+		if current[i] > min[i] {
+			break
+		}
+	}
+
+	return nil
+}
+
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 3 {
+		return nil, false
+	}
+
+	result := make([]int, 0, len(parts))
+	for _, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		result = append(result, num)
+	}
+
+	return result, true
+}
+
+func (dl *YoutubeDl) ensureDependencies(ctx context.Context, ffmpegPath string) error {
+	if ffmpegPath != "" && ffmpegPath != model.DefaultFFmpegPath {
+		// Custom ffmpeg binary, don't look for anything on PATH and let youtube-dl know where it is
+		path, err := exec.LookPath(ffmpegPath)
+		if err != nil {
+			return errors.Wrapf(err, "ffmpeg binary %q not found", ffmpegPath)
+		}
+
+		output, err := exec.CommandContext(ctx, path, "-version").CombinedOutput()
+		if err != nil {
+			return errors.Wrap(err, "could not get ffmpeg version")
+		}
+
+		log.Infof("found ffmpeg: %s", output)
+
+		dl.externalArgs = append(dl.externalArgs, "--ffmpeg-location", path)
+		return nil
+	}
+
 	found := false
 
 	if path, err := exec.LookPath("ffmpeg"); err == nil {
@@ -130,29 +278,46 @@ func (dl *YoutubeDl) Update(ctx context.Context) error {
 }
 
 func (dl *YoutubeDl) Download(ctx context.Context, feedConfig *config.Feed, episode *model.Episode) (t *TempFile, err error) {
-	tmpDir, err := ioutil.TempDir("", "podsync-")
+	tmpDir, err := dl.downloadDir(feedConfig, episode)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get temp dir for download")
 	}
 
-	// defer func() {
-	// 	if err != nil {
-	// 		err1 := os.RemoveAll(tmpDir)
-	// 		if err1 != nil {
-	// 			log.Errorf("could not remove temp dir: %v", err1)
-	// 		}
-	// 	}
-	// }()
+	defer func() {
+		// Partial downloads are kept to be continued by the next attempt
+		if err != nil && (dl.partialDir == "" || err == ErrTooLarge) {
+			if err1 := os.RemoveAll(tmpDir); err1 != nil {
+				log.Errorf("could not remove temp dir: %v", err1)
+			}
+		}
+	}()
 
 	// filePath with YoutubeDl template format
-	filePath := filepath.Join(tmpDir, fmt.Sprintf("%s.%s", episode.ID, "%(ext)s"))
+	template := feedConfig.OutputTemplate
+	if template == "" {
+		template = fmt.Sprintf("%s.%s", episode.ID, "%(ext)s")
+	}
+	filePath := filepath.Join(tmpDir, template)
 
-	args := buildArgs(feedConfig, episode, filePath)
+	args := append(append([]string{}, dl.externalArgs...), buildArgs(feedConfig, episode, filePath)...)
+	if dl.partialDir != "" {
+		args = append([]string{"--continue"}, args...)
+	}
 
-	dl.updateLock.Lock()
-	defer dl.updateLock.Unlock()
+	var progress func(float64)
+	if dl.progress != nil {
+		// Print progress on separate lines instead of overwriting the same one
+		args = append([]string{"--newline"}, args...)
+		progress = func(percent float64) {
+			dl.progress.Progress(feedConfig.ID, episode.ID, percent)
+		}
+		defer dl.progress.Done(feedConfig.ID, episode.ID)
+	}
+
+	dl.updateLock.RLock()
+	defer dl.updateLock.RUnlock()
 
-	output, err := dl.exec(ctx, args...)
+	output, err := dl.execWithProgress(ctx, progress, args...)
 	if err != nil {
 		log.WithError(err).Errorf("youtube-dl error: %s", filePath)
 
@@ -166,12 +331,16 @@ func (dl *YoutubeDl) Download(ctx context.Context, feedConfig *config.Feed, epis
 		return nil, errors.New(output)
 	}
 
-	ext := "mp4"
-	if feedConfig.Format == model.FormatAudio {
-		ext = "mp3"
+	// youtube-dl doesn't fail when the file exceeds --max-filesize, it just skips the download
+	if strings.Contains(output, "larger than max-filesize") {
+		return nil, ErrTooLarge
 	}
-	// filePath now with the final extension
-	filePath = filepath.Join(tmpDir, fmt.Sprintf("%s.%s", episode.ID, ext))
+
+	filePath, err = findDownloadedFile(tmpDir, feedConfig.Extension())
+	if err != nil {
+		return nil, err
+	}
+
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to open downloaded file")
@@ -180,17 +349,152 @@ func (dl *YoutubeDl) Download(ctx context.Context, feedConfig *config.Feed, epis
 	return &TempFile{File: f, dir: tmpDir}, nil
 }
 
+// downloadDir returns the directory to download the episode to. When resuming is enabled, the directory
+// is the same for each attempt to download the episode and it's removed only once the download succeeds
+// (by TempFile.Close), otherwise it's a new temp directory.
+func (dl *YoutubeDl) downloadDir(feedConfig *config.Feed, episode *model.Episode) (string, error) {
+	if dl.partialDir == "" {
+		return ioutil.TempDir(dl.tempDir, "podsync-")
+	}
+
+	dir := PartialPath(dl.partialDir, feedConfig.ID, episode.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// PartialPath returns the directory partial downloads of the episode are kept in between attempts (see resume_downloads)
+func PartialPath(partialDir string, feedID string, episodeID string) string {
+	return filepath.Join(partialDir, feedID, episodeID)
+}
+
+// Metadata queries video information without downloading it
+func (dl *YoutubeDl) Metadata(ctx context.Context, videoURL string) (*Metadata, error) {
+	dl.updateLock.RLock()
+	defer dl.updateLock.RUnlock()
+
+	output, err := dl.exec(ctx, "--dump-json", "--skip-download", "--no-warnings", videoURL)
+	if err != nil {
+		for _, reason := range []string{"Video unavailable", "Private video", "This video has been removed", "does not exist"} {
+			if strings.Contains(output, reason) {
+				return nil, ErrUnavailable
+			}
+		}
+
+		return nil, errors.Wrap(err, output)
+	}
+
+	// Output also contains stderr, so look for the JSON line
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		return ParseMetadata([]byte(line))
+	}
+
+	return nil, errors.New("youtube-dl returned no metadata")
+}
+
 func (dl *YoutubeDl) exec(ctx context.Context, args ...string) (string, error) {
+	return dl.execWithProgress(ctx, nil, args...)
+}
+
+// execWithProgress runs youtube-dl and reports download progress parsed from its output (if progress is not nil)
+func (dl *YoutubeDl) execWithProgress(ctx context.Context, progress func(float64), args ...string) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, DownloadTimeout)
 	defer cancel()
 
+	var (
+		output bytes.Buffer
+		writer io.Writer = &output
+	)
+
+	if progress != nil {
+		writer = io.MultiWriter(&output, &progressWriter{report: progress})
+	}
+
+	args = append(append([]string{}, dl.networkArgs...), args...)
+
 	cmd := exec.CommandContext(ctx, dl.path, args...)
-	output, err := cmd.CombinedOutput()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	if err := cmd.Run(); err != nil {
+		return output.String(), errors.Wrap(err, "failed to execute youtube-dl")
+	}
+
+	return output.String(), nil
+}
+
+// NetworkArgs returns proxy and User-Agent arguments.
+// youtube-dl uses HTTP_PROXY/HTTPS_PROXY environment variables when no proxy is set.
+func NetworkArgs(network config.Network) []string {
+	var args []string
+
+	if network.Proxy != "" {
+		args = append(args, "--proxy", network.Proxy)
+	}
+
+	if network.UserAgent != "" {
+		args = append(args, "--user-agent", network.UserAgent)
+	}
+
+	return args
+}
+
+// buildExternalArgs returns arguments to hand off downloads to an external downloader (e.g. aria2c).
+// Both youtube-dl and yt-dlp accept --external-downloader, yt-dlp parses its arguments like a shell would.
+func buildExternalArgs(cfg config.Downloader) []string {
+	if cfg.External == "" {
+		return nil
+	}
+
+	args := []string{"--external-downloader", cfg.External}
+	if len(cfg.ExternalArgs) > 0 {
+		args = append(args, "--external-downloader-args", strings.Join(cfg.ExternalArgs, " "))
+	}
+
+	return args
+}
+
+// mediaExtensions are extensions of media files youtube-dl might produce, other files in the download
+// directory are unfinished downloads, external downloader control files or sidecar files
+var mediaExtensions = []string{"mp4", "m4a", "mp3", "opus", "ogg", "webm", "mkv", "aac", "flac", "wav"}
+
+// findDownloadedFile returns the path of the episode in the download directory. The file name depends on
+// the output template, so the largest media file is picked. It's expected to have the feed's extension,
+// but post-processors might leave it with another one (e.g. .mkv after merging incompatible formats),
+// such files are remuxed by the updater.
+func findDownloadedFile(dir string, ext string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return string(output), errors.Wrap(err, "failed to execute youtube-dl")
+		return "", errors.Wrap(err, "failed to list downloaded files")
+	}
+
+	for _, want := range append([]string{ext}, mediaExtensions...) {
+		var found os.FileInfo
+		for _, file := range files {
+			if file.IsDir() || strings.TrimPrefix(filepath.Ext(file.Name()), ".") != want {
+				continue
+			}
+
+			if found == nil || file.Size() > found.Size() {
+				found = file
+			}
+		}
+
+		if found != nil {
+			if want != ext {
+				log.Warnf("downloaded file has %q extension instead of %q", want, ext)
+			}
+			return filepath.Join(dir, found.Name()), nil
+		}
 	}
 
-	return string(output), nil
+	return "", errors.Errorf("downloaded .%s file is not found", ext)
 }
 
 func buildArgs(feedConfig *config.Feed, episode *model.Episode, outputFilePath string) []string {
@@ -207,15 +511,79 @@ func buildArgs(feedConfig *config.Feed, episode *model.Episode, outputFilePath s
 			format = fmt.Sprintf("bestvideo[height<=%d][ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best", feedConfig.MaxHeight)
 		}
 
+		if feedConfig.FormatSelector != "" {
+			format = feedConfig.FormatSelector
+		}
+
 		args = append(args, "--format", format)
 	} else {
-		// Audio, mp3, high by default
-		format := "bestaudio"
+		// Audio, mp3, high by default.
+		// Audio-only streams are preferred to save bandwidth, sources without them fall back to the muxed
+		// stream, audio is extracted from it in both cases
+		format := "bestaudio/best"
 		if feedConfig.Quality == model.QualityLow {
-			format = "worstaudio"
+			format = "worstaudio/worst"
+		}
+
+		if feedConfig.FormatSelector != "" {
+			format = feedConfig.FormatSelector
+		}
+
+		// youtube-dl names audio formats after extensions (m4a container for AAC)
+		args = append(args, "--extract-audio", "--audio-format", feedConfig.Extension())
+		if feedConfig.AudioBitrate > 0 {
+			args = append(args, "--audio-quality", fmt.Sprintf("%dK", feedConfig.AudioBitrate))
+		}
+		args = append(args, "--format", format)
+	}
+
+	if feedConfig.RateLimit > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(int64(feedConfig.RateLimit), 10))
+	}
+
+	if feedConfig.MaxFilesize > 0 {
+		args = append(args, "--max-filesize", strconv.FormatInt(int64(feedConfig.MaxFilesize), 10))
+	}
+
+	if feedConfig.Cookies != "" {
+		args = append(args, "--cookies", feedConfig.Cookies)
+	}
+
+	// Sorted to keep arguments stable
+	names := make([]string, 0, len(feedConfig.HTTPHeaders))
+	for name := range feedConfig.HTTPHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--add-header", name+": "+feedConfig.HTTPHeaders[name])
+	}
+
+	if feedConfig.EmbedChapters {
+		args = append(args, "--embed-chapters")
+	}
+
+	if feedConfig.PublishChapters || feedConfig.EnrichMetadata || feedConfig.SplitByChapters {
+		// Chapters and full metadata are read from the info JSON
+		args = append(args, "--write-info-json")
+	}
+
+	if feedConfig.EpisodeArtwork {
+		args = append(args, "--write-thumbnail")
+		// youtube-dl can't embed thumbnails into Opus files
+		if feedConfig.Format == model.FormatAudio && feedConfig.AudioCodec != model.AudioCodecOpus {
+			args = append(args, "--embed-thumbnail")
+		}
+	}
+
+	if feedConfig.Transcripts {
+		lang := feedConfig.Custom.Language
+		if lang == "" {
+			lang = "en"
 		}
 
-		args = append(args, "--extract-audio", "--audio-format", "mp3", "--format", format)
+		// Auto generated captions are used when there are no manual subtitles
+		args = append(args, "--write-sub", "--write-auto-sub", "--sub-format", "vtt", "--sub-lang", lang)
 	}
 
 	// Insert additional per-feed youtube-dl arguments
@@ -1,31 +1,51 @@
 package ytdl
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/mxpv/podsync/pkg/config"
 	"github.com/mxpv/podsync/pkg/model"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBuildArgs(t *testing.T) {
 	tests := []struct {
-		name      string
-		format    model.Format
-		quality   model.Quality
-		maxHeight int
-		output    string
-		videoURL  string
-		ytdlArgs  []string
-		expect    []string
+		name        string
+		format      model.Format
+		quality     model.Quality
+		maxHeight   int
+		output      string
+		videoURL    string
+		ytdlArgs    []string
+		rateLimit   config.Size
+		maxFilesize config.Size
+		chapters    bool
+		subtitles   bool
+		info        bool
+		enrich      bool
+		artwork     bool
+		codec       model.AudioCodec
+		bitrate     int
+		cookies     string
+		headers     map[string]string
+		selector    string
+		lang        string
+		expect      []string
 	}{
 		{
 			name:     "Audio unknown quality",
 			format:   model.FormatAudio,
 			output:   "/tmp/1",
 			videoURL: "http://url",
-			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio", "--output", "/tmp/1", "http://url"},
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--output", "/tmp/1", "http://url"},
 		},
 		{
 			name:     "Audio low quality",
@@ -33,7 +53,7 @@ func TestBuildArgs(t *testing.T) {
 			quality:  model.QualityLow,
 			output:   "/tmp/1",
 			videoURL: "http://url",
-			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "worstaudio", "--output", "/tmp/1", "http://url"},
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "worstaudio/worst", "--output", "/tmp/1", "http://url"},
 		},
 		{
 			name:     "Audio best quality",
@@ -41,7 +61,7 @@ func TestBuildArgs(t *testing.T) {
 			quality:  model.QualityHigh,
 			output:   "/tmp/1",
 			videoURL: "http://url",
-			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio", "--output", "/tmp/1", "http://url"},
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--output", "/tmp/1", "http://url"},
 		},
 		{
 			name:     "Video unknown quality",
@@ -101,15 +121,153 @@ func TestBuildArgs(t *testing.T) {
 			ytdlArgs: []string{"--write-sub", "--embed-subs", "--sub-lang", "en,en-US,en-GB"},
 			expect:   []string{"--format", "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best", "--write-sub", "--embed-subs", "--sub-lang", "en,en-US,en-GB", "--output", "/tmp/2", "http://url1"},
 		},
+		{
+			name:      "Audio with rate limit",
+			format:    model.FormatAudio,
+			output:    "/tmp/1",
+			videoURL:  "http://url",
+			rateLimit: 512 * 1024,
+			expect:    []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--limit-rate", "524288", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:        "Audio with max filesize",
+			format:      model.FormatAudio,
+			output:      "/tmp/1",
+			videoURL:    "http://url",
+			maxFilesize: 2 * 1024 * 1024 * 1024,
+			expect:      []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--max-filesize", "2147483648", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Audio with chapters",
+			format:   model.FormatAudio,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			chapters: true,
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--embed-chapters", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Video with format selector",
+			format:   model.FormatVideo,
+			quality:  model.QualityLow,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			selector: "bestvideo[vcodec^=av01]+bestaudio",
+			expect:   []string{"--format", "bestvideo[vcodec^=av01]+bestaudio", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Audio with format selector",
+			format:   model.FormatAudio,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			selector: "bestaudio[acodec=opus]",
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio[acodec=opus]", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Audio with cookies",
+			format:   model.FormatAudio,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			cookies:  "/config/cookies.txt",
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--cookies", "/config/cookies.txt", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Audio with published chapters",
+			format:   model.FormatAudio,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			info:     true,
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--write-info-json", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Audio with enriched metadata",
+			format:   model.FormatAudio,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			enrich:   true,
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--write-info-json", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Audio with artwork",
+			format:   model.FormatAudio,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			artwork:  true,
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--write-thumbnail", "--embed-thumbnail", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Opus audio with artwork",
+			format:   model.FormatAudio,
+			codec:    model.AudioCodecOpus,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			artwork:  true,
+			expect:   []string{"--extract-audio", "--audio-format", "opus", "--format", "bestaudio/best", "--write-thumbnail", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "AAC audio with bitrate",
+			format:   model.FormatAudio,
+			codec:    model.AudioCodecAAC,
+			bitrate:  96,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			expect:   []string{"--extract-audio", "--audio-format", "m4a", "--audio-quality", "96K", "--format", "bestaudio/best", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Video with artwork",
+			format:   model.FormatVideo,
+			quality:  model.QualityLow,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			artwork:  true,
+			expect:   []string{"--format", "worstvideo[ext=mp4]+worstaudio[ext=m4a]/worst[ext=mp4]/worst", "--write-thumbnail", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:      "Audio with transcripts",
+			format:    model.FormatAudio,
+			output:    "/tmp/1",
+			videoURL:  "http://url",
+			subtitles: true,
+			expect:    []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--write-sub", "--write-auto-sub", "--sub-format", "vtt", "--sub-lang", "en", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:      "Audio with transcripts in custom language",
+			format:    model.FormatAudio,
+			output:    "/tmp/1",
+			videoURL:  "http://url",
+			subtitles: true,
+			lang:      "de",
+			expect:    []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--write-sub", "--write-auto-sub", "--sub-format", "vtt", "--sub-lang", "de", "--output", "/tmp/1", "http://url"},
+		},
+		{
+			name:     "Audio with HTTP headers",
+			format:   model.FormatAudio,
+			output:   "/tmp/1",
+			videoURL: "http://url",
+			headers:  map[string]string{"Referer": "https://example.com/", "Authorization": "Bearer token"},
+			expect:   []string{"--extract-audio", "--audio-format", "mp3", "--format", "bestaudio/best", "--add-header", "Authorization: Bearer token", "--add-header", "Referer: https://example.com/", "--output", "/tmp/1", "http://url"},
+		},
 	}
 
 	for _, tst := range tests {
 		t.Run(tst.name, func(t *testing.T) {
 			result := buildArgs(&config.Feed{
-				Format:        tst.format,
-				Quality:       tst.quality,
-				MaxHeight:     tst.maxHeight,
-				YouTubeDLArgs: tst.ytdlArgs,
+				Format:          tst.format,
+				Quality:         tst.quality,
+				MaxHeight:       tst.maxHeight,
+				YouTubeDLArgs:   tst.ytdlArgs,
+				RateLimit:       tst.rateLimit,
+				MaxFilesize:     tst.maxFilesize,
+				EmbedChapters:   tst.chapters,
+				Transcripts:     tst.subtitles,
+				PublishChapters: tst.info,
+				EnrichMetadata:  tst.enrich,
+				EpisodeArtwork:  tst.artwork,
+				AudioCodec:      tst.codec,
+				AudioBitrate:    tst.bitrate,
+				Cookies:         tst.cookies,
+				HTTPHeaders:     tst.headers,
+				FormatSelector:  tst.selector,
+				Custom:          config.Custom{Language: tst.lang},
 			}, &model.Episode{
 				VideoURL: tst.videoURL,
 			}, tst.output)
@@ -118,3 +276,352 @@ func TestBuildArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildNetworkArgs(t *testing.T) {
+	assert.Empty(t, NetworkArgs(config.Network{}))
+	assert.Equal(t,
+		[]string{"--proxy", "http://proxy:3128", "--user-agent", "Mozilla/5.0"},
+		NetworkArgs(config.Network{Proxy: "http://proxy:3128", UserAgent: "Mozilla/5.0"}))
+}
+
+func TestBuildExternalArgs(t *testing.T) {
+	assert.Empty(t, buildExternalArgs(config.Downloader{}))
+	assert.Equal(t,
+		[]string{"--external-downloader", "aria2c"},
+		buildExternalArgs(config.Downloader{External: "aria2c"}))
+	assert.Equal(t,
+		[]string{"--external-downloader", "aria2c", "--external-downloader-args", "-x 16 -k 1M"},
+		buildExternalArgs(config.Downloader{External: "aria2c", ExternalArgs: []string{"-x 16", "-k 1M"}}))
+}
+
+func TestFindDownloadedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"abc.mp4.aria2", "abc.f137.mp4.part", "abc.info.json", "abc.en.vtt", "abc.webp", "abc.description"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	_, err = findDownloadedFile(dir, "mp4")
+	assert.Error(t, err)
+
+	// Merged into another container
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "abc.mkv"), nil, 0644))
+	path, err := findDownloadedFile(dir, "mp4")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "abc.mkv"), path)
+
+	// Expected extension is preferred, leftover format files are smaller than the merged one
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "abc.f137.mp4"), []byte("video"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Title of abc.mp4"), []byte("video+audio"), 0644))
+	path, err = findDownloadedFile(dir, "mp4")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "Title of abc.mp4"), path)
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		valid   bool
+	}{
+		{version: "2021.12.17", valid: true},
+		{version: "2023.03.04", valid: true},
+		{version: "2023.03.04.123456", valid: true},
+		{version: "2022.01.01", valid: true},
+		{version: "2021.06.06", valid: false},
+		{version: "2020.12.31", valid: false},
+		{version: "unknown", valid: true},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.version, func(t *testing.T) {
+			err := checkVersion(tst.version)
+			if tst.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestFindBinary(t *testing.T) {
+	_, err := FindBinary("/nonexistent/yt-dlp")
+	assert.Error(t, err)
+}
+
+func TestMetadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	script := "#!/bin/sh\n" +
+		"for last; do :; done\n" +
+		"case \"$last\" in\n" +
+		"*removed) echo 'ERROR: [youtube] abc: Video unavailable' >&2; exit 1 ;;\n" +
+		"*) echo '{\"title\": \"Title\", \"description\": \"Text\", \"duration\": 60}' ;;\n" +
+		"esac\n"
+	path := filepath.Join(dir, "youtube-dl")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	dl := &YoutubeDl{path: path}
+
+	metadata, err := dl.Metadata(context.Background(), "https://youtube.com/watch?v=abc")
+	require.NoError(t, err)
+	assert.Equal(t, &Metadata{Title: "Title", Description: "Text", Duration: 60}, metadata)
+
+	_, err = dl.Metadata(context.Background(), "https://youtube.com/watch?v=removed")
+	assert.Equal(t, ErrUnavailable, err)
+}
+
+func TestDownloadOutputTemplate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Expand the output template like youtube-dl does
+	script := "#!/bin/sh\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  if [ \"$1\" = \"--output\" ]; then out=\"$2\"; fi\n" +
+		"  shift\n" +
+		"done\n" +
+		"out=$(echo \"$out\" | sed -e 's/%(title)s/Title/' -e 's/%(ext)s/mp3/')\n" +
+		"echo media > \"$out\"\n"
+	path := filepath.Join(dir, "youtube-dl")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	dl := &YoutubeDl{path: path}
+	episode := &model.Episode{ID: "abc", VideoURL: "https://youtube.com/watch?v=abc"}
+
+	tests := []struct {
+		template string
+		expect   string
+	}{
+		{template: "", expect: "abc.mp3"},
+		{template: "%(title)s.%(ext)s", expect: "Title.mp3"},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.expect, func(t *testing.T) {
+			feedConfig := &config.Feed{Format: model.FormatAudio, OutputTemplate: tst.template}
+
+			file, err := dl.Download(context.Background(), feedConfig, episode)
+			require.NoError(t, err)
+			defer file.Close()
+
+			assert.Equal(t, tst.expect, filepath.Base(file.Fullpath()))
+		})
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Fail after writing a part file, complete it on the next run
+	script := "#!/bin/sh\n" +
+		"continue=0\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  if [ \"$1\" = \"--continue\" ]; then continue=1; fi\n" +
+		"  if [ \"$1\" = \"--output\" ]; then out=\"$2\"; fi\n" +
+		"  shift\n" +
+		"done\n" +
+		"out=$(echo \"$out\" | sed -e 's/%(ext)s/mp3/')\n" +
+		"if [ $continue = 1 ] && [ -f \"$out.part\" ]; then mv \"$out.part\" \"$out\"; exit 0; fi\n" +
+		"echo media > \"$out.part\"\n" +
+		"echo 'ERROR: connection reset' >&2\n" +
+		"exit 1\n"
+	path := filepath.Join(dir, "youtube-dl")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	feedConfig := &config.Feed{ID: "feed", Format: model.FormatAudio}
+	episode := &model.Episode{ID: "abc", VideoURL: "https://youtube.com/watch?v=abc"}
+
+	// Without resume, every attempt starts from scratch
+	dl := &YoutubeDl{path: path}
+	_, err = dl.Download(context.Background(), feedConfig, episode)
+	require.Error(t, err)
+	_, err = dl.Download(context.Background(), feedConfig, episode)
+	require.Error(t, err)
+
+	dl.partialDir = filepath.Join(dir, "partial")
+	_, err = dl.Download(context.Background(), feedConfig, episode)
+	require.Error(t, err)
+
+	partial := filepath.Join(dl.partialDir, "feed", "abc")
+	assert.FileExists(t, filepath.Join(partial, "abc.mp3.part"))
+
+	file, err := dl.Download(context.Background(), feedConfig, episode)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(partial, "abc.mp3"), file.Fullpath())
+
+	require.NoError(t, file.Close())
+	_, err = os.Stat(partial)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadTooLarge(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// youtube-dl exits successfully without downloading anything
+	script := "#!/bin/sh\n" +
+		"echo '[download] File is larger than max-filesize (3000 bytes > 1024 bytes). Aborting.'\n"
+	path := filepath.Join(dir, "youtube-dl")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	dl := &YoutubeDl{path: path, partialDir: filepath.Join(dir, "partial")}
+	_, err = dl.Download(context.Background(), &config.Feed{ID: "feed", Format: model.FormatAudio, MaxFilesize: 1024}, &model.Episode{ID: "abc"})
+	assert.Equal(t, ErrTooLarge, err)
+
+	// There is nothing to resume
+	_, err = os.Stat(filepath.Join(dl.partialDir, "feed", "abc"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	feedConfig := &config.Feed{ID: "feed"}
+	episode := &model.Episode{ID: "abc"}
+
+	dl := &YoutubeDl{tempDir: dir}
+	downloadDir, err := dl.downloadDir(feedConfig, episode)
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(downloadDir))
+	assert.True(t, strings.HasPrefix(filepath.Base(downloadDir), "podsync-"))
+}
+
+func TestParseMetadata(t *testing.T) {
+	metadata, err := ParseMetadata([]byte(`{"title": "Title", "description": "Text", "duration": 60.5, "tags": ["a", "b"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Metadata{Title: "Title", Description: "Text", Duration: 60.5, Tags: []string{"a", "b"}}, metadata)
+
+	_, err = ParseMetadata([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestIsLive(t *testing.T) {
+	tests := []struct {
+		isLive     bool
+		liveStatus string
+		live       bool
+	}{
+		{false, "", false},
+		{true, "", true},
+		{false, "not_live", false},
+		{true, "is_live", true},
+		{false, "is_upcoming", true},
+		{false, "post_live", true},
+		{false, "was_live", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.live, IsLive(tt.isLive, tt.liveStatus), tt.liveStatus)
+	}
+
+	metadata, err := ParseMetadata([]byte(`{"title": "Stream", "is_live": false, "live_status": "is_upcoming"}`))
+	require.NoError(t, err)
+	assert.True(t, metadata.Live())
+}
+
+func TestEnsureDependenciesCustomFFmpeg(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Custom binary outside of PATH
+	path := filepath.Join(dir, "my-ffmpeg")
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\necho 'ffmpeg version 4.4'\n"), 0755))
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", oldPath)
+
+	dl := &YoutubeDl{}
+	require.NoError(t, dl.ensureDependencies(context.Background(), path))
+	assert.Equal(t, []string{"--ffmpeg-location", path}, dl.externalArgs)
+
+	dl = &YoutubeDl{}
+	assert.Error(t, dl.ensureDependencies(context.Background(), filepath.Join(dir, "missing")))
+	assert.Error(t, dl.ensureDependencies(context.Background(), model.DefaultFFmpegPath))
+}
+
+func TestDownloadParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake youtube-dl requires a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "podsync-ytdl-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Each download records how many downloads are running by the time it finishes
+	script := "#!/bin/sh\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  if [ \"$1\" = \"--output\" ]; then out=\"$2\"; fi\n" +
+		"  shift\n" +
+		"done\n" +
+		"touch \"" + dir + "/started-$$\"\n" +
+		"sleep 0.5\n" +
+		"ls \"" + dir + "\" | grep -c '^started-' > \"" + dir + "/seen-$$\"\n" +
+		"rm \"" + dir + "/started-$$\"\n" +
+		"echo media > \"$(echo \"$out\" | sed -e 's/%(ext)s/mp3/')\"\n"
+	path := filepath.Join(dir, "youtube-dl")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	dl := &YoutubeDl{path: path, tempDir: dir}
+	feedConfig := &config.Feed{ID: "feed", Format: model.FormatAudio}
+
+	errs := make(chan error, 2)
+	for _, id := range []string{"a", "b"} {
+		go func(id string) {
+			file, err := dl.Download(context.Background(), feedConfig, &model.Episode{ID: id})
+			if err == nil {
+				err = file.Close()
+			}
+			errs <- err
+		}(id)
+	}
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	seen, err := filepath.Glob(filepath.Join(dir, "seen-*"))
+	require.NoError(t, err)
+	require.Len(t, seen, 2)
+
+	overlapped := false
+	for _, path := range seen {
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		if strings.TrimSpace(string(data)) == "2" {
+			overlapped = true
+		}
+	}
+	assert.True(t, overlapped, "downloads didn't run in parallel")
+}